@@ -0,0 +1,162 @@
+// Command gameserv-loadgen simulates many duel and slime clients to find out
+// how many players one server process handles.
+//
+// Duel clients move to random destinations and slime clients press random keys.
+// At the end, it reports connect latency, world state arrival jitter,
+// disconnects for each game, and the ping reported by the slime server.
+// The duel server does not report pings to its clients.
+//
+// By default, the servers run in the same process, so it works offline:
+//
+//	gameserv-loadgen -duel 200 -slime 2000 -duration 1m
+//
+// With -url, it connects to a running server instead:
+//
+//	gameserv-loadgen -url ws://localhost:8080 -slime 100
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"victorz.ca/gameserv/common/gameclient"
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/duel"
+	"victorz.ca/gameserv/slime"
+)
+
+// dialer connects a client to a game, "d" for duel or "s" for slime.
+type dialer func(game string) (gameserver.Conn, error)
+
+func main() {
+	duels := flag.Int("duel", 100, "number of duel clients")
+	slimes := flag.Int("slime", 100, "number of slime clients")
+	duration := flag.Duration("duration", 30*time.Second, "how long clients play")
+	rate := flag.Float64("rate", 200, "new connections per second, or 0 for all at once")
+	input := flag.Duration("input", 100*time.Millisecond, "interval between inputs of a client")
+	url := flag.String("url", "", "WebSocket URL of a running server, instead of an in-process server")
+	pipe := flag.Bool("pipe", false, "connect to the in-process server over in-memory pipes instead of WebSocket")
+	flag.Parse()
+
+	dial := dialURL(*url)
+	if *url == "" {
+		var stop func()
+		var err error
+		dial, stop, err = startServers(*pipe)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer stop()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+
+	duelStats, slimeStats := newStats("duel", false), newStats("slime", true)
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+
+	// interleave the games while pacing connections
+	start := time.Now()
+	var pace <-chan time.Time
+	if *rate > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer t.Stop()
+		pace = t.C
+	}
+	for i := 0; i < max(*duels, *slimes) && ctx.Err() == nil; i++ {
+		i := i
+		if i < *duels {
+			run(func() { runDuel(ctx, dial, duelStats, i, *input) })
+		}
+		if i < *slimes {
+			run(func() { runSlime(ctx, dial, slimeStats, i, *input) })
+		}
+		if pace != nil {
+			select {
+			case <-pace:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+
+	fmt.Printf("%d duel and %d slime clients for %v\n\n", *duels, *slimes, time.Since(start).Round(time.Millisecond))
+	duelStats.report(os.Stdout)
+	fmt.Println()
+	slimeStats.report(os.Stdout)
+}
+
+// dialURL connects to the server at a base WebSocket URL.
+func dialURL(url string) dialer {
+	url = strings.TrimSuffix(url, "/")
+	return func(game string) (gameserver.Conn, error) {
+		return gameclient.Dial(url + "/" + game)
+	}
+}
+
+// startServers starts duel and slime servers in the process,
+// which are reached over WebSocket on a loopback port, or over pipes.
+func startServers(pipe bool) (dial dialer, stop func(), err error) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	duelServer := duel.NewServer(logger)
+	slimeServer := slime.NewServer(logger)
+
+	var games gameserver.Registry
+	games.Register(duelServer, "d")
+	games.Register(slimeServer, "s")
+	games.Start(context.Background())
+	stopServers := games.Stop
+
+	if pipe {
+		const bufSize = 256
+		serve := map[string]func(gameserver.Conn){
+			"d": duelServer.ServeConn,
+			"s": slimeServer.ServeConn,
+		}
+		dial = func(game string) (gameserver.Conn, error) {
+			c, s := gameserver.Pipe(bufSize)
+			go serve[game](s)
+			return c, nil
+		}
+		return dial, stopServers, nil
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		stopServers()
+		return nil, nil, err
+	}
+	mux := http.NewServeMux()
+	games.Mount(mux)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP server", "error", err)
+		}
+	}()
+
+	stop = func() {
+		srv.Close()
+		stopServers()
+	}
+	return dialURL("ws://" + l.Addr().String()), stop, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"victorz.ca/gameserv/duel"
+	duelclient "victorz.ca/gameserv/duel/client"
+	"victorz.ca/gameserv/slime"
+	slimeclient "victorz.ca/gameserv/slime/client"
+)
+
+// arrivals measures the jitter of messages that arrive periodically:
+// the difference between consecutive intervals between messages.
+type arrivals struct {
+	last     time.Time
+	interval time.Duration
+}
+
+// observe records a message arriving at t, and returns its jitter
+// once there are two intervals to compare.
+func (a *arrivals) observe(t time.Time) (jitter time.Duration, ok bool) {
+	if !a.last.IsZero() {
+		interval := t.Sub(a.last)
+		if a.interval != 0 {
+			jitter, ok = interval-a.interval, true
+			if jitter < 0 {
+				jitter = -jitter
+			}
+		}
+		a.interval = interval
+	}
+	a.last = t
+	return
+}
+
+// reset forgets the last message, when messages pause.
+func (a *arrivals) reset() { *a = arrivals{} }
+
+// runDuel plays a duel client number i until ctx is done.
+func runDuel(ctx context.Context, dial dialer, st *stats, i int, input time.Duration) {
+	start := time.Now()
+	conn, err := dial("d")
+	if err != nil {
+		st.failed(err)
+		return
+	}
+	c, err := duelclient.New(conn, fmt.Sprintf("load%d", i), uint8(i))
+	if err != nil {
+		st.failed(err)
+		return
+	}
+	defer c.Close()
+
+	t := time.NewTicker(input)
+	defer t.Stop()
+	var ws arrivals
+	welcomed := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.Move(rand.Float64()*duel.MAX_W, rand.Float64()*duel.MAX_H)
+		case e, ok := <-c.Events:
+			if !ok {
+				st.closed(c.Err(), welcomed)
+				return
+			}
+			switch e.(type) {
+			case duelclient.Welcome:
+				welcomed = true
+				st.connect.add(time.Since(start))
+			case duelclient.WorldState:
+				st.worldState(&ws)
+			}
+		}
+	}
+}
+
+// runSlime plays a slime client number i until ctx is done.
+func runSlime(ctx context.Context, dial dialer, st *stats, i int, input time.Duration) {
+	start := time.Now()
+	conn, err := dial("s")
+	if err != nil {
+		st.failed(err)
+		return
+	}
+	c, err := slimeclient.New(conn, fmt.Sprintf("load%d", i), rand.Intn(0x1000000))
+	if err != nil {
+		st.failed(err)
+		return
+	}
+	defer c.Close()
+
+	t := time.NewTicker(input)
+	defer t.Stop()
+	var ws arrivals
+	welcomed := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			keys := rand.Intn(8)
+			c.Input(slime.InputState{L: keys&1 != 0, R: keys&2 != 0, U: keys&4 != 0})
+		case e, ok := <-c.Events:
+			if !ok {
+				st.closed(c.Err(), welcomed)
+				return
+			}
+			switch e := e.(type) {
+			case slimeclient.Welcome:
+				welcomed = true
+				st.connect.add(time.Since(start))
+			case slimeclient.WorldState:
+				st.worldState(&ws)
+			case slimeclient.EndRound, slimeclient.Leave:
+				// states pause between rounds and matches
+				ws.reset()
+			case slimeclient.PingTimes:
+				st.ping.add(e.Self)
+			}
+		}
+	}
+}
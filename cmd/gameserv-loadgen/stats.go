@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"victorz.ca/gameserv/common/gameclient"
+	"victorz.ca/gameserv/common/gameserver"
+
+	"github.com/gorilla/websocket"
+)
+
+// samples collects durations to report their distribution.
+type samples struct {
+	lock sync.Mutex
+	d    []time.Duration
+}
+
+func (s *samples) add(d time.Duration) {
+	s.lock.Lock()
+	s.d = append(s.d, d)
+	s.lock.Unlock()
+}
+
+// String summarizes the samples with percentiles.
+func (s *samples) String() string {
+	s.lock.Lock()
+	d := slices.Clone(s.d)
+	s.lock.Unlock()
+	if len(d) == 0 {
+		return "n=0"
+	}
+
+	slices.Sort(d)
+	var sum time.Duration
+	for _, v := range d {
+		sum += v
+	}
+	p := func(q float64) time.Duration {
+		return d[int(q*float64(len(d)-1))]
+	}
+	r := func(d time.Duration) time.Duration { return d.Round(10 * time.Microsecond) }
+	return fmt.Sprintf("n=%d mean=%v p50=%v p95=%v p99=%v max=%v",
+		len(d), r(sum/time.Duration(len(d))), r(p(0.5)), r(p(0.95)), r(p(0.99)), r(d[len(d)-1]))
+}
+
+// stats are the measurements of the clients of a game.
+type stats struct {
+	game    string
+	connect samples  // from dialing until the welcome
+	jitter  samples  // of world state arrivals
+	ping    *samples // reported by the server, if the game reports it
+
+	lock        sync.Mutex
+	failures    map[string]int // could not connect
+	rejects     map[string]int // closed before the welcome
+	disconnects map[string]int // closed after the welcome
+	worldStates int
+}
+
+// newStats makes the stats of a game, whose server reports the ping of
+// each player if serverPing.
+func newStats(game string, serverPing bool) *stats {
+	s := &stats{
+		game:        game,
+		failures:    make(map[string]int),
+		rejects:     make(map[string]int),
+		disconnects: make(map[string]int),
+	}
+	if serverPing {
+		s.ping = new(samples)
+	}
+	return s
+}
+
+// worldState records the arrival of a world state.
+func (s *stats) worldState(a *arrivals) {
+	if jitter, ok := a.observe(time.Now()); ok {
+		s.jitter.add(jitter)
+	}
+	s.lock.Lock()
+	s.worldStates++
+	s.lock.Unlock()
+}
+
+// failed records a client that could not connect.
+func (s *stats) failed(err error) {
+	s.lock.Lock()
+	s.failures[err.Error()]++
+	s.lock.Unlock()
+}
+
+// closed records a connection closed by the server or the network.
+func (s *stats) closed(err error, welcomed bool) {
+	if errors.Is(err, gameclient.ErrClosed) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if welcomed {
+		s.disconnects[reason(err)]++
+	} else {
+		s.rejects[reason(err)]++
+	}
+}
+
+// reason names the close reason of err, or describes it.
+func reason(err error) string {
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) {
+		for _, r := range gameserver.AllReasons() {
+			if r.Code() == ce.Code {
+				return r.String()
+			}
+		}
+		return fmt.Sprintf("close %d", ce.Code)
+	}
+	if err == nil {
+		return "closed"
+	}
+	return err.Error()
+}
+
+// report writes the measurements.
+func (s *stats) report(w io.Writer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fmt.Fprintf(w, "%s\n", s.game)
+	fmt.Fprintf(w, "  connect latency  %v\n", &s.connect)
+	fmt.Fprintf(w, "  state jitter     %v\n", &s.jitter)
+	if s.ping != nil {
+		fmt.Fprintf(w, "  server ping      %v\n", s.ping)
+	}
+	fmt.Fprintf(w, "  world states     %d\n", s.worldStates)
+	for _, c := range []struct {
+		name   string
+		counts map[string]int
+	}{
+		{"connect failures", s.failures},
+		{"rejects", s.rejects},
+		{"disconnects", s.disconnects},
+	} {
+		total := 0
+		keys := make([]string, 0, len(c.counts))
+		for k, n := range c.counts {
+			keys = append(keys, k)
+			total += n
+		}
+		slices.Sort(keys)
+		fmt.Fprintf(w, "  %-16s %d\n", c.name, total)
+		for _, k := range keys {
+			fmt.Fprintf(w, "    %-14s %d\n", k, c.counts[k])
+		}
+	}
+}
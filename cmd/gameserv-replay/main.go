@@ -0,0 +1,79 @@
+// Command gameserv-replay simulates recorded slime matches again,
+// and checks that the simulation matches the recorded checksums.
+//
+//	gameserv-replay [-v] file.slrp...
+//
+// Replays are recorded by the server when SLIME_REPLAY_DIR is set.
+// With -v, it prints the state after every physics frame.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"victorz.ca/gameserv/slime"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "print the state after every frame")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-v] file.slrp...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, name := range flag.Args() {
+		if err := verify(name, *verbose); err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// verify reads and simulates the replay in file name.
+func verify(name string, verbose bool) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := slime.ReadReplay(f)
+	if err != nil {
+		return err
+	}
+
+	frames, rounds := 0, 0
+	for _, e := range r.Events {
+		switch e.Kind {
+		case slime.ReplayFrame:
+			frames++
+		case slime.ReplayEndRound:
+			rounds++
+		}
+	}
+	fmt.Printf("%s: %q (#%06x) vs %q (#%06x) at %v, seed %d, %d frames, %d rounds\n",
+		name, r.Names[0], r.Colors[0], r.Names[1], r.Colors[1],
+		r.Start.UTC().Format("2006-01-02 15:04:05"), r.Seed, frames, rounds)
+
+	var visit func(frame int, g *slime.Game)
+	if verbose {
+		visit = func(frame int, g *slime.Game) {
+			fmt.Printf("%6d  p1 %-22v %v  p2 %-22v %v  ball %v %v\n", frame,
+				g.P1.InputState, g.P1.O, g.P2.InputState, g.P2.O, g.B.O, g.B.V)
+		}
+	}
+	if err := r.Play(visit); err != nil {
+		return err
+	}
+	fmt.Printf("%s: ok\n", name)
+	return nil
+}
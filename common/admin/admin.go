@@ -0,0 +1,312 @@
+// Package admin implements an HTTP API for operators to inspect and manage games.
+//
+// Every request must have the header "Authorization: Bearer <token>".
+// Under the prefix where the Handler is mounted:
+//
+//	GET  /                        lists the names of the games
+//	GET  /{game}                  the status of a game, as JSON
+//	POST /{game}/kick?conn={id}   disconnects the player with a connection ID
+//	POST /{game}/kick?slot={n}    disconnects the player in a slot, if the game has slots
+//	POST /{game}/message          sends the text of the body to the players whose
+//	                              clients show messages, and returns how many
+//	                              received it and were skipped
+//	GET  /bans                    lists the bans that have not expired
+//	POST /bans                    adds the ban in the body, see banRequest
+//	DELETE /bans/{id}             removes a ban
+//
+// Legacy clients, whose hello has no version, cannot show messages:
+// they are skipped, and there is no fallback such as a chat line.
+//
+// Bans keep out new connections. Players that are already connected
+// may be kicked.
+//
+// Responses are JSON. Errors are {"error": "..."} with an HTTP error status.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"victorz.ca/gameserv/common/gameserver"
+)
+
+// MaxMessageLen is the maximum length in bytes of a message to players.
+const MaxMessageLen = 1024
+
+// Game is a game managed by the admin API.
+type Game interface {
+	// AdminStatus returns the state of the game, which is encoded as JSON.
+	AdminStatus() any
+	// Kick disconnects the player with a connection ID,
+	// and returns false if it is not connected.
+	Kick(id uint64) bool
+	// Announce sends a message to the players, and returns how many it was
+	// sent to, and how many were skipped because their clients do not show
+	// messages, such as legacy clients, or are reconnecting.
+	Announce(text string) (sent, skipped int)
+}
+
+// SlotKicker is a Game whose players have slots.
+type SlotKicker interface {
+	// KickSlot disconnects the player in a slot,
+	// and returns false if no player is connected there.
+	KickSlot(slot int) bool
+}
+
+// Handler serves the admin API of registered games.
+type Handler struct {
+	// Token authenticates requests. If it is empty, every request is refused.
+	Token string
+	// Logger receives the actions of operators.
+	Logger *slog.Logger
+	// TrustedProxies forward the addresses of operators, which are logged.
+	TrustedProxies gameserver.TrustedProxies
+	// Bans, if not nil, is edited under /bans.
+	Bans *gameserver.BanList
+
+	games map[string]Game
+	lock  sync.Mutex
+}
+
+// Register adds a game to the API under name.
+func (h *Handler) Register(name string, g Game) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.games == nil {
+		h.games = make(map[string]Game)
+	}
+	h.games[name] = g
+}
+
+func (h *Handler) game(name string) Game {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.games[name]
+}
+
+func (h *Handler) names() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	names := make([]string, 0, len(h.games))
+	for name := range h.games {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// authorized returns whether the request has the bearer token.
+func (h *Handler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && h.Token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) == 1
+}
+
+func (h *Handler) log(r *http.Request, action string, attrs ...any) {
+	if h.Logger != nil {
+		attrs = append(attrs, "event", "admin", "remote_addr", h.TrustedProxies.ClientIP(r).String())
+		h.Logger.Info("admin "+action, attrs...)
+	}
+}
+
+// ServeHTTP serves a request of the API. The prefix where the Handler
+// is mounted must be removed from the path, such as by http.StripPrefix.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	name, action, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+	if name == "" {
+		if method(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, h.names())
+		}
+		return
+	} else if name == "bans" && h.Bans != nil {
+		h.bans(w, r, action)
+		return
+	}
+	g := h.game(name)
+	if g == nil {
+		writeError(w, http.StatusNotFound, "unknown game")
+		return
+	}
+
+	switch action {
+	case "":
+		if method(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, g.AdminStatus())
+		}
+	case "kick":
+		if method(w, r, http.MethodPost) {
+			h.kick(w, r, name, g)
+		}
+	case "message":
+		if method(w, r, http.MethodPost) {
+			h.announce(w, r, name, g)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "unknown action")
+	}
+}
+
+// kick disconnects the player chosen by the conn or slot parameter.
+func (h *Handler) kick(w http.ResponseWriter, r *http.Request, name string, g Game) {
+	q := r.URL.Query()
+	var kicked bool
+	if conn := q.Get("conn"); conn != "" {
+		id, err := strconv.ParseUint(conn, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid conn")
+			return
+		}
+		kicked = g.Kick(id)
+		h.log(r, "kick", "game", name, "conn_id", id, "kicked", kicked)
+	} else if slot := q.Get("slot"); slot != "" {
+		sk, ok := g.(SlotKicker)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "game has no slots")
+			return
+		}
+		n, err := strconv.Atoi(slot)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid slot")
+			return
+		}
+		kicked = sk.KickSlot(n)
+		h.log(r, "kick", "game", name, "slot", n, "kicked", kicked)
+	} else {
+		writeError(w, http.StatusBadRequest, "missing conn or slot")
+		return
+	}
+
+	if !kicked {
+		writeError(w, http.StatusNotFound, "player not connected")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"kicked": true})
+}
+
+// announce sends the text of the body to the players of g.
+func (h *Handler) announce(w http.ResponseWriter, r *http.Request, name string, g Game) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxMessageLen))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "message too long")
+		return
+	}
+	text := strings.TrimSpace(string(b))
+	if text == "" || !utf8.ValidString(text) {
+		writeError(w, http.StatusBadRequest, "message must be non-empty UTF-8 text")
+		return
+	}
+	sent, skipped := g.Announce(text)
+	h.log(r, "message", "game", name, "text", text, "recipients", sent, "skipped", skipped)
+	writeJSON(w, http.StatusOK, map[string]int{"recipients": sent, "skipped": skipped})
+}
+
+// banRequest is the body of a request to add a ban.
+// A ban expires at Expires, or after Duration (such as "72h"), or never.
+type banRequest struct {
+	Kind     gameserver.BanKind `json:"kind"`
+	Value    string             `json:"value"`
+	Reason   string             `json:"reason"`
+	Expires  *time.Time         `json:"expires"`
+	Duration string             `json:"duration"`
+}
+
+// bans serves the ban list. id is the rest of the path.
+func (h *Handler) bans(w http.ResponseWriter, r *http.Request, id string) {
+	if id != "" {
+		if !method(w, r, http.MethodDelete) {
+			return
+		}
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "unknown ban")
+			return
+		}
+		removed, err := h.Bans.Remove(n)
+		h.log(r, "unban", "ban_id", n, "removed", removed)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		} else if !removed {
+			writeError(w, http.StatusNotFound, "unknown ban")
+		} else {
+			writeJSON(w, http.StatusOK, map[string]bool{"removed": true})
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, h.Bans.List())
+	case http.MethodPost:
+		var req banRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ban := gameserver.Ban{Kind: req.Kind, Value: req.Value, Reason: req.Reason, Expires: req.Expires}
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 || ban.Expires != nil {
+				writeError(w, http.StatusBadRequest, "invalid duration")
+				return
+			}
+			expires := time.Now().Add(d)
+			ban.Expires = &expires
+		}
+		ban, err := h.Bans.Add(ban)
+		if errors.Is(err, gameserver.ErrInvalidBan) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.log(r, "ban", "ban_id", ban.ID, "kind", ban.Kind, "value", ban.Value, "reason", ban.Reason)
+		if err != nil {
+			// the ban applies, but is lost when the server restarts
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, ban)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// method checks the method of a request, and responds with an error if it differs.
+func method(w http.ResponseWriter, r *http.Request, m string) bool {
+	if r.Method == m || (m == http.MethodGet && r.Method == http.MethodHead) {
+		return true
+	}
+	w.Header().Set("Allow", m)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,239 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+
+	"victorz.ca/gameserv/common/gameserver"
+)
+
+// fakeGame is a Game with a connection ID for each player,
+// of which shows have clients that show messages.
+type fakeGame struct {
+	conns     map[uint64]bool
+	shows     int
+	announced []string
+}
+
+func (g *fakeGame) AdminStatus() any { return map[string]int{"players": len(g.conns)} }
+
+func (g *fakeGame) Kick(id uint64) bool {
+	ok := g.conns[id]
+	delete(g.conns, id)
+	return ok
+}
+
+func (g *fakeGame) Announce(text string) (sent, skipped int) {
+	g.announced = append(g.announced, text)
+	return g.shows, len(g.conns) - g.shows
+}
+
+// slotGame is a fakeGame whose players have slots.
+type slotGame struct {
+	fakeGame
+	slots map[int]bool
+}
+
+func (g *slotGame) KickSlot(slot int) bool {
+	ok := g.slots[slot]
+	delete(g.slots, slot)
+	return ok
+}
+
+// newHandler returns a Handler with the games "a", which has slots, and "b".
+func newHandler() (*Handler, *slotGame, *fakeGame) {
+	a := &slotGame{fakeGame{conns: map[uint64]bool{1: true}}, map[int]bool{0: true}}
+	b := &fakeGame{conns: map[uint64]bool{1: true, 2: true, 3: true}, shows: 2}
+	h := &Handler{Token: "secret"}
+	h.Register("a", a)
+	h.Register("b", b)
+	return h, a, b
+}
+
+// do serves a request with the token, and returns the response.
+func do(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestUnauthorized(t *testing.T) {
+	h, _, _ := newHandler()
+	for _, auth := range []string{"", "Bearer", "Bearer wrong", "secret", "Basic secret", "Bearer secret2"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: status %d, want %d with a challenge", auth, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// without a token, every request is refused
+	h.Token = ""
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("empty token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	h, _, _ := newHandler()
+	tests := []struct {
+		method, target string
+		status         int
+		body           string
+	}{
+		{"GET", "/", 200, `["a","b"]`},
+		{"HEAD", "/", 200, ""},
+		{"GET", "/b", 200, `{"players":3}`},
+		{"GET", "/b/", 200, `{"players":3}`},
+		{"GET", "/c", 404, `{"error":"unknown game"}`},
+		{"GET", "/b/unknown", 404, `{"error":"unknown action"}`},
+		{"POST", "/", 405, `{"error":"method not allowed"}`},
+		{"POST", "/b", 405, `{"error":"method not allowed"}`},
+		{"GET", "/b/kick?conn=1", 405, `{"error":"method not allowed"}`},
+		{"GET", "/b/message", 405, `{"error":"method not allowed"}`},
+		// without a ban list, bans is a game name
+		{"GET", "/bans", 404, `{"error":"unknown game"}`},
+	}
+	for _, tt := range tests {
+		w := do(h, tt.method, tt.target, "")
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, w.Code, tt.status)
+		}
+		if tt.status == http.StatusMethodNotAllowed && w.Header().Get("Allow") == "" {
+			t.Errorf("%s %s: no Allow header", tt.method, tt.target)
+		}
+		if tt.body != "" {
+			assertJSON(t, tt.method+" "+tt.target, w, tt.body)
+		}
+	}
+}
+
+func TestKick(t *testing.T) {
+	h, a, b := newHandler()
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/b/kick?conn=2", 200},
+		{"/b/kick?conn=2", 404}, // already kicked
+		{"/b/kick?conn=9", 404},
+		{"/b/kick?conn=x", 400},
+		{"/b/kick?conn=-1", 400},
+		{"/b/kick?slot=0", 400}, // no slots
+		{"/b/kick", 400},
+		{"/a/kick?slot=0", 200},
+		{"/a/kick?slot=1", 404},
+		{"/a/kick?slot=x", 400},
+		{"/a/kick?conn=1", 200},
+	}
+	for _, tt := range tests {
+		if w := do(h, http.MethodPost, tt.target, ""); w.Code != tt.status {
+			t.Errorf("POST %s: status %d, want %d", tt.target, w.Code, tt.status)
+		}
+	}
+	if len(a.conns) != 0 || len(a.slots) != 0 {
+		t.Errorf("game a has conns %v and slots %v after kicking them", a.conns, a.slots)
+	}
+	if want := map[uint64]bool{1: true, 3: true}; !reflect.DeepEqual(b.conns, want) {
+		t.Errorf("game b has conns %v, want %v", b.conns, want)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	h, _, b := newHandler()
+	w := do(h, http.MethodPost, "/b/message", "  restart at 12:00 ✓\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	assertJSON(t, "message", w, `{"recipients":2,"skipped":1}`)
+	if want := []string{"restart at 12:00 ✓"}; !reflect.DeepEqual(b.announced, want) {
+		t.Errorf("announced %q, want %q", b.announced, want)
+	}
+
+	for _, tt := range []struct {
+		name, body string
+		status     int
+	}{
+		{"limit", strings.Repeat("x", MaxMessageLen), http.StatusOK},
+		{"too long", strings.Repeat("x", MaxMessageLen+1), http.StatusRequestEntityTooLarge},
+		{"empty", "", http.StatusBadRequest},
+		{"blank", " \n\t", http.StatusBadRequest},
+		{"not UTF-8", "\xff\xfe", http.StatusBadRequest},
+	} {
+		if w := do(h, http.MethodPost, "/b/message", tt.body); w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+	if len(b.announced) != 2 {
+		t.Errorf("announced %d messages, want 2", len(b.announced))
+	}
+}
+
+func TestBans(t *testing.T) {
+	h, _, _ := newHandler()
+	h.Bans, _ = gameserver.LoadBanList("")
+	tests := []struct {
+		method, target, body string
+		status               int
+	}{
+		{"POST", "/bans", `{"kind":"ip","value":"192.0.2.1","reason":"spam"}`, 201},
+		{"POST", "/bans", `{"kind":"name","value":"alice","duration":"72h"}`, 201},
+		{"POST", "/bans", `{"kind":"cidr","value":"192.0.2.1"}`, 400},
+		{"POST", "/bans", `{"kind":"user","value":"alice"}`, 400},
+		{"POST", "/bans", `{"kind":"name","value":"bob","duration":"-1h"}`, 400},
+		{"POST", "/bans", `{"kind":"name","value":"bob","duration":"1h","expires":"2030-01-01T00:00:00Z"}`, 400},
+		{"POST", "/bans", `{"kind":"name","value":"bob","id":7}`, 400},
+		{"POST", "/bans", `{`, 400},
+		{"PUT", "/bans", "", 405},
+		{"GET", "/bans/1", "", 405},
+		{"DELETE", "/bans/1", "", 200},
+		{"DELETE", "/bans/1", "", 404},
+		{"DELETE", "/bans/x", "", 404},
+	}
+	for _, tt := range tests {
+		if w := do(h, tt.method, tt.target, tt.body); w.Code != tt.status {
+			t.Errorf("%s %s %s: status %d, want %d: %s", tt.method, tt.target, tt.body, w.Code, tt.status, w.Body)
+		}
+	}
+
+	w := do(h, http.MethodGet, "/bans", "")
+	var bans []gameserver.Ban
+	if err := json.Unmarshal(w.Body.Bytes(), &bans); err != nil {
+		t.Fatal(err)
+	}
+	if len(bans) != 1 || bans[0].ID != 2 || bans[0].Value != "alice" || bans[0].Expires == nil {
+		t.Errorf("bans %+v, want alice for 72h", bans)
+	}
+	if h.Bans.CheckName("alice") == nil || h.Bans.CheckIP(netip.MustParseAddr("192.0.2.1")) != nil {
+		t.Error("the API did not change the bans that apply")
+	}
+}
+
+// assertJSON checks that the body of w is the same JSON as want.
+func assertJSON(t *testing.T, name string, w *httptest.ResponseRecorder, want string) {
+	t.Helper()
+	var got, exp any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Errorf("%s: body %q: %v", name, w.Body, err)
+		return
+	}
+	json.Unmarshal([]byte(want), &exp)
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("%s: body %s, want %s", name, strings.TrimSpace(w.Body.String()), want)
+	}
+}
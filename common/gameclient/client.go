@@ -0,0 +1,108 @@
+// Package gameclient implements the client side of connections to game servers.
+package gameclient
+
+import (
+	"errors"
+	"sync"
+
+	"victorz.ca/gameserv/common/gameserver"
+
+	"github.com/gorilla/websocket"
+)
+
+// EventBufSize is the number of events buffered before the client stops reading.
+const EventBufSize = 256
+
+// ErrClosed is returned by Err after Close.
+var ErrClosed = errors.New("gameclient: closed")
+
+// Dial connects to a game server at a ws:// or wss:// URL.
+func Dial(url string) (gameserver.Conn, error) {
+	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Client is a connection to a game server that decodes messages into events of type E.
+// Events must be received, or the client stops reading messages.
+type Client[E any] struct {
+	// Events receives the decoded messages, and is closed when the connection closes.
+	Events <-chan E
+	events chan E
+
+	conn      gameserver.Conn
+	writeLock sync.Mutex
+
+	err       error         // set before events is closed
+	done      chan struct{} // closed by Close
+	closeOnce sync.Once
+}
+
+// New makes a Client for a connection. Run must be called to receive events.
+func New[E any](c gameserver.Conn) *Client[E] {
+	events := make(chan E, EventBufSize)
+	return &Client[E]{
+		Events: events,
+		events: events,
+		conn:   c,
+		done:   make(chan struct{}),
+	}
+}
+
+// Run reads messages until the connection closes, decoding them with decode.
+// Messages that decode returns false for are skipped. Events is closed when Run returns.
+func (c *Client[E]) Run(decode func(msg []byte) (E, bool, error)) {
+	defer close(c.events)
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err == nil {
+			var e E
+			var ok bool
+			if e, ok, err = decode(msg); ok {
+				select {
+				case c.events <- e:
+				case <-c.done:
+				}
+			}
+		}
+		if err != nil {
+			select {
+			case <-c.done:
+				err = ErrClosed
+			default:
+			}
+			c.err = err
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// Send sends a binary message to the server. It may be called concurrently.
+func (c *Client[E]) Send(b []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.conn.WriteMessage(gameserver.BinaryMessage, b)
+}
+
+// SendText sends a text message to the server. It may be called concurrently.
+func (c *Client[E]) SendText(b []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.conn.WriteMessage(gameserver.TextMessage, b)
+}
+
+// Close closes the connection.
+func (c *Client[E]) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.conn.Close()
+}
+
+// Err returns why the connection closed, after Events is closed.
+// It is a *websocket.CloseError if the server closed the connection with
+// a close code, such as gameserver.CloseIdle.
+func (c *Client[E]) Err() error {
+	return c.err
+}
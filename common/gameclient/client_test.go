@@ -0,0 +1,108 @@
+package gameclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"victorz.ca/gameserv/common/gameserver"
+)
+
+var errBad = errors.New("bad message")
+
+// decode decodes messages as strings, skipping "skip" and failing on "bad".
+func decode(msg []byte) (string, bool, error) {
+	switch string(msg) {
+	case "skip":
+		return "", false, nil
+	case "bad":
+		return "", false, errBad
+	}
+	return string(msg), true, nil
+}
+
+// start runs a client over a Pipe, and returns it with the server end.
+func start(t *testing.T) (*Client[string], gameserver.Conn) {
+	t.Helper()
+	client, server := gameserver.Pipe(16)
+	t.Cleanup(func() { server.Close() })
+	c := New[string](client)
+	t.Cleanup(func() { c.Close() })
+	go c.Run(decode)
+	return c, server
+}
+
+// events receives the events of c until Events is closed.
+func events(t *testing.T, c *Client[string]) []string {
+	t.Helper()
+	var got []string
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e, ok := <-c.Events:
+			if !ok {
+				return got
+			}
+			got = append(got, e)
+		case <-timeout:
+			t.Fatalf("Events not closed, got %q", got)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	c, server := start(t)
+	for _, msg := range []string{"a", "skip", "b"} {
+		server.WriteMessage(gameserver.BinaryMessage, []byte(msg))
+	}
+	server.WriteControl(gameserver.CloseMessage, websocket.FormatCloseMessage(gameserver.CloseIdle, "idle"), time.Now().Add(time.Second))
+
+	if got := events(t, c); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("events %q, want [a b]", got)
+	}
+	var ce *websocket.CloseError
+	if err := c.Err(); !errors.As(err, &ce) || ce.Code != gameserver.CloseIdle || ce.Text != "idle" {
+		t.Errorf("Err() = %v, want close %d idle", err, gameserver.CloseIdle)
+	}
+}
+
+func TestClientSend(t *testing.T) {
+	c, server := start(t)
+	c.Send([]byte("move"))
+	c.SendText([]byte("token"))
+	for _, want := range []struct {
+		mt  int
+		msg string
+	}{{gameserver.BinaryMessage, "move"}, {gameserver.TextMessage, "token"}} {
+		mt, msg, err := server.ReadMessage()
+		if err != nil || mt != want.mt || string(msg) != want.msg {
+			t.Errorf("server read %d %q, %v, want %d %q", mt, msg, err, want.mt, want.msg)
+		}
+	}
+}
+
+func TestClientDecodeError(t *testing.T) {
+	c, server := start(t)
+	server.WriteMessage(gameserver.BinaryMessage, []byte("bad"))
+
+	events(t, c)
+	if err := c.Err(); err != errBad {
+		t.Errorf("Err() = %v, want %v", err, errBad)
+	}
+	// the connection is closed
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := server.ReadMessage(); err == nil {
+		t.Error("server read a message after a decode error")
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	c, _ := start(t)
+	c.Close()
+	events(t, c)
+	if err := c.Err(); err != ErrClosed {
+		t.Errorf("Err() = %v, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,265 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of bans
+const (
+	BanIP        BanKind = "ip"         // an IP address
+	BanCIDR      BanKind = "cidr"       // a range of IP addresses, such as 192.0.2.0/24
+	BanName      BanKind = "name"       // a player name, ignoring case
+	BanNameRegex BanKind = "name_regex" // a regular expression matching player names
+)
+
+// BanKind is what a Ban matches.
+type BanKind string
+
+// Ban keeps out the players matching its value.
+type Ban struct {
+	ID      uint64     `json:"id"`
+	Kind    BanKind    `json:"kind"`
+	Value   string     `json:"value"`
+	Reason  string     `json:"reason,omitempty"`
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"` // nil if permanent
+
+	prefix netip.Prefix
+	re     *regexp.Regexp
+}
+
+// ErrInvalidBan is returned when adding a ban with an invalid kind or value.
+var ErrInvalidBan = errors.New("gameserver: invalid ban")
+
+// BanError is returned when a player is banned.
+// It wraps ReasonBanned.
+type BanError struct{ Ban Ban }
+
+func (e *BanError) Error() string {
+	if e.Ban.Reason == "" {
+		return ReasonBanned.Text()
+	}
+	return ReasonBanned.Text() + ": " + e.Ban.Reason
+}
+
+func (e *BanError) Unwrap() error { return ReasonBanned }
+
+// compile checks the value of the ban, and prepares it for matching.
+func (b *Ban) compile() error {
+	var err error
+	switch b.Kind {
+	case BanIP:
+		var ip netip.Addr
+		if ip, err = netip.ParseAddr(b.Value); err == nil {
+			ip = ip.Unmap()
+			b.prefix = netip.PrefixFrom(ip, ip.BitLen())
+		}
+	case BanCIDR:
+		b.prefix, err = netip.ParsePrefix(b.Value)
+		if ip := b.prefix.Addr(); ip.Is4In6() && b.prefix.Bits() >= 96 {
+			// addresses are unmapped before matching
+			b.prefix = netip.PrefixFrom(ip.Unmap(), b.prefix.Bits()-96)
+		}
+		b.prefix = b.prefix.Masked()
+	case BanName:
+		if strings.TrimSpace(b.Value) == "" {
+			err = errors.New("empty name")
+		}
+	case BanNameRegex:
+		b.re, err = regexp.Compile(b.Value)
+	default:
+		err = errors.New("unknown kind")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s %q: %v", ErrInvalidBan, b.Kind, b.Value, err)
+	}
+	return nil
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return b.Expires != nil && !now.Before(*b.Expires)
+}
+
+// matchIP returns whether the ban matches an IP address.
+func (b *Ban) matchIP(ip netip.Addr) bool {
+	return (b.Kind == BanIP || b.Kind == BanCIDR) && b.prefix.Contains(ip)
+}
+
+// matchName returns whether the ban matches a player name.
+func (b *Ban) matchName(name string) bool {
+	switch b.Kind {
+	case BanName:
+		return strings.EqualFold(name, b.Value)
+	case BanNameRegex:
+		return b.re.MatchString(name)
+	}
+	return false
+}
+
+// BanList is a list of bans, which is saved to a file when it changes.
+// A nil *BanList bans nobody.
+type BanList struct {
+	path   string
+	bans   []*Ban
+	lastID uint64
+	lock   sync.RWMutex
+}
+
+// LoadBanList reads the bans saved in the file at path,
+// which is created when the list changes. If path is empty,
+// the list is not saved.
+func LoadBanList(path string) (*BanList, error) {
+	l := &BanList{path: path}
+	if path == "" {
+		return l, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &l.bans); err != nil {
+		return nil, fmt.Errorf("gameserver: ban list %s: %w", path, err)
+	}
+	for _, ban := range l.bans {
+		if err := ban.compile(); err != nil {
+			return nil, err
+		}
+		l.lastID = max(l.lastID, ban.ID)
+	}
+	return l, nil
+}
+
+// save writes the bans to the file, replacing it atomically.
+// The list must be locked for writing.
+func (l *BanList) save() error {
+	if l.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(l.bans, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(append(b, '\n')); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
+
+// prune removes expired bans. The list must be locked for writing.
+func (l *BanList) prune(now time.Time) {
+	bans := l.bans[:0]
+	for _, b := range l.bans {
+		if !b.expired(now) {
+			bans = append(bans, b)
+		}
+	}
+	clear(l.bans[len(bans):])
+	l.bans = bans
+}
+
+// Add adds a ban and saves the list. It returns the ban with its ID,
+// and when it was created if that was not set. If the ban is invalid,
+// the error wraps ErrInvalidBan. Otherwise the ban is added, even if
+// saving fails.
+func (l *BanList) Add(b Ban) (Ban, error) {
+	if err := b.compile(); err != nil {
+		return Ban{}, err
+	}
+	now := time.Now()
+	if b.Created.IsZero() {
+		b.Created = now
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.prune(now)
+	l.lastID++
+	b.ID = l.lastID
+	l.bans = append(l.bans, &b)
+	return b, l.save()
+}
+
+// Remove removes the ban with an ID and saves the list.
+// It returns false if there is no such ban.
+func (l *BanList) Remove(id uint64) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for i, b := range l.bans {
+		if b.ID == id {
+			l.bans = append(l.bans[:i], l.bans[i+1:]...)
+			clear(l.bans[len(l.bans) : len(l.bans)+1])
+			l.prune(time.Now())
+			return true, l.save()
+		}
+	}
+	return false, nil
+}
+
+// List returns the bans that have not expired.
+func (l *BanList) List() []Ban {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	bans := make([]Ban, 0, len(l.bans))
+	for _, b := range l.bans {
+		if !b.expired(now) {
+			bans = append(bans, *b)
+		}
+	}
+	return bans
+}
+
+// find returns a *BanError for the first ban that matches, or nil.
+func (l *BanList) find(match func(*Ban) bool) error {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	for _, b := range l.bans {
+		if !b.expired(now) && match(b) {
+			return &BanError{*b}
+		}
+	}
+	return nil
+}
+
+// CheckIP returns a *BanError if an IP address is banned.
+func (l *BanList) CheckIP(ip netip.Addr) error {
+	if !ip.IsValid() {
+		return nil
+	}
+	ip = ip.Unmap()
+	return l.find(func(b *Ban) bool { return b.matchIP(ip) })
+}
+
+// CheckName returns a *BanError if a player name is banned.
+func (l *BanList) CheckName(name string) error {
+	return l.find(func(b *Ban) bool { return b.matchName(name) })
+}
@@ -0,0 +1,238 @@
+package gameserver
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mustAdd adds bans to l, and fails the test if they are invalid.
+func mustAdd(t *testing.T, l *BanList, bans ...Ban) {
+	t.Helper()
+	for _, b := range bans {
+		if _, err := l.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBanCheckIP(t *testing.T) {
+	l, _ := LoadBanList("")
+	mustAdd(t, l,
+		Ban{Kind: BanIP, Value: "192.0.2.1"},
+		Ban{Kind: BanIP, Value: "::ffff:198.51.100.7"},
+		Ban{Kind: BanIP, Value: "2001:db8::1"},
+		Ban{Kind: BanCIDR, Value: "203.0.113.0/24"},
+		Ban{Kind: BanCIDR, Value: "2001:db8:1::/48"},
+		Ban{Kind: BanCIDR, Value: "::ffff:10.1.0.0/112"},
+		Ban{Kind: BanName, Value: "10.2.3.4"},
+	)
+	for ip, banned := range map[string]bool{
+		"192.0.2.1":           true,
+		"::ffff:192.0.2.1":    true,
+		"192.0.2.2":           false,
+		"198.51.100.7":        true,
+		"::ffff:198.51.100.7": true,
+		"2001:db8::1":         true,
+		"2001:db8::2":         false,
+		"203.0.113.255":       true,
+		"::ffff:203.0.113.9":  true,
+		"203.0.114.0":         false,
+		"2001:db8:1:ffff::1":  true,
+		"2001:db8:2::1":       false,
+		"10.1.200.3":          true,
+		"::ffff:10.1.0.1":     true,
+		"10.2.0.1":            false,
+		"10.2.3.4":            false, // a name
+	} {
+		err := l.CheckIP(netip.MustParseAddr(ip))
+		if (err != nil) != banned {
+			t.Errorf("CheckIP(%s) = %v, want banned %v", ip, err, banned)
+		}
+	}
+	if err := l.CheckIP(netip.Addr{}); err != nil {
+		t.Errorf("CheckIP of an invalid address = %v", err)
+	}
+}
+
+func TestBanCheckName(t *testing.T) {
+	l, _ := LoadBanList("")
+	mustAdd(t, l,
+		Ban{Kind: BanName, Value: "Alice", Reason: "spam"},
+		Ban{Kind: BanNameRegex, Value: `^bot\d+$`},
+		Ban{Kind: BanIP, Value: "192.0.2.1"},
+	)
+	for name, banned := range map[string]bool{
+		"Alice":     true,
+		"alice":     true,
+		"ALICE":     true,
+		"alice2":    false,
+		" Alice":    false,
+		"bot12":     true,
+		"robot12":   false,
+		"bot":       false,
+		"192.0.2.1": false, // an IP address
+	} {
+		err := l.CheckName(name)
+		if (err != nil) != banned {
+			t.Errorf("CheckName(%q) = %v, want banned %v", name, err, banned)
+		}
+	}
+
+	err := l.CheckName("alice")
+	var be *BanError
+	if !errors.As(err, &be) || be.Ban.Reason != "spam" || !errors.Is(err, ReasonBanned) {
+		t.Errorf("CheckName(alice) = %#v, want a *BanError for spam", err)
+	}
+	if got, want := err.Error(), ReasonBanned.Text()+": spam"; got != want {
+		t.Errorf("error %q, want %q", got, want)
+	}
+}
+
+func TestBanInvalid(t *testing.T) {
+	l, _ := LoadBanList("")
+	for _, b := range []Ban{
+		{Kind: BanIP, Value: "192.0.2.0/24"},
+		{Kind: BanIP, Value: "example.com"},
+		{Kind: BanCIDR, Value: "192.0.2.1"},
+		{Kind: BanName, Value: "  "},
+		{Kind: BanNameRegex, Value: "("},
+		{Kind: "user", Value: "alice"},
+	} {
+		if _, err := l.Add(b); !errors.Is(err, ErrInvalidBan) {
+			t.Errorf("Add(%s %q) = %v, want %v", b.Kind, b.Value, err, ErrInvalidBan)
+		}
+	}
+	if bans := l.List(); len(bans) != 0 {
+		t.Errorf("invalid bans added: %v", bans)
+	}
+}
+
+func TestBanExpiry(t *testing.T) {
+	l, _ := LoadBanList("")
+	past, future := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	mustAdd(t, l,
+		Ban{Kind: BanName, Value: "expired", Expires: &past},
+		Ban{Kind: BanName, Value: "later", Expires: &future},
+		Ban{Kind: BanName, Value: "forever"},
+	)
+	for name, banned := range map[string]bool{"expired": false, "later": true, "forever": true} {
+		if err := l.CheckName(name); (err != nil) != banned {
+			t.Errorf("CheckName(%q) = %v, want banned %v", name, err, banned)
+		}
+	}
+	var names []string
+	for _, b := range l.List() {
+		names = append(names, b.Value)
+	}
+	if want := []string{"later", "forever"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %q, want %q", names, want)
+	}
+
+	// expired bans are removed when the list changes
+	mustAdd(t, l, Ban{Kind: BanName, Value: "new"})
+	if len(l.bans) != 3 {
+		t.Errorf("%d bans kept, want 3", len(l.bans))
+	}
+}
+
+func TestBanRemove(t *testing.T) {
+	l, _ := LoadBanList("")
+	mustAdd(t, l,
+		Ban{Kind: BanName, Value: "a"},
+		Ban{Kind: BanName, Value: "b"},
+		Ban{Kind: BanName, Value: "c"},
+	)
+	if ok, err := l.Remove(2); !ok || err != nil {
+		t.Fatalf("Remove(2) = %v, %v", ok, err)
+	}
+	if ok, _ := l.Remove(2); ok {
+		t.Error("removed a ban twice")
+	}
+	if ok, _ := l.Remove(9); ok {
+		t.Error("removed an unknown ban")
+	}
+	if err := l.CheckName("b"); err != nil {
+		t.Errorf("CheckName after the ban was removed: %v", err)
+	}
+	if len(l.bans) != 2 || l.bans[0].Value != "a" || l.bans[1].Value != "c" {
+		t.Errorf("bans %v after removing b", l.List())
+	}
+	// the removed ban is not referenced past the end of the slice
+	if tail := l.bans[:3][2]; tail != nil {
+		t.Errorf("removed ban %v still referenced", tail)
+	}
+}
+
+func TestBanSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	l, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour).Round(0)
+	mustAdd(t, l,
+		Ban{Kind: BanCIDR, Value: "192.0.2.0/24", Reason: "abuse"},
+		Ban{Kind: BanName, Value: "carol"},
+		Ban{Kind: BanNameRegex, Value: "^bot", Expires: &expires},
+	)
+	if _, err := l.Remove(2); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, want := loaded.List(), l.List()
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d bans, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.ID != w.ID || g.Kind != w.Kind || g.Value != w.Value || g.Reason != w.Reason ||
+			!g.Created.Equal(w.Created) || (g.Expires == nil) != (w.Expires == nil) ||
+			(g.Expires != nil && !g.Expires.Equal(*w.Expires)) {
+			t.Errorf("loaded ban %+v, want %+v", g, w)
+		}
+	}
+	// the loaded bans match
+	if loaded.CheckIP(netip.MustParseAddr("192.0.2.9")) == nil || loaded.CheckName("bot1") == nil {
+		t.Error("loaded bans do not match")
+	}
+	// IDs continue after the highest loaded ID
+	if b, _ := loaded.Add(Ban{Kind: BanName, Value: "dave"}); b.ID != 4 {
+		t.Errorf("ID %d after loading, want 4", b.ID)
+	}
+
+	// no temporary files are left
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("%d files after saving, want 1", len(entries))
+	}
+}
+
+func TestLoadBanListErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"syntax":  "[{",
+		"invalid": `[{"id":1,"kind":"ip","value":"nope"}]`,
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o600)
+		if _, err := LoadBanList(path); err == nil {
+			t.Errorf("loaded %s ban list", name)
+		}
+	}
+}
+
+func TestNilBanList(t *testing.T) {
+	var l *BanList
+	if l.CheckIP(netip.MustParseAddr("192.0.2.1")) != nil || l.CheckName("alice") != nil || l.List() != nil {
+		t.Error("nil ban list bans")
+	}
+}
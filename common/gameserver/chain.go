@@ -0,0 +1,103 @@
+package gameserver
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Middleware wraps the next Responder of a chain, such as logging or metrics.
+// It usually embeds next, and calls it from the callbacks it overrides.
+type Middleware[P any] func(next Responder[P]) Responder[P]
+
+// Chain returns a Responder that passes each callback through mw in order,
+// and then to base, which is usually the game itself. Chain(base, a, b)
+// is a(b(base)), so that:
+//
+//   - a middleware sees a callback before the middlewares after it,
+//     and whatever it does after calling next happens after them;
+//   - a middleware that does not call next, such as one that fails
+//     PlayerInit, hides the callback from the rest of the chain;
+//   - base handles every callback that reaches the end of the chain.
+//
+// Bans, connection limits and inbound message limits are not middlewares,
+// but fields of BaseGameServer: they refuse connections before the upgrade,
+// with an HTTP status that no callback returns, hold their connection limits
+// until the connection closes, and drop messages before MessageReceived.
+// The chain sees what they refuse through PlayerConnected and
+// PlayerUpgradeFail (PlayerInitFail for ServeConn), and MessageLimited.
+// Games check the names of players with BaseGameServer.CheckName
+// in PlayerInit, once they have read the hello.
+func Chain[P any](base Responder[P], mw ...Middleware[P]) Responder[P] {
+	r := base
+	for i := len(mw) - 1; i >= 0; i-- {
+		r = mw[i](r)
+	}
+	return r
+}
+
+// PlayerCount is the number of players that joined and have not left.
+type PlayerCount struct {
+	count uint
+	lock  sync.RWMutex
+}
+
+// Count returns the current number of players.
+func (c *PlayerCount) Count() uint {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.count
+}
+
+type countResponder[P any] struct {
+	Responder[P]
+	c *PlayerCount
+}
+
+// Counting counts players in c. The count changes before the next responder
+// is called, so it includes a player that joins and excludes one that leaves.
+func Counting[P any](c *PlayerCount) Middleware[P] {
+	return func(next Responder[P]) Responder[P] {
+		return countResponder[P]{next, c}
+	}
+}
+
+func (r countResponder[P]) PlayerJoined(c Conn, player *BinaryPlayer[P]) {
+	r.c.lock.Lock()
+	r.c.count++
+	r.c.lock.Unlock()
+
+	r.Responder.PlayerJoined(c, player)
+}
+
+func (r countResponder[P]) PlayerLeft(c Conn, player *BinaryPlayer[P]) {
+	r.c.lock.Lock()
+	r.c.count--
+	r.c.lock.Unlock()
+
+	r.Responder.PlayerLeft(c, player)
+}
+
+func (r countResponder[P]) MessageLimited(player *BinaryPlayer[P], action InboundAction, err error) {
+	messageLimited(r.Responder, player, action, err)
+}
+
+// Logging logs players with the standard logger, like LogCountResponder.
+func Logging[P LogNamer](counter Counter) Middleware[P] {
+	return func(next Responder[P]) Responder[P] {
+		return NewLogCountResponder(next, counter)
+	}
+}
+
+// Slog logs players as structured records, like SlogResponder.
+func Slog[P LogNamer](logger *slog.Logger, game string, counter Counter) Middleware[P] {
+	return func(next Responder[P]) Responder[P] {
+		return NewSlogResponder(next, logger, game, counter)
+	}
+}
+
+// Wrap returns a responder that calls next, and counts in the metrics of m.
+// It is the Middleware of m: m itself is not changed, so it may be in
+// several chains, whose players are all collected by m.
+func (m *MetricsResponder[P]) Wrap(next Responder[P]) Responder[P] {
+	return &MetricsResponder[P]{Responder: next, metricsState: m.metricsState}
+}
@@ -0,0 +1,158 @@
+package gameserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// tracer records the callbacks that reach it in trace.
+type tracer struct {
+	Responder[*testPlayer]
+	name  string
+	trace *[]string
+}
+
+// tracing is a Middleware that records callbacks before and after next.
+func tracing(name string, trace *[]string) Middleware[*testPlayer] {
+	return func(next Responder[*testPlayer]) Responder[*testPlayer] {
+		return tracer{next, name, trace}
+	}
+}
+
+func (t tracer) PlayerInit(meta *ConnMeta, c Conn) (*testPlayer, error) {
+	*t.trace = append(*t.trace, t.name)
+	p, err := t.Responder.PlayerInit(meta, c)
+	*t.trace = append(*t.trace, "/"+t.name)
+	return p, err
+}
+
+func (t tracer) PlayerJoined(c Conn, p *BinaryPlayer[*testPlayer]) {
+	*t.trace = append(*t.trace, t.name)
+	t.Responder.PlayerJoined(c, p)
+	*t.trace = append(*t.trace, "/"+t.name)
+}
+
+func (t tracer) PlayerUpgradeFail(meta *ConnMeta, r *http.Request, err error) {
+	*t.trace = append(*t.trace, fmt.Sprintf("%s %v", t.name, err))
+	t.Responder.PlayerUpgradeFail(meta, r, err)
+}
+
+var errRefused = errors.New("refused")
+
+// refuser fails PlayerInit without calling the next responder.
+type refuser struct{ Responder[*testPlayer] }
+
+func (refuser) PlayerInit(meta *ConnMeta, c Conn) (*testPlayer, error) { return nil, errRefused }
+
+func TestChainOrder(t *testing.T) {
+	var trace []string
+	base := tracer{DefaultResponder[testPlayer](), "base", &trace}
+	r := Chain[*testPlayer](base, tracing("a", &trace), tracing("b", &trace))
+
+	r.PlayerJoined(nil, nil)
+	if want := []string{"a", "b", "base", "/base", "/b", "/a"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace %q, want %q", trace, want)
+	}
+
+	if Chain[*testPlayer](base) != Responder[*testPlayer](base) {
+		t.Error("Chain without middlewares is not the base")
+	}
+}
+
+func TestChainShortCircuit(t *testing.T) {
+	var trace []string
+	base := tracer{DefaultResponder[testPlayer](), "base", &trace}
+	refuse := func(next Responder[*testPlayer]) Responder[*testPlayer] { return refuser{next} }
+	r := Chain[*testPlayer](base, tracing("a", &trace), refuse, tracing("b", &trace))
+
+	if _, err := r.PlayerInit(nil, nil); err != errRefused {
+		t.Errorf("PlayerInit error %v, want %v", err, errRefused)
+	}
+	if want := []string{"a", "/a"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace %q, want %q", trace, want)
+	}
+}
+
+// counter records the count of players that it sees in each callback.
+type counter struct {
+	Responder[*testPlayer]
+	c    *PlayerCount
+	seen *[]uint
+}
+
+func (r counter) PlayerJoined(c Conn, p *BinaryPlayer[*testPlayer]) {
+	*r.seen = append(*r.seen, r.c.Count())
+	r.Responder.PlayerJoined(c, p)
+}
+
+func (r counter) PlayerLeft(c Conn, p *BinaryPlayer[*testPlayer]) {
+	*r.seen = append(*r.seen, r.c.Count())
+	r.Responder.PlayerLeft(c, p)
+}
+
+func TestChainCount(t *testing.T) {
+	var count PlayerCount
+	var seen []uint
+	observe := func(next Responder[*testPlayer]) Responder[*testPlayer] {
+		return counter{next, &count, &seen}
+	}
+	r := Chain[*testPlayer](DefaultResponder[testPlayer](), Counting[*testPlayer](&count), observe)
+
+	r.PlayerJoined(nil, nil)
+	r.PlayerJoined(nil, nil)
+	r.PlayerLeft(nil, nil)
+	// the count includes a player that joins, and excludes one that leaves
+	if want := []uint{1, 2, 1}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("counts seen %v, want %v", seen, want)
+	}
+}
+
+func TestChainRejected(t *testing.T) {
+	var trace []string
+	g, r := newTestServer()
+	g.Responder = Chain[*testPlayer](r, tracing("a", &trace))
+	g.Bans, _ = LoadBanList("")
+	g.Bans.Add(Ban{Kind: BanIP, Value: "192.0.2.1"})
+
+	// a banned connection only reaches the chain as an upgrade failure
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	g.HandlePlayer(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if want := []string{"a " + ReasonBanned.Text()}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace %q, want %q", trace, want)
+	}
+}
+
+func TestMetricsWrapChains(t *testing.T) {
+	m := NewMetricsResponder[*testPlayer](nil, "test")
+	_, r1 := newTestServer()
+	_, r2 := newTestServer()
+	c1 := Chain[*testPlayer](r1, m.Wrap)
+	c2 := Chain[*testPlayer](r2, m.Wrap)
+
+	p1, p2 := &BinaryPlayer[*testPlayer]{}, &BinaryPlayer[*testPlayer]{}
+	c1.PlayerJoined(nil, p1)
+	c2.PlayerJoined(nil, p2)
+	// each chain calls its own next responder
+	if p := recv(t, r1.joined); p != p1 {
+		t.Error("first chain did not reach its responder")
+	}
+	if p := recv(t, r2.joined); p != p2 {
+		t.Error("second chain did not reach its responder")
+	}
+	if m.Responder != nil {
+		t.Error("Wrap changed the responder of m")
+	}
+	// m collects the players of both chains
+	if n := len(m.players); n != 2 {
+		t.Errorf("%d players collected, want 2", n)
+	}
+}
@@ -0,0 +1,138 @@
+package gameserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Conn is a message-oriented connection to a player.
+// The methods behave like those of *websocket.Conn, which implements Conn.
+// Pipe and NewStreamConn make connections for other transports.
+//
+// One goroutine may read and one may write messages at a time.
+// WriteControl and Close may be called concurrently with other methods.
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	// WriteControl writes a close, ping or pong message.
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	// SetPongHandler sets the handler of pongs received by ReadMessage.
+	SetPongHandler(h func(appData string) error)
+
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+var _ Conn = (*websocket.Conn)(nil)
+
+// Message types, which are the same as WebSocket opcodes.
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+	CloseMessage  = websocket.CloseMessage
+	PingMessage   = websocket.PingMessage
+	PongMessage   = websocket.PongMessage
+)
+
+// ErrReadLimit is returned by ReadMessage when a message is larger than the read limit.
+var ErrReadLimit = websocket.ErrReadLimit
+
+var errMessageType = errors.New("gameserver: bad message type")
+
+// frameTransport sends and receives the messages of a msgConn.
+type frameTransport interface {
+	// readFrame reads the next message, of at most limit bytes if limit is positive.
+	readFrame(limit int64) (Msg, error)
+	// writeFrame writes a message before deadline, or before the write deadline
+	// if it is zero. It may be called concurrently.
+	writeFrame(m Msg, deadline time.Time) error
+
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+// msgConn implements control messages over a frameTransport,
+// like the WebSocket protocol: pings are answered with pongs,
+// and close messages are echoed.
+type msgConn struct {
+	frameTransport
+	readLimit   int64
+	pongHandler func(appData string) error
+	closeSent   atomic.Bool
+	// readErr is returned by every read after a message over the read limit,
+	// whose payload may not have been read from the transport.
+	readErr error
+}
+
+func (c *msgConn) ReadMessage() (int, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	for {
+		m, err := c.readFrame(c.readLimit)
+		if err == ErrReadLimit {
+			c.readErr = err
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch m.MsgType {
+		case TextMessage, BinaryMessage:
+			return m.MsgType, m.Payload, nil
+		case PingMessage:
+			c.writeFrame(Msg{MsgType: PongMessage, Payload: m.Payload}, deadline(closeTimeout))
+		case PongMessage:
+			if c.pongHandler != nil {
+				if err := c.pongHandler(string(m.Payload)); err != nil {
+					return 0, nil, err
+				}
+			}
+		case CloseMessage:
+			code, text := websocket.CloseNoStatusReceived, ""
+			if len(m.Payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(m.Payload))
+				text = string(m.Payload[2:])
+			}
+			if !c.closeSent.Swap(true) {
+				c.writeFrame(Msg{MsgType: CloseMessage, Payload: websocket.FormatCloseMessage(code, "")}, deadline(closeTimeout))
+			}
+			return 0, nil, &websocket.CloseError{Code: code, Text: text}
+		default:
+			return 0, nil, errMessageType
+		}
+	}
+}
+
+func (c *msgConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return errMessageType
+	}
+	return c.writeFrame(Msg{MsgType: messageType, Payload: data}, time.Time{})
+}
+
+func (c *msgConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	switch messageType {
+	case CloseMessage:
+		c.closeSent.Store(true)
+	case PingMessage, PongMessage:
+	default:
+		return errMessageType
+	}
+	return c.writeFrame(Msg{MsgType: messageType, Payload: data}, deadline)
+}
+
+func (c *msgConn) SetReadLimit(limit int64) { c.readLimit = limit }
+
+func (c *msgConn) SetPongHandler(h func(appData string) error) { c.pongHandler = h }
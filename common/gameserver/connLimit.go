@@ -0,0 +1,148 @@
+package gameserver
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"victorz.ca/gameserv/common/ratelimit"
+)
+
+// Errors reported to PlayerUpgradeFail when a connection is over a limit.
+var (
+	ErrTooManyConnections = errors.New("too many connections from this address")
+	ErrConnectionRate     = errors.New("connecting too often")
+	ErrInvalidAddress     = errors.New("invalid client address")
+)
+
+// ConnLimitConfig limits connections from each client.
+// Zero values mean no limit.
+//
+// The address of a client is the address of the peer, unless the peer is
+// one of the TrustedProxies of the server. Behind a reverse proxy that is not
+// trusted, every client has the address of the proxy and shares its limits.
+type ConnLimitConfig struct {
+	// Maximum concurrent connections per IP address
+	MaxPerIP int
+	// Maximum concurrent connections per /24 (IPv4) or /64 (IPv6) subnet
+	MaxPerSubnet int
+	// New connections per second allowed per IP address
+	Rate float64
+	// Number of new connections per IP address allowed in a burst
+	Burst int
+}
+
+// connLimiter enforces a ConnLimitConfig.
+type connLimiter struct {
+	perIP     map[netip.Addr]int
+	perSubnet map[netip.Prefix]int
+	buckets   map[netip.Addr]*ratelimit.Bucket
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+// bucketSweepInterval is how often full (unused) buckets are discarded.
+const bucketSweepInterval = time.Minute
+
+// remoteIP returns the IP address of the client that made the request.
+func remoteIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, _ := netip.ParseAddr(host)
+	return ip.Unmap()
+}
+
+// addrIP returns the IP address of a, or the zero Addr if a is not an IP address.
+func addrIP(a net.Addr) netip.Addr {
+	switch a := a.(type) {
+	case *net.TCPAddr:
+		return a.AddrPort().Addr().Unmap()
+	case *net.UDPAddr:
+		return a.AddrPort().Addr().Unmap()
+	}
+	return netip.Addr{}
+}
+
+// subnet returns the /24 or /64 subnet containing ip.
+func subnet(ip netip.Addr) netip.Prefix {
+	bits := 64
+	if ip.Is4() {
+		bits = 24
+	}
+	p, _ := ip.Prefix(bits)
+	return p
+}
+
+// acquire counts a new connection from ip, or returns an error
+// if the connection is over a limit. A connection over the count limits
+// does not use the rate of ip. Connections without a valid ip are rejected,
+// rather than sharing limits.
+func (l *connLimiter) acquire(cfg *ConnLimitConfig, ip netip.Addr, now time.Time) error {
+	if !ip.IsValid() {
+		return ErrInvalidAddress
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.perIP == nil {
+		l.perIP = make(map[netip.Addr]int)
+		l.perSubnet = make(map[netip.Prefix]int)
+		l.buckets = make(map[netip.Addr]*ratelimit.Bucket)
+	}
+
+	sn := subnet(ip)
+	if cfg.MaxPerIP > 0 && l.perIP[ip] >= cfg.MaxPerIP {
+		return ErrTooManyConnections
+	}
+	if cfg.MaxPerSubnet > 0 && l.perSubnet[sn] >= cfg.MaxPerSubnet {
+		return ErrTooManyConnections
+	}
+
+	if cfg.Rate > 0 {
+		if now.Sub(l.lastSweep) > bucketSweepInterval {
+			for addr, b := range l.buckets {
+				if b.Full(now) {
+					delete(l.buckets, addr)
+				}
+			}
+			l.lastSweep = now
+		}
+
+		b := l.buckets[ip]
+		if b == nil {
+			burst := float64(cfg.Burst)
+			if burst < 1 {
+				burst = 1
+			}
+			b = ratelimit.NewBucket(cfg.Rate, burst)
+			l.buckets[ip] = b
+		}
+		if !b.Allow(now) {
+			return ErrConnectionRate
+		}
+	}
+
+	l.perIP[ip]++
+	l.perSubnet[sn]++
+	return nil
+}
+
+// release stops counting a connection from ip.
+func (l *connLimiter) release(ip netip.Addr) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+	sn := subnet(ip)
+	if l.perSubnet[sn]--; l.perSubnet[sn] <= 0 {
+		delete(l.perSubnet, sn)
+	}
+}
@@ -0,0 +1,62 @@
+package gameserver
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestConnLimiter(t *testing.T) {
+	cfg := ConnLimitConfig{MaxPerIP: 2, MaxPerSubnet: 3, Rate: 1, Burst: 3}
+	var l connLimiter
+	now := time.Unix(1700000000, 0)
+	a := netip.MustParseAddr("192.0.2.1")
+	b := netip.MustParseAddr("192.0.2.2")
+	c := netip.MustParseAddr("198.51.100.1")
+
+	steps := []struct {
+		ip  netip.Addr
+		err error
+	}{
+		{a, nil},
+		{a, nil},
+		{a, ErrTooManyConnections}, // per IP
+		{a, ErrTooManyConnections}, // does not use the rate of a
+		{b, nil},
+		{b, ErrTooManyConnections}, // per subnet
+		{c, nil},
+	}
+	for i, st := range steps {
+		if err := l.acquire(&cfg, st.ip, now); err != st.err {
+			t.Errorf("step %d: acquire(%v) = %v, want %v", i, st.ip, err, st.err)
+		}
+	}
+
+	// the rejected connections of a did not use its burst
+	l.release(a)
+	if err := l.acquire(&cfg, a, now); err != nil {
+		t.Errorf("acquire after release = %v", err)
+	}
+	l.release(a)
+	l.release(a)
+	if err := l.acquire(&cfg, a, now); err != ErrConnectionRate {
+		t.Errorf("acquire over the burst = %v, want %v", err, ErrConnectionRate)
+	}
+	if err := l.acquire(&cfg, a, now.Add(time.Second)); err != nil {
+		t.Errorf("acquire after refill = %v", err)
+	}
+}
+
+func TestConnLimiterInvalidAddress(t *testing.T) {
+	cfg := ConnLimitConfig{MaxPerIP: 1}
+	var l connLimiter
+	for i := 0; i < 2; i++ {
+		if err := l.acquire(&cfg, netip.Addr{}, time.Now()); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("acquire without an address = %v, want %v", err, ErrInvalidAddress)
+		}
+	}
+	if len(l.perIP) != 0 || len(l.buckets) != 0 {
+		t.Errorf("invalid addresses were counted: %v", l.perIP)
+	}
+}
@@ -0,0 +1,265 @@
+package gameserver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// tcpPair makes a pair of connected TCP connections over the loopback interface.
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		nc, _ := l.Accept()
+		accepted <- nc
+	}()
+	a, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := <-accepted
+	if b == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+// transports makes a pair of connected Conns of each transport.
+var transports = []struct {
+	name string
+	pair func(t *testing.T) (Conn, Conn)
+}{
+	{"pipe", func(t *testing.T) (Conn, Conn) {
+		a, b := Pipe(16)
+		t.Cleanup(func() {
+			a.Close()
+			b.Close()
+		})
+		return a, b
+	}},
+	{"stream", func(t *testing.T) (Conn, Conn) {
+		a, b := tcpPair(t)
+		return NewStreamConn(a), NewStreamConn(b)
+	}},
+}
+
+func TestConnRoundTrip(t *testing.T) {
+	msgs := []Msg{
+		{MsgType: BinaryMessage, Payload: []byte{1, 2, 3}},
+		{MsgType: TextMessage, Payload: []byte("hello")},
+		{MsgType: BinaryMessage, Payload: []byte{}},
+		{MsgType: BinaryMessage, Payload: bytes.Repeat([]byte{7}, 70000)},
+	}
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			a, b := tr.pair(t)
+			go func() {
+				for _, m := range msgs {
+					a.WriteMessage(m.MsgType, m.Payload)
+				}
+			}()
+			for _, want := range msgs {
+				mt, p, err := b.ReadMessage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if mt != want.MsgType || !bytes.Equal(p, want.Payload) {
+					t.Errorf("read message type %d of %d bytes, want type %d of %d bytes", mt, len(p), want.MsgType, len(want.Payload))
+				}
+			}
+			if err := a.WriteMessage(PingMessage, nil); err == nil {
+				t.Error("WriteMessage wrote a control message")
+			}
+		})
+	}
+}
+
+func TestConnPing(t *testing.T) {
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			a, b := tr.pair(t)
+			pongs := make(chan string, 1)
+			a.SetPongHandler(func(appData string) error {
+				pongs <- appData
+				return nil
+			})
+			go b.ReadMessage() // answers the ping
+			go a.ReadMessage() // handles the pong
+
+			if err := a.WriteControl(PingMessage, []byte("42"), deadline(time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			if got := recv(t, pongs); got != "42" {
+				t.Errorf("pong %q, want %q", got, "42")
+			}
+		})
+	}
+}
+
+func TestConnCloseMessage(t *testing.T) {
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			a, b := tr.pair(t)
+			msg := websocket.FormatCloseMessage(CloseIdle, "idle")
+			if err := a.WriteControl(CloseMessage, msg, deadline(time.Second)); err != nil {
+				t.Fatal(err)
+			}
+
+			var ce *websocket.CloseError
+			if _, _, err := b.ReadMessage(); !errors.As(err, &ce) || ce.Code != CloseIdle || ce.Text != "idle" {
+				t.Errorf("read %v, want close %d idle", err, CloseIdle)
+			}
+			// the close is echoed with the same code
+			if _, _, err := a.ReadMessage(); !errors.As(err, &ce) || ce.Code != CloseIdle {
+				t.Errorf("echo %v, want close %d", err, CloseIdle)
+			}
+		})
+	}
+}
+
+func TestConnClose(t *testing.T) {
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			a, b := tr.pair(t)
+			if err := a.WriteMessage(BinaryMessage, []byte("last")); err != nil {
+				t.Fatal(err)
+			}
+			a.Close()
+
+			// messages written before the close are still delivered
+			if _, p, err := b.ReadMessage(); err != nil || string(p) != "last" {
+				t.Errorf("read %q, %v, want the last message", p, err)
+			}
+			if _, _, err := b.ReadMessage(); err != io.EOF {
+				t.Errorf("read after the peer closed: %v, want EOF", err)
+			}
+			if _, _, err := a.ReadMessage(); !errors.Is(err, net.ErrClosed) {
+				t.Errorf("read after closing: %v, want %v", err, net.ErrClosed)
+			}
+		})
+	}
+}
+
+func TestConnReadLimit(t *testing.T) {
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			a, b := tr.pair(t)
+			b.SetReadLimit(4)
+			a.WriteMessage(BinaryMessage, []byte("four"))
+			a.WriteMessage(BinaryMessage, []byte("five!"))
+			a.WriteMessage(BinaryMessage, []byte("four"))
+
+			if _, p, err := b.ReadMessage(); err != nil || string(p) != "four" {
+				t.Errorf("read %q, %v, want a message at the limit", p, err)
+			}
+			// the connection is unusable after a message over the limit
+			for i := 0; i < 2; i++ {
+				if _, _, err := b.ReadMessage(); err != ErrReadLimit {
+					t.Errorf("read %d after the limit: %v, want %v", i, err, ErrReadLimit)
+				}
+			}
+		})
+	}
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			a, b := tr.pair(t)
+			b.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+			if _, _, err := b.ReadMessage(); !isTimeout(err) {
+				t.Fatalf("read %v, want a timeout", err)
+			}
+
+			b.SetReadDeadline(time.Time{})
+			a.WriteMessage(BinaryMessage, []byte("late"))
+			if _, p, err := b.ReadMessage(); err != nil || string(p) != "late" {
+				t.Errorf("read %q, %v after clearing the deadline", p, err)
+			}
+		})
+	}
+}
+
+func TestPipeWriteDeadline(t *testing.T) {
+	a, b := Pipe(1)
+	defer a.Close()
+	defer b.Close()
+
+	if err := a.WriteMessage(BinaryMessage, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	// the buffer is full
+	a.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	if err := a.WriteMessage(BinaryMessage, []byte("2")); !isTimeout(err) {
+		t.Errorf("write %v, want a timeout", err)
+	}
+	// a control deadline applies without the write deadline
+	a.SetWriteDeadline(time.Time{})
+	if err := a.WriteControl(PingMessage, nil, deadline(20*time.Millisecond)); !isTimeout(err) {
+		t.Errorf("write control %v, want a timeout", err)
+	}
+
+	b.Close()
+	if err := a.WriteMessage(BinaryMessage, []byte("3")); err != io.ErrClosedPipe {
+		t.Errorf("write after the peer closed: %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestStreamFraming(t *testing.T) {
+	raw, nc := tcpPair(t)
+	c := NewStreamConn(nc)
+
+	if err := c.WriteMessage(TextMessage, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 0, 0, 4, TextMessage, 'a', 'b', 'c'}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(raw, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("wrote frame %v, want %v", got, want)
+	}
+
+	// a frame may arrive in pieces
+	go func() {
+		for _, b := range []byte{0, 0, 0, 3, BinaryMessage, 'h', 'i'} {
+			raw.Write([]byte{b})
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	if mt, p, err := c.ReadMessage(); err != nil || mt != BinaryMessage || string(p) != "hi" {
+		t.Errorf("read %d %q, %v, want %d %q", mt, p, err, BinaryMessage, "hi")
+	}
+
+	// a frame without a message type
+	raw.Write([]byte{0, 0, 0, 0, 0})
+	if _, _, err := c.ReadMessage(); err != errFrame {
+		t.Errorf("read empty frame: %v, want %v", err, errFrame)
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	raw, nc := tcpPair(t)
+	c := NewStreamConn(nc)
+	raw.Write([]byte{0, 0, 0, 10, BinaryMessage, 1, 2})
+	raw.Close()
+	if _, _, err := c.ReadMessage(); err != io.ErrUnexpectedEOF {
+		t.Errorf("read truncated frame: %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
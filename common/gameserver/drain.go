@@ -0,0 +1,97 @@
+package gameserver
+
+import (
+	"context"
+	"time"
+)
+
+// ErrDraining is reported to PlayerUpgradeFail when a player connects
+// while the server is draining.
+var ErrDraining error = ReasonShuttingDown
+
+// Drain stops the server from accepting new players.
+// Players that are already connected are not affected.
+func (g *BaseGameServer[P]) Drain() {
+	g.playersLock.Lock()
+	defer g.playersLock.Unlock()
+	if g.draining == nil {
+		g.draining = make(chan struct{})
+	}
+	select {
+	case <-g.draining:
+	default:
+		close(g.draining)
+	}
+}
+
+// Draining returns a chan that is closed when the server starts draining.
+func (g *BaseGameServer[P]) Draining() <-chan struct{} {
+	g.playersLock.Lock()
+	defer g.playersLock.Unlock()
+	if g.draining == nil {
+		g.draining = make(chan struct{})
+	}
+	return g.draining
+}
+
+// IsDraining returns whether the server has started draining.
+func (g *BaseGameServer[P]) IsDraining() bool {
+	select {
+	case <-g.Draining():
+		return true
+	default:
+		return false
+	}
+}
+
+// waitIdle blocks until no players are connected or ctx is done.
+func (g *BaseGameServer[P]) waitIdle(ctx context.Context) error {
+	g.playersLock.Lock()
+	if len(g.players) == 0 {
+		g.playersLock.Unlock()
+		return nil
+	}
+	if g.playersIdle == nil {
+		g.playersIdle = make(chan struct{})
+	}
+	idle := g.playersIdle
+	g.playersLock.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown drains the server: it stops accepting new players, calls notify
+// for every connected player with the time remaining until ctx expires,
+// and waits for players to leave. Players still connected when ctx is done
+// are disconnected with a close frame.
+//
+// If ctx has no deadline, the remaining time is reported as zero.
+// Shutdown returns ctx.Err() if players had to be disconnected.
+func (g *BaseGameServer[P]) Shutdown(ctx context.Context, notify func(player *BinaryPlayer[*P], remaining time.Duration)) error {
+	g.Drain()
+
+	var remaining time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining = time.Until(deadline)
+	}
+	for _, p := range g.Players() {
+		notify(p, remaining)
+	}
+
+	err := g.waitIdle(ctx)
+	if err != nil {
+		for _, p := range g.Players() {
+			p.Disconnect(ReasonShuttingDown)
+		}
+		// give writers time to send the close frames
+		closeCtx, cancel := context.WithTimeout(context.Background(), 2*closeTimeout)
+		defer cancel()
+		g.waitIdle(closeCtx)
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package gameserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownIdle(t *testing.T) {
+	g, _ := newTestServer()
+	if err := g.Shutdown(context.Background(), nil); err != nil {
+		t.Errorf("Shutdown without players = %v", err)
+	}
+	if !g.IsDraining() {
+		t.Error("not draining after Shutdown")
+	}
+}
+
+func TestShutdownPlayersLeave(t *testing.T) {
+	g, r := newTestServer()
+	c := serve(t, g, "alice")
+	recv(t, r.joined)
+
+	done := make(chan error)
+	go func() {
+		done <- g.Shutdown(context.Background(), func(p *BinaryPlayer[*testPlayer], remaining time.Duration) {
+			if remaining != 0 {
+				t.Errorf("remaining = %v without a deadline", remaining)
+			}
+			p.Send([]byte("restart"))
+		})
+	}()
+	if _, b, err := c.ReadMessage(); err != nil || string(b) != "restart" {
+		t.Fatalf("read %q, %v, want the notice", b, err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v while a player is connected", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	c.Close()
+	if err := recv(t, done); err != nil {
+		t.Errorf("Shutdown = %v after the player left", err)
+	}
+}
+
+func TestShutdownDisconnects(t *testing.T) {
+	g, r := newTestServer()
+	c := serve(t, g, "alice")
+	recv(t, r.joined)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := g.Shutdown(ctx, func(p *BinaryPlayer[*testPlayer], remaining time.Duration) {
+		if remaining <= 0 || remaining > 20*time.Millisecond {
+			t.Errorf("remaining = %v, want up to 20ms", remaining)
+		}
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if code := readClose(t, c); code != ReasonShuttingDown.Code() {
+		t.Errorf("close code %d, want %d", code, ReasonShuttingDown.Code())
+	}
+	if p := recv(t, r.left); p.Reason() != ReasonShuttingDown {
+		t.Errorf("left with reason %v", p.Reason())
+	}
+}
+
+func TestShutdownDuringInit(t *testing.T) {
+	g, r := newTestServer()
+	r.gate = make(chan struct{})
+	c := serve(t, g, "alice")
+	<-r.gate // the hello is read, but PlayerInit has not returned
+
+	if err := g.Shutdown(context.Background(), func(*BinaryPlayer[*testPlayer], time.Duration) {
+		t.Error("notified a player that has not joined")
+	}); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	r.gate <- struct{}{}
+
+	if code := readClose(t, c); code != ReasonShuttingDown.Code() {
+		t.Errorf("close code %d, want %d", code, ReasonShuttingDown.Code())
+	}
+	recv(t, r.joined)
+	recv(t, r.left)
+}
+
+func TestServeConnDraining(t *testing.T) {
+	g, r := newTestServer()
+	g.Drain()
+	c := serve(t, g, "alice")
+	if code := readClose(t, c); code != ReasonShuttingDown.Code() {
+		t.Errorf("close code %d, want %d", code, ReasonShuttingDown.Code())
+	}
+	if err := recv(t, r.initFailed); !errors.Is(err, ErrDraining) {
+		t.Errorf("PlayerInitFail(%v), want %v", err, ErrDraining)
+	}
+}
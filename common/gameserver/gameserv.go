@@ -1,19 +1,27 @@
 package gameserver
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 // Responder is an interface that handles GameServer events.
+// Every callback receives the metadata of the connection, either as meta
+// or as the Meta of the player.
 type Responder[P any] interface {
-	PlayerConnected(r *http.Request)
-	PlayerUpgradeFail(r *http.Request, err error)
-	PlayerUpgradeSuccess(r *http.Request, c *websocket.Conn)
-	PlayerInit(c *websocket.Conn) P
-	PlayerJoined(c *websocket.Conn, player *BinaryPlayer[P])
-	PlayerLeft(c *websocket.Conn, player *BinaryPlayer[P])
+	PlayerConnected(meta *ConnMeta, r *http.Request)
+	PlayerUpgradeFail(meta *ConnMeta, r *http.Request, err error)
+	PlayerUpgradeSuccess(meta *ConnMeta, r *http.Request, c Conn)
+	PlayerInit(meta *ConnMeta, c Conn) (P, error)
+	PlayerInitFail(meta *ConnMeta, c Conn, err error)
+	PlayerJoined(c Conn, player *BinaryPlayer[P])
+	PlayerLeft(c Conn, player *BinaryPlayer[P])
 	MessageReceived(player *BinaryPlayer[P], msg []byte)
 }
 
@@ -21,13 +29,14 @@ type Tester Responder[func(a, b int) string]
 
 type defaultResponder[P any] struct{}
 
-func (d defaultResponder[P]) PlayerConnected(r *http.Request)                          {}
-func (d defaultResponder[P]) PlayerUpgradeFail(r *http.Request, err error)             {}
-func (d defaultResponder[P]) PlayerUpgradeSuccess(r *http.Request, c *websocket.Conn)  {}
-func (d defaultResponder[P]) PlayerInit(c *websocket.Conn) *P                          { return nil }
-func (d defaultResponder[P]) PlayerJoined(c *websocket.Conn, player *BinaryPlayer[*P]) {}
-func (d defaultResponder[P]) PlayerLeft(c *websocket.Conn, player *BinaryPlayer[*P])   {}
-func (d defaultResponder[P]) MessageReceived(player *BinaryPlayer[*P], msg []byte)     {}
+func (d defaultResponder[P]) PlayerConnected(m *ConnMeta, r *http.Request)              {}
+func (d defaultResponder[P]) PlayerUpgradeFail(m *ConnMeta, r *http.Request, err error) {}
+func (d defaultResponder[P]) PlayerUpgradeSuccess(m *ConnMeta, r *http.Request, c Conn) {}
+func (d defaultResponder[P]) PlayerInit(m *ConnMeta, c Conn) (*P, error)                { return nil, nil }
+func (d defaultResponder[P]) PlayerInitFail(m *ConnMeta, c Conn, err error)             {}
+func (d defaultResponder[P]) PlayerJoined(c Conn, player *BinaryPlayer[*P])             {}
+func (d defaultResponder[P]) PlayerLeft(c Conn, player *BinaryPlayer[*P])               {}
+func (d defaultResponder[P]) MessageReceived(player *BinaryPlayer[*P], msg []byte)      {}
 
 // DefaultResponder creates a Responder whose empty receivers do nothing.
 func DefaultResponder[P any]() Responder[*P] {
@@ -39,59 +48,289 @@ type BaseGameServer[P any] struct {
 	Responder[*P]
 
 	SendBufSize uint
-}
+	// UpgradeConfig must be set before serving players.
+	UpgradeConfig UpgradeConfig
+	// ConnLimits limits connections from each client.
+	ConnLimits ConnLimitConfig
+	// Inbound limits the messages received from each player.
+	Inbound InboundPolicy
+	// Timeouts configures connection timeouts and keepalive.
+	Timeouts TimeoutConfig
+	// TrustedProxies forward the addresses of clients, which are used
+	// instead of the addresses of the proxies.
+	TrustedProxies TrustedProxies
+	// Bans, if not nil, keeps out banned addresses. Games check
+	// the names of players with CheckName.
+	Bans *BanList
+
+	upgrader     *websocket.Upgrader
+	upgraderOnce sync.Once
+	limiter      connLimiter
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	players     map[*BinaryPlayer[*P]]struct{}
+	playersIdle chan struct{} // closed when players becomes empty
+	draining    chan struct{} // closed when the server starts draining
+	playersLock sync.Mutex
 }
 
-func reader(c *websocket.Conn, onMsg func(Msg), onError func(error)) {
+// closeTimeout is the time allowed for writing a close frame.
+const closeTimeout = time.Second
+
+func (g *BaseGameServer[P]) reader(c Conn, p *BinaryPlayer[*P]) {
+	limiter := newInboundLimiter(&g.Inbound)
 	for {
 		msgType, msg, err := c.ReadMessage()
 		if err != nil {
-			onError(nil)
+			if errors.Is(err, ErrReadLimit) {
+				messageLimited(g.Responder, p, InboundDisconnect, ErrMessageTooBig)
+			}
+			if isTimeout(err) {
+				p.Disconnect(ReasonIdle)
+			} else {
+				p.Close()
+			}
 			break
 		}
-		onMsg(Msg{msgType, msg})
+		g.Timeouts.extendIdle(c)
+		p.Traffic.Received(len(msg))
+
+		if action := limiter.check(time.Now()); action != 0 {
+			messageLimited(g.Responder, p, action, ErrMessageRate)
+			if action == InboundDisconnect {
+				p.Disconnect(ReasonMessageRate)
+				break
+			} else if action == InboundDrop {
+				continue
+			}
+		}
+		p.recv(Msg{MsgType: msgType, Payload: msg})
 	}
 }
 
-func writer(c *websocket.Conn, msgChan <-chan Msg) {
-	for msg := range msgChan {
-		if err := c.WriteMessage(msg.MsgType, msg.Payload); err != nil {
-			break
+func writer[D any](c Conn, p *Player[D], writeTimeout time.Duration) {
+	for msg := range p.sendBuf {
+		if writeTimeout > 0 {
+			c.SetWriteDeadline(deadline(writeTimeout))
+		}
+		if err := writeMsg(c, msg); err != nil {
+			return
+		}
+		p.Traffic.Sent(len(msg.Payload))
+	}
+	// sendBuf is closed after reason is set
+	if p.reason != 0 {
+		c.WriteControl(CloseMessage, p.reason.closeMessage(), deadline(closeTimeout))
+	}
+}
+
+// writeMsg writes msg to c, prepared if c is a WebSocket.
+func writeMsg(c Conn, msg Msg) error {
+	if ws, ok := c.(*websocket.Conn); ok && msg.Prepared != nil {
+		return ws.WritePreparedMessage(msg.Prepared)
+	}
+	return c.WriteMessage(msg.MsgType, msg.Payload)
+}
+
+// addPlayer tracks a player until removePlayer is called.
+// It returns false if the server is draining, as Drain holds the same lock,
+// so a player is either seen by Shutdown or learns that the server is draining.
+func (g *BaseGameServer[P]) addPlayer(p *BinaryPlayer[*P]) bool {
+	g.playersLock.Lock()
+	defer g.playersLock.Unlock()
+	if g.players == nil {
+		g.players = make(map[*BinaryPlayer[*P]]struct{})
+	}
+	g.players[p] = struct{}{}
+	if g.draining == nil {
+		return true
+	}
+	select {
+	case <-g.draining:
+		return false
+	default:
+		return true
+	}
+}
+
+// removePlayer stops tracking a player.
+func (g *BaseGameServer[P]) removePlayer(p *BinaryPlayer[*P]) {
+	g.playersLock.Lock()
+	defer g.playersLock.Unlock()
+	delete(g.players, p)
+	if len(g.players) == 0 && g.playersIdle != nil {
+		close(g.playersIdle)
+		g.playersIdle = nil
+	}
+}
+
+// Players returns the players that are currently connected.
+func (g *BaseGameServer[P]) Players() []*BinaryPlayer[*P] {
+	g.playersLock.Lock()
+	defer g.playersLock.Unlock()
+	players := make([]*BinaryPlayer[*P], 0, len(g.players))
+	for p := range g.players {
+		players = append(players, p)
+	}
+	return players
+}
+
+// CheckName returns a *BanError if a player name is banned.
+// Games call it in PlayerInit.
+func (g *BaseGameServer[P]) CheckName(name string) error {
+	return g.Bans.CheckName(name)
+}
+
+// Kick disconnects the player with connection ID id,
+// and returns false if it is not connected.
+func (g *BaseGameServer[P]) Kick(id uint64) bool {
+	g.playersLock.Lock()
+	defer g.playersLock.Unlock()
+	for p := range g.players {
+		if p.Meta.ID == id {
+			p.Disconnect(ReasonKicked)
+			return true
 		}
 	}
+	return false
 }
 
 // HandlePlayer serves a game client.
 func (g *BaseGameServer[P]) HandlePlayer(w http.ResponseWriter, r *http.Request) {
-	g.Responder.PlayerConnected(r)
-	c, err := upgrader.Upgrade(w, r, nil)
+	meta := requestMeta(r, g.TrustedProxies)
+	g.Responder.PlayerConnected(meta, r)
+	if g.IsDraining() {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, ErrDraining.Error(), http.StatusServiceUnavailable)
+		g.Responder.PlayerUpgradeFail(meta, r, ErrDraining)
+		return
+	}
+
+	ip := meta.IP
+	if err := g.Bans.CheckIP(ip); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		g.Responder.PlayerUpgradeFail(meta, r, err)
+		return
+	}
+	if err := g.limiter.acquire(&g.ConnLimits, ip, time.Now()); err != nil {
+		status := http.StatusTooManyRequests
+		if errors.Is(err, ErrInvalidAddress) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		g.Responder.PlayerUpgradeFail(meta, r, err)
+		return
+	}
+	defer g.limiter.release(ip)
+
+	if g.UpgradeConfig.RequireSubprotocol && !g.UpgradeConfig.hasSubprotocol(r) {
+		http.Error(w, ErrSubprotocol.Error(), http.StatusBadRequest)
+		g.Responder.PlayerUpgradeFail(meta, r, ErrSubprotocol)
+		return
+	}
+
+	g.upgraderOnce.Do(func() { g.upgrader = g.UpgradeConfig.newUpgrader() })
+	c, err := g.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		g.Responder.PlayerUpgradeFail(r, err)
+		g.Responder.PlayerUpgradeFail(meta, r, err)
 		return
 	}
 
+	g.Responder.PlayerUpgradeSuccess(meta, r, c)
+	g.play(r.Context(), c, meta)
+}
+
+// ServeConn serves a player on a connection that is already established,
+// such as a Pipe or a TCP connection. The HTTP callbacks of the Responder
+// are not called, and c is closed when the player leaves.
+func (g *BaseGameServer[P]) ServeConn(c Conn) {
 	defer c.Close()
+	meta := newConnMeta(addrIP(c.RemoteAddr()), c.RemoteAddr())
+	if g.IsDraining() {
+		c.WriteControl(CloseMessage, ReasonShuttingDown.closeMessage(), deadline(closeTimeout))
+		g.Responder.PlayerInitFail(meta, c, ErrDraining)
+		return
+	}
+
+	if ip := meta.IP; ip.IsValid() {
+		if err := g.Bans.CheckIP(ip); err != nil {
+			c.WriteControl(CloseMessage, ReasonBanned.closeMessage(), deadline(closeTimeout))
+			g.Responder.PlayerInitFail(meta, c, err)
+			return
+		}
+		if err := g.limiter.acquire(&g.ConnLimits, ip, time.Now()); err != nil {
+			g.Responder.PlayerInitFail(meta, c, err)
+			return
+		}
+		defer g.limiter.release(ip)
+	}
+	g.play(context.Background(), c, meta)
+}
+
+// ServeTCP accepts players on l, with connections made by NewStreamConn,
+// until l is closed.
+func (g *BaseGameServer[P]) ServeTCP(l net.Listener) error {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go g.ServeConn(NewStreamConn(nc))
+	}
+}
 
-	g.Responder.PlayerUpgradeSuccess(r, c)
+// play runs a player on c until it leaves, then closes c.
+// The context of the player is derived from ctx.
+func (g *BaseGameServer[P]) play(ctx context.Context, c Conn, meta *ConnMeta) {
+	defer c.Close()
+	if g.Inbound.MaxMessageSize > 0 {
+		c.SetReadLimit(g.Inbound.MaxMessageSize)
+	}
 
-	data := g.Responder.PlayerInit(c)
-	if data == nil {
+	c.SetReadDeadline(deadline(g.Timeouts.Handshake))
+	data, err := g.Responder.PlayerInit(meta, c)
+	if err == nil && data == nil {
+		err = ReasonProtocolError
+	}
+	if err != nil {
+		if isTimeout(err) {
+			err = ReasonHandshakeTimeout
+		}
+		if reason := ReasonOf(err); reason != 0 {
+			c.WriteControl(CloseMessage, reason.closeMessage(), deadline(closeTimeout))
+		}
+		g.Responder.PlayerInitFail(meta, c, err)
 		return
 	}
+	c.SetReadDeadline(deadline(g.Timeouts.Idle))
+	c.SetPongHandler(func(string) error {
+		g.Timeouts.extendIdle(c)
+		return nil
+	})
 
+	ctx, cancel := context.WithCancel(ctx)
 	p := NewBinaryPlayer(
+		ctx,
+		meta,
 		data,
 		nil,
 		g.SendBufSize,
 	)
 	p.Recv = func(msg []byte) { g.Responder.MessageReceived(p, msg) }
 
+	if !g.addPlayer(p) {
+		// Shutdown started during PlayerInit, so the player missed
+		// its notice. The game still sees it join and leave, to release it.
+		p.Disconnect(ReasonShuttingDown)
+	}
+	defer g.removePlayer(p)
+
 	defer g.Responder.PlayerLeft(c, p)
+	defer cancel()
 	g.Responder.PlayerJoined(c, p)
 
-	go reader(c, p.Player.recv, func(error) { p.Close() })
-	writer(c, p.Player.sendBuf)
+	go g.reader(c, p)
+	if g.Timeouts.PingInterval > 0 {
+		go g.Timeouts.pinger(c, p.Stop)
+	}
+	writer(c, &p.Player, g.Timeouts.Write)
 }
@@ -3,55 +3,29 @@ package gameserver
 import (
 	"fmt"
 	"net/http"
-	"sync"
-
-	"github.com/gorilla/websocket"
 )
 
 // GameServerCount extends BaseGameServer by counting the number of players.
 type GameServerCount[P any] struct {
 	BaseGameServer[P]
-
-	count     uint // current number of players
-	countLock sync.RWMutex
+	PlayerCount
 }
 
-// NewGameServerCount makes a new GameServerCount for the specified responder and send buffer size.
-func NewGameServerCount[P any](r Responder[*P], sendBufSize uint) *GameServerCount[P] {
+// NewGameServerCount makes a new GameServerCount for the specified send buffer size,
+// whose responder is Chain(base, mw...) after counting players.
+// The middleware mw sees the count with the player that joins or leaves.
+func NewGameServerCount[P any](sendBufSize uint, base Responder[*P], mw ...Middleware[*P]) *GameServerCount[P] {
 	g := GameServerCount[P]{
 		BaseGameServer: BaseGameServer[P]{
-			nil,
-			sendBufSize,
+			SendBufSize: sendBufSize,
 		},
 	}
-	g.BaseGameServer.Responder = &g
+	mw = append([]Middleware[*P]{Counting[*P](&g.PlayerCount)}, mw...)
+	g.Responder = Chain(base, mw...)
 	return &g
 }
 
-// Count returns the current number of players.
-func (g *GameServerCount[P]) Count() uint {
-	g.countLock.RLock()
-	defer g.countLock.RUnlock()
-	return g.count
-}
-
 // HandleNum responds to the HTTP request by writing the current number of players.
 func (g *GameServerCount[P]) HandleNum(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%v", g.Count())
 }
-
-func (g *GameServerCount[P]) PlayerJoined(c *websocket.Conn, player *BinaryPlayer[*P]) {
-	g.countLock.Lock()
-	g.count++
-	g.countLock.Unlock()
-
-	g.Responder.PlayerJoined(c, player)
-}
-
-func (g *GameServerCount[P]) PlayerLeft(c *websocket.Conn, player *BinaryPlayer[*P]) {
-	g.countLock.Lock()
-	g.count--
-	g.countLock.Unlock()
-
-	g.Responder.PlayerLeft(c, player)
-}
@@ -0,0 +1,102 @@
+package gameserver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testPlayer is the data of a player of a test server.
+type testPlayer struct{ name string }
+
+// testResponder accepts players whose first message is their name,
+// and reports their events on channels.
+type testResponder struct {
+	Responder[*testPlayer]
+
+	// gate, if not nil, is sent to after the hello, then received from
+	// before PlayerInit returns.
+	gate chan struct{}
+
+	joined, left chan *BinaryPlayer[*testPlayer]
+	received     chan string
+	initFailed   chan error
+	limited      chan InboundAction
+}
+
+func newTestServer() (*BaseGameServer[testPlayer], *testResponder) {
+	r := &testResponder{
+		Responder:  DefaultResponder[testPlayer](),
+		joined:     make(chan *BinaryPlayer[*testPlayer], 16),
+		left:       make(chan *BinaryPlayer[*testPlayer], 16),
+		received:   make(chan string, 16),
+		initFailed: make(chan error, 16),
+		limited:    make(chan InboundAction, 16),
+	}
+	return &BaseGameServer[testPlayer]{Responder: r, SendBufSize: 16}, r
+}
+
+func (r *testResponder) PlayerInit(meta *ConnMeta, c Conn) (*testPlayer, error) {
+	_, b, err := c.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if r.gate != nil {
+		r.gate <- struct{}{}
+		<-r.gate
+	}
+	return &testPlayer{string(b)}, nil
+}
+
+func (r *testResponder) PlayerInitFail(meta *ConnMeta, c Conn, err error)  { r.initFailed <- err }
+func (r *testResponder) PlayerJoined(c Conn, p *BinaryPlayer[*testPlayer]) { r.joined <- p }
+func (r *testResponder) PlayerLeft(c Conn, p *BinaryPlayer[*testPlayer])   { r.left <- p }
+func (r *testResponder) MessageReceived(p *BinaryPlayer[*testPlayer], msg []byte) {
+	r.received <- string(msg)
+}
+func (r *testResponder) MessageLimited(p *BinaryPlayer[*testPlayer], a InboundAction, err error) {
+	r.limited <- a
+}
+
+// serve connects a client to g over a Pipe, and sends its hello.
+func serve(t *testing.T, g *BaseGameServer[testPlayer], name string) Conn {
+	t.Helper()
+	client, server := Pipe(16)
+	t.Cleanup(func() { client.Close() })
+	go g.ServeConn(server)
+	if err := client.WriteMessage(BinaryMessage, []byte(name)); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// recv returns the next event from ch, or fails after a second.
+func recv[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+		panic("unreachable")
+	}
+}
+
+// readClose reads from c until it is closed, and returns the close code.
+func readClose(t *testing.T, c Conn) int {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, _, err := c.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) {
+			t.Fatalf("read %v, want a close frame", err)
+		}
+		return ce.Code
+	}
+}
@@ -0,0 +1,75 @@
+package gameserver
+
+import "encoding/binary"
+
+// HelloMagic marks a versioned hello. It is where the name starts in a legacy
+// hello, which cannot be 0xFF because names are UTF-8 text:
+//
+//	legacy:    [color...] [name...]
+//	versioned: [color...] [HelloMagic] [version] [capabilities: 2] [name...]
+const HelloMagic = 0xFF
+
+// Caps are capability flags, which are defined by each game.
+type Caps uint16
+
+// Has returns whether all flags of f are set.
+func (c Caps) Has(f Caps) bool { return c&f == f }
+
+// Handshake is the protocol version and capabilities of a connection.
+// The Version of a legacy hello is 0.
+type Handshake struct {
+	Version uint8
+	Caps    Caps
+}
+
+// IsLegacy returns whether the handshake is of a legacy hello.
+func (h Handshake) IsLegacy() bool { return h.Version == 0 }
+
+// AppendHello appends the header of a versioned hello to b,
+// or nothing for a legacy handshake.
+func (h Handshake) AppendHello(b []byte) []byte {
+	if h.IsLegacy() {
+		return b
+	}
+	return binary.BigEndian.AppendUint16(append(b, HelloMagic, h.Version), uint16(h.Caps))
+}
+
+// CutHello removes the header of a versioned hello from the start of a name.
+// A name without the header is of a legacy hello.
+func CutHello(name []byte) (h Handshake, rest []byte, err error) {
+	if len(name) == 0 || name[0] != HelloMagic {
+		return Handshake{}, name, nil
+	}
+	if len(name) < 4 || name[1] == 0 {
+		return Handshake{}, nil, ReasonProtocolError
+	}
+	h = Handshake{name[1], Caps(binary.BigEndian.Uint16(name[2:]))}
+	return h, name[4:], nil
+}
+
+// Protocol is the versions and capabilities that a server supports.
+type Protocol struct {
+	MinVersion, MaxVersion uint8
+	// Caps are the capabilities of the server.
+	Caps Caps
+	// Legacy are the capabilities assumed for legacy hellos.
+	Legacy Caps
+}
+
+// Negotiate returns the handshake of a connection for the handshake in its hello:
+// the version of the client, and the capabilities of both.
+// It returns ReasonUnsupportedVersion if the version is not supported.
+func (p Protocol) Negotiate(h Handshake) (Handshake, error) {
+	if h.IsLegacy() {
+		return Handshake{Caps: p.Legacy}, nil
+	}
+	if h.Version < p.MinVersion || h.Version > p.MaxVersion {
+		return Handshake{}, ReasonUnsupportedVersion
+	}
+	return Handshake{h.Version, h.Caps & p.Caps}, nil
+}
+
+// Latest returns the handshake of a client of the latest version with all capabilities.
+func (p Protocol) Latest() Handshake {
+	return Handshake{p.MaxVersion, p.Caps}
+}
@@ -0,0 +1,118 @@
+package gameserver
+
+import (
+	"time"
+
+	"victorz.ca/gameserv/common/ratelimit"
+)
+
+// Errors reported to MessageLimited.
+var (
+	ErrMessageTooBig error = ReasonMessageTooBig
+	ErrMessageRate   error = ReasonMessageRate
+)
+
+// InboundAction is what happens to a message that breaks the InboundPolicy.
+type InboundAction int
+
+const (
+	// InboundWarn delivers the message anyway.
+	InboundWarn InboundAction = iota + 1
+	// InboundDrop drops the message.
+	InboundDrop
+	// InboundDisconnect drops the message and disconnects the player.
+	InboundDisconnect
+)
+
+// String returns the name of the action.
+func (a InboundAction) String() string {
+	switch a {
+	case InboundWarn:
+		return "warn"
+	case InboundDrop:
+		return "drop"
+	case InboundDisconnect:
+		return "disconnect"
+	}
+	return "none"
+}
+
+// InboundPolicy limits the messages received from each player.
+// A zero MaxMessageSize or Rate means no limit.
+type InboundPolicy struct {
+	// Maximum size of a message in bytes. Larger messages disconnect the player.
+	MaxMessageSize int64
+
+	// Messages per second
+	Rate float64
+	// Number of messages allowed in a burst
+	Burst int
+
+	// Messages over the rate are strikes. Strikes are forgotten
+	// StrikeWindow after the first strike in the window.
+	StrikeWindow time.Duration
+	// Messages are delivered with a warning until there are more than
+	// DropAfter strikes, then dropped until there are more than
+	// DisconnectAfter strikes, then the player is disconnected.
+	// A zero DisconnectAfter never disconnects.
+	DropAfter, DisconnectAfter int
+}
+
+// MessageLimiter is implemented by a Responder that is told when a player
+// breaks the InboundPolicy. It is optional, so that Responders need not
+// implement it; the middlewares of this package forward it to the next
+// Responder if that is a MessageLimiter.
+type MessageLimiter[P any] interface {
+	MessageLimited(player *BinaryPlayer[P], action InboundAction, err error)
+}
+
+// messageLimited calls MessageLimited of r, if r is a MessageLimiter.
+func messageLimited[P any](r Responder[P], player *BinaryPlayer[P], action InboundAction, err error) {
+	if l, ok := r.(MessageLimiter[P]); ok {
+		l.MessageLimited(player, action, err)
+	}
+}
+
+// inboundLimiter applies an InboundPolicy to the messages of one player.
+// It is only used by the reader of the player.
+type inboundLimiter struct {
+	policy    *InboundPolicy
+	bucket    *ratelimit.Bucket
+	strikes   int
+	windowEnd time.Time
+}
+
+func newInboundLimiter(policy *InboundPolicy) *inboundLimiter {
+	l := &inboundLimiter{policy: policy}
+	if policy.Rate > 0 {
+		burst := float64(policy.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+		l.bucket = ratelimit.NewBucket(policy.Rate, burst)
+	}
+	return l
+}
+
+// check counts a message received at now and returns the action to take,
+// or zero if the message is within the policy.
+func (l *inboundLimiter) check(now time.Time) InboundAction {
+	if l.bucket == nil || l.bucket.Allow(now) {
+		return 0
+	}
+
+	if l.strikes == 0 || now.After(l.windowEnd) {
+		l.strikes = 0
+		l.windowEnd = now.Add(l.policy.StrikeWindow)
+	}
+	l.strikes++
+
+	switch {
+	case l.policy.DisconnectAfter > 0 && l.strikes > l.policy.DisconnectAfter:
+		return InboundDisconnect
+	case l.strikes > l.policy.DropAfter:
+		return InboundDrop
+	default:
+		return InboundWarn
+	}
+}
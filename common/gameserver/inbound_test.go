@@ -0,0 +1,96 @@
+package gameserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInboundLimiter(t *testing.T) {
+	policy := InboundPolicy{Rate: 1, Burst: 2, StrikeWindow: 10 * time.Second, DropAfter: 2, DisconnectAfter: 4}
+	l := newInboundLimiter(&policy)
+	t0 := time.Unix(1700000000, 0)
+
+	steps := []struct {
+		at   time.Duration
+		want InboundAction
+	}{
+		{0, 0},
+		{0, 0}, // the burst
+		{0, InboundWarn},
+		{0, InboundWarn},
+		{0, InboundDrop},
+		{time.Second, 0}, // a message within the rate is not a strike
+		{time.Second, InboundDrop},
+		{time.Second, InboundDisconnect},
+		{time.Second, InboundDisconnect},
+
+		// the strikes are forgotten after the window
+		{11 * time.Second, 0},
+		{11 * time.Second, 0},
+		{11 * time.Second, InboundWarn},
+		{11 * time.Second, InboundWarn},
+		{11 * time.Second, InboundDrop},
+
+		// the window lasts StrikeWindow from its first strike, at 11s
+		{21 * time.Second, 0},
+		{21 * time.Second, 0},
+		{21 * time.Second, InboundDrop},
+		{22 * time.Second, 0},
+		{22 * time.Second, InboundWarn},
+	}
+	for i, st := range steps {
+		if got := l.check(t0.Add(st.at)); got != st.want {
+			t.Errorf("step %d: check(+%v) = %v, want %v", i, st.at, got, st.want)
+		}
+	}
+}
+
+func TestInboundLimiterNoDisconnect(t *testing.T) {
+	l := newInboundLimiter(&InboundPolicy{Rate: 1, StrikeWindow: time.Minute, DropAfter: 1})
+	now := time.Unix(1700000000, 0)
+	want := []InboundAction{0, InboundWarn, InboundDrop, InboundDrop, InboundDrop}
+	for i, w := range want {
+		if got := l.check(now); got != w {
+			t.Errorf("message %d: %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestInboundLimiterNoRate(t *testing.T) {
+	l := newInboundLimiter(&InboundPolicy{DisconnectAfter: 1})
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 1000; i++ {
+		if got := l.check(now); got != 0 {
+			t.Fatalf("message %d: %v without a rate", i, got)
+		}
+	}
+}
+
+func TestMessageLimitedChain(t *testing.T) {
+	g, r := newTestServer()
+	var count PlayerCount
+	g.Responder = Chain[*testPlayer](r, Counting[*testPlayer](&count), NewMetricsResponder[*testPlayer](nil, "test").Wrap)
+	g.Inbound = InboundPolicy{Rate: 0.001, Burst: 1, StrikeWindow: time.Minute, DisconnectAfter: 1}
+
+	c := serve(t, g, "alice")
+	recv(t, r.joined)
+	for _, m := range []string{"a", "b", "c"} {
+		c.WriteMessage(BinaryMessage, []byte(m))
+	}
+	if got := recv(t, r.received); got != "a" {
+		t.Errorf("received %q, want a", got)
+	}
+	for _, want := range []InboundAction{InboundDrop, InboundDisconnect} {
+		if got := recv(t, r.limited); got != want {
+			t.Errorf("MessageLimited(%v) through the chain, want %v", got, want)
+		}
+	}
+	if code := readClose(t, c); code != ReasonMessageRate.Code() {
+		t.Errorf("close code %d, want %d", code, ReasonMessageRate.Code())
+	}
+	select {
+	case m := <-r.received:
+		t.Errorf("received dropped message %q", m)
+	default:
+	}
+}
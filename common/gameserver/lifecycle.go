@@ -0,0 +1,79 @@
+package gameserver
+
+import (
+	"context"
+	"sync"
+)
+
+// Lifecycle tracks the background goroutines of a game server,
+// so they can be stopped together and waited on.
+type Lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	lock   sync.Mutex
+
+	// waiting is set once Wait is called, after which Go starts nothing,
+	// so that wg.Add never races with wg.Wait.
+	waiting bool
+}
+
+// Start derives the context that is passed to goroutines started by Go.
+// Cancelling ctx has the same effect as calling Stop.
+func (l *Lifecycle) Start(ctx context.Context) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.ctx, l.cancel = context.WithCancel(ctx)
+}
+
+// Context returns the context of the running server.
+// If Start has not been called, a context that is never cancelled is returned.
+func (l *Lifecycle) Context() context.Context {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.ctx == nil {
+		return context.Background()
+	}
+	return l.ctx
+}
+
+// Go runs f in a new goroutine, which Wait will wait for.
+// It returns false without running f once Wait has been called.
+func (l *Lifecycle) Go(f func(ctx context.Context)) bool {
+	l.lock.Lock()
+	if l.waiting {
+		l.lock.Unlock()
+		return false
+	}
+	ctx := l.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	l.wg.Add(1)
+	l.lock.Unlock()
+
+	go func() {
+		defer l.wg.Done()
+		f(ctx)
+	}()
+	return true
+}
+
+// Stop cancels the context passed to goroutines started by Go.
+// It is safe to call Stop multiple times.
+func (l *Lifecycle) Stop() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.cancel != nil {
+		l.cancel()
+	}
+}
+
+// Wait blocks until every goroutine started by Go has returned.
+// Go starts no more goroutines once Wait has been called.
+func (l *Lifecycle) Wait() {
+	l.lock.Lock()
+	l.waiting = true
+	l.lock.Unlock()
+	l.wg.Wait()
+}
@@ -0,0 +1,49 @@
+package gameserver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	var l Lifecycle
+	l.Start(context.Background())
+
+	stopped := make(chan struct{})
+	if !l.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	}) {
+		t.Fatal("Go refused a goroutine before Wait")
+	}
+	l.Stop()
+	l.Wait()
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("Wait returned before the goroutine")
+	}
+
+	if l.Go(func(context.Context) { t.Error("goroutine started after Wait") }) {
+		t.Error("Go started a goroutine after Wait")
+	}
+}
+
+func TestLifecycleGoDuringWait(t *testing.T) {
+	var l Lifecycle
+	l.Start(context.Background())
+	l.Go(func(ctx context.Context) { <-ctx.Done() })
+
+	// Go may be called concurrently with Wait, as when players join
+	// during shutdown; run with -race.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l.Go(func(context.Context) {})
+		}
+	}()
+	l.Stop()
+	l.Wait()
+	<-done
+}
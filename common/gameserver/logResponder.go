@@ -3,8 +3,6 @@ package gameserver
 import (
 	"log"
 	"net/http"
-
-	"github.com/gorilla/websocket"
 )
 
 type LogResponder[P any] struct{ Responder[P] }
@@ -13,13 +11,17 @@ func NewLogResponder[P any](r Responder[P]) LogResponder[P] {
 	return LogResponder[P]{r}
 }
 
-func (l LogResponder[P]) PlayerConnected(r *http.Request) {
-	log.Printf(" [%v] connected\n", r.RemoteAddr)
-	l.Responder.PlayerConnected(r)
+func (l LogResponder[P]) PlayerConnected(meta *ConnMeta, r *http.Request) {
+	log.Printf(" [%v] connected\n", meta.Addr())
+	l.Responder.PlayerConnected(meta, r)
+}
+func (l LogResponder[P]) PlayerUpgradeFail(meta *ConnMeta, r *http.Request, err error) {
+	log.Printf("*[%v] upgrade failed: %v\n", meta.Addr(), err)
+	l.Responder.PlayerUpgradeFail(meta, r, err)
 }
-func (l LogResponder[P]) PlayerUpgradeFail(r *http.Request, err error) {
-	log.Printf("*[%v] upgrade failed: %v\n", r.RemoteAddr, err)
-	l.Responder.PlayerUpgradeFail(r, err)
+
+func (l LogResponder[P]) MessageLimited(player *BinaryPlayer[P], action InboundAction, err error) {
+	messageLimited(l.Responder, player, action, err)
 }
 
 type Counter interface{ Count() uint }
@@ -41,12 +43,12 @@ func NewLogCountResponder[P LogNamer](r Responder[P], counter Counter) LogCountR
 	}
 }
 
-func (l LogCountResponder[P]) PlayerJoined(c *websocket.Conn, player *BinaryPlayer[P]) {
+func (l LogCountResponder[P]) PlayerJoined(c Conn, player *BinaryPlayer[P]) {
 	l.LogResponder.PlayerJoined(c, player)
-	log.Printf("+[%v] %v (%v now)\n", c.RemoteAddr(), player.Data.LogNameEnter(), l.counter.Count())
+	log.Printf("+[%v] %v (%v now)\n", player.Meta.Addr(), player.Data.LogNameEnter(), l.counter.Count())
 }
 
-func (l LogCountResponder[P]) PlayerLeft(c *websocket.Conn, player *BinaryPlayer[P]) {
+func (l LogCountResponder[P]) PlayerLeft(c Conn, player *BinaryPlayer[P]) {
 	l.LogResponder.PlayerLeft(c, player)
-	log.Printf("-[%v] %v (%v now)\n", c.RemoteAddr(), player.Data.LogNameLeave(), l.counter.Count())
+	log.Printf("-[%v] %v (%v now)\n", player.Meta.Addr(), player.Data.LogNameLeave(), l.counter.Count())
 }
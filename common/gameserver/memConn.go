@@ -0,0 +1,151 @@
+package gameserver
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Pipe makes a pair of connected in-memory Conns, for tests and simulations.
+// Each direction buffers up to bufSize messages before writes block.
+func Pipe(bufSize int) (Conn, Conn) {
+	ab, ba := make(chan Msg, bufSize), make(chan Msg, bufSize)
+	aDone, bDone := make(chan struct{}), make(chan struct{})
+	a := &memConn{in: ba, out: ab, done: aDone, peerDone: bDone, remote: "pipe:b"}
+	b := &memConn{in: ab, out: ba, done: bDone, peerDone: aDone, remote: "pipe:a"}
+	a.readDeadline.init()
+	a.writeDeadline.init()
+	b.readDeadline.init()
+	b.writeDeadline.init()
+	return &msgConn{frameTransport: a}, &msgConn{frameTransport: b}
+}
+
+// memAddr is the address of an in-memory connection.
+type memAddr string
+
+func (a memAddr) Network() string { return "pipe" }
+func (a memAddr) String() string  { return string(a) }
+
+// memConn is one end of a Pipe.
+type memConn struct {
+	in, out        chan Msg
+	done, peerDone chan struct{} // closed by Close of each end
+	closeOnce      sync.Once
+	remote         memAddr
+
+	readDeadline, writeDeadline memDeadline
+}
+
+func (c *memConn) readFrame(limit int64) (Msg, error) {
+	var m Msg
+	select {
+	case m = <-c.in:
+	case <-c.done:
+		return m, net.ErrClosed
+	case <-c.readDeadline.wait():
+		return m, os.ErrDeadlineExceeded
+	case <-c.peerDone:
+		// messages written before the peer closed are still delivered
+		select {
+		case m = <-c.in:
+		default:
+			return m, io.EOF
+		}
+	}
+	if limit > 0 && int64(len(m.Payload)) > limit {
+		return Msg{}, ErrReadLimit
+	}
+	return m, nil
+}
+
+func (c *memConn) writeFrame(m Msg, deadline time.Time) error {
+	select {
+	case <-c.done:
+		return net.ErrClosed
+	default:
+	}
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	m.Payload = append([]byte(nil), m.Payload...)
+	select {
+	case c.out <- m:
+		return nil
+	case <-c.done:
+		return net.ErrClosed
+	case <-c.peerDone:
+		return io.ErrClosedPipe
+	case <-c.writeDeadline.wait():
+		return os.ErrDeadlineExceeded
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *memConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *memConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *memConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+// memDeadline is a deadline of a memConn.
+type memDeadline struct {
+	lock    sync.Mutex
+	timer   *time.Timer
+	expired chan struct{} // closed when the deadline passes
+}
+
+func (d *memDeadline) init() {
+	d.expired = make(chan struct{})
+}
+
+// set sets the deadline. A zero t means no deadline.
+func (d *memDeadline) set(t time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.expired // wait for the timer to close expired
+	}
+	d.timer = nil
+
+	select {
+	case <-d.expired:
+		d.expired = make(chan struct{})
+	default:
+	}
+	if t.IsZero() {
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		expired := d.expired
+		d.timer = time.AfterFunc(dur, func() { close(expired) })
+	} else {
+		close(d.expired)
+	}
+}
+
+// wait returns a chan that is closed when the deadline passes.
+func (d *memDeadline) wait() <-chan struct{} {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.expired
+}
@@ -0,0 +1,64 @@
+package gameserver
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// ConnMeta is the metadata of a connection, which is given to
+// every Responder callback, and carried by the BinaryPlayer.
+type ConnMeta struct {
+	// ID identifies the connection in logs and the admin API.
+	ID uint64
+	// IP is the address of the client, which is forwarded by trusted proxies,
+	// or the zero Addr if the connection is not over IP.
+	IP netip.Addr
+	// RemoteAddr is the address of the peer, which may be a proxy.
+	RemoteAddr string
+	// UserAgent and Query are those of the HTTP request of a WebSocket.
+	UserAgent string
+	Query     url.Values
+	// Connected is when the connection was received.
+	Connected time.Time
+	// Traffic counts the messages and bytes of the connection.
+	Traffic *Traffic
+}
+
+// lastConnID is the last connection ID that was assigned.
+var lastConnID atomic.Uint64
+
+// newConnMeta makes the metadata of a connection with a new ID, received now.
+func newConnMeta(ip netip.Addr, remoteAddr net.Addr) *ConnMeta {
+	m := &ConnMeta{
+		ID:        lastConnID.Add(1),
+		IP:        ip,
+		Connected: time.Now(),
+		Traffic:   new(Traffic),
+	}
+	if remoteAddr != nil {
+		m.RemoteAddr = remoteAddr.String()
+	}
+	return m
+}
+
+// requestMeta makes the metadata of a WebSocket requested by r.
+func requestMeta(r *http.Request, proxies TrustedProxies) *ConnMeta {
+	m := newConnMeta(proxies.ClientIP(r), nil)
+	m.RemoteAddr = r.RemoteAddr
+	m.UserAgent = r.UserAgent()
+	m.Query = r.URL.Query()
+	return m
+}
+
+// Addr returns the address of the client for logging: its IP if it is known,
+// or else the address of the peer, such as "pipe".
+func (m *ConnMeta) Addr() string {
+	if m.IP.IsValid() {
+		return m.IP.String()
+	}
+	return m.RemoteAddr
+}
@@ -0,0 +1,125 @@
+package gameserver
+
+import (
+	"net/http"
+	"sync"
+
+	"victorz.ca/gameserv/common/metrics"
+)
+
+// MetricsResponder counts connections and traffic for a game,
+// and exports them as a metrics.Collector.
+type MetricsResponder[P any] struct {
+	Responder[P]
+	*metricsState[P]
+}
+
+// metricsState is the metrics of a MetricsResponder,
+// which are shared by the responders made by Wrap.
+type metricsState[P any] struct {
+	game string
+
+	connections metrics.Counter
+	accepted    metrics.Counter
+	rejected    metrics.Counter
+	limited     [InboundDisconnect + 1]metrics.Counter
+	disconnects [numReasons]metrics.Counter
+
+	players  map[*BinaryPlayer[P]]struct{}
+	departed struct{ msgsIn, bytesIn, msgsOut, bytesOut, overflows uint64 }
+	lock     sync.Mutex
+}
+
+// NewMetricsResponder makes a MetricsResponder for the named game.
+// r may be nil if the responder is chained with Wrap.
+func NewMetricsResponder[P any](r Responder[P], game string) *MetricsResponder[P] {
+	return &MetricsResponder[P]{
+		Responder: r,
+		metricsState: &metricsState[P]{
+			game:    game,
+			players: make(map[*BinaryPlayer[P]]struct{}),
+		},
+	}
+}
+
+func (m *MetricsResponder[P]) PlayerConnected(meta *ConnMeta, r *http.Request) {
+	m.connections.Inc()
+	m.Responder.PlayerConnected(meta, r)
+}
+
+func (m *MetricsResponder[P]) PlayerUpgradeFail(meta *ConnMeta, r *http.Request, err error) {
+	m.rejected.Inc()
+	m.Responder.PlayerUpgradeFail(meta, r, err)
+}
+
+func (m *MetricsResponder[P]) PlayerUpgradeSuccess(meta *ConnMeta, r *http.Request, c Conn) {
+	m.accepted.Inc()
+	m.Responder.PlayerUpgradeSuccess(meta, r, c)
+}
+
+func (m *MetricsResponder[P]) PlayerInitFail(meta *ConnMeta, c Conn, err error) {
+	m.disconnects[ReasonOf(err)].Inc()
+	m.Responder.PlayerInitFail(meta, c, err)
+}
+
+func (m *MetricsResponder[P]) PlayerJoined(c Conn, player *BinaryPlayer[P]) {
+	m.lock.Lock()
+	m.players[player] = struct{}{}
+	m.lock.Unlock()
+
+	m.Responder.PlayerJoined(c, player)
+}
+
+func (m *MetricsResponder[P]) PlayerLeft(c Conn, player *BinaryPlayer[P]) {
+	m.Responder.PlayerLeft(c, player)
+
+	// keep the traffic of departed players, so totals never decrease
+	m.disconnects[player.Reason()].Inc()
+	t := player.Traffic
+	m.lock.Lock()
+	delete(m.players, player)
+	m.departed.msgsIn += t.MsgsIn.Load()
+	m.departed.bytesIn += t.BytesIn.Load()
+	m.departed.msgsOut += t.MsgsOut.Load()
+	m.departed.bytesOut += t.BytesOut.Load()
+	m.departed.overflows += t.Overflows.Load()
+	m.lock.Unlock()
+}
+
+func (m *MetricsResponder[P]) MessageLimited(player *BinaryPlayer[P], action InboundAction, err error) {
+	m.limited[action].Inc()
+	messageLimited(m.Responder, player, action, err)
+}
+
+// Collect writes the metrics of the game.
+func (m *MetricsResponder[P]) Collect(w *metrics.Writer) {
+	m.lock.Lock()
+	n := len(m.players)
+	total := m.departed
+	for p := range m.players {
+		t := p.Traffic
+		total.msgsIn += t.MsgsIn.Load()
+		total.bytesIn += t.BytesIn.Load()
+		total.msgsOut += t.MsgsOut.Load()
+		total.bytesOut += t.BytesOut.Load()
+		total.overflows += t.Overflows.Load()
+	}
+	m.lock.Unlock()
+
+	g := m.game
+	w.Gauge("gameserv_players", "Number of connected players.", float64(n), "game", g)
+	w.Counter("gameserv_connections_total", "Connections received.", m.connections.Value(), "game", g)
+	w.Counter("gameserv_connections_accepted_total", "Connections upgraded to WebSockets.", m.accepted.Value(), "game", g)
+	w.Counter("gameserv_connections_rejected_total", "Connections that failed to upgrade.", m.rejected.Value(), "game", g)
+	w.Counter("gameserv_messages_received_total", "Messages received from players.", total.msgsIn, "game", g)
+	w.Counter("gameserv_bytes_received_total", "Bytes received from players.", total.bytesIn, "game", g)
+	w.Counter("gameserv_messages_sent_total", "Messages sent to players.", total.msgsOut, "game", g)
+	w.Counter("gameserv_bytes_sent_total", "Bytes sent to players.", total.bytesOut, "game", g)
+	w.Counter("gameserv_send_overflows_total", "Players disconnected because their send queue was full.", total.overflows, "game", g)
+	for _, a := range []InboundAction{InboundWarn, InboundDrop, InboundDisconnect} {
+		w.Counter("gameserv_messages_limited_total", "Messages that broke the inbound policy, by action taken.", m.limited[a].Value(), "game", g, "action", a.String())
+	}
+	for _, r := range AllReasons() {
+		w.Counter("gameserv_disconnects_total", "Connections closed by the server, by reason.", m.disconnects[r].Value(), "game", g, "reason", r.String())
+	}
+}
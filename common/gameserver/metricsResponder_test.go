@@ -0,0 +1,62 @@
+package gameserver
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"victorz.ca/gameserv/common/metrics"
+)
+
+func TestMetricsResponder(t *testing.T) {
+	g, r := newTestServer()
+	m := NewMetricsResponder[*testPlayer](r, "test")
+	g.Responder = m
+	var reg metrics.Registry
+	reg.Register(m)
+	// expect scrapes until every line is found, as the writer counts
+	// a message after the client may have read it
+	expect := func(when string, lines ...string) {
+		t.Helper()
+		var out string
+		for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+			res := httptest.NewRecorder()
+			reg.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+			out = res.Body.String()
+			missing := false
+			for _, line := range lines {
+				missing = missing || !strings.Contains(out, line+"\n")
+			}
+			if !missing {
+				return
+			}
+		}
+		t.Errorf("missing some of %q %s in:\n%s", lines, when, out)
+	}
+
+	c := serve(t, g, "alice")
+	p := recv(t, r.joined)
+	c.WriteMessage(BinaryMessage, []byte("hello"))
+	recv(t, r.received)
+	p.Send([]byte("hi"))
+	c.ReadMessage()
+	expect("while connected",
+		`gameserv_players{game="test"} 1`,
+		`gameserv_messages_received_total{game="test"} 1`,
+		`gameserv_bytes_received_total{game="test"} 5`,
+		`gameserv_messages_sent_total{game="test"} 1`,
+		`gameserv_bytes_sent_total{game="test"} 2`,
+	)
+
+	// the traffic of departed players is kept
+	g.Kick(p.Meta.ID)
+	recv(t, r.left)
+	expect("after leaving",
+		`gameserv_players{game="test"} 0`,
+		`gameserv_messages_received_total{game="test"} 1`,
+		`gameserv_bytes_sent_total{game="test"} 2`,
+		`gameserv_disconnects_total{game="test",reason="kicked"} 1`,
+		`gameserv_disconnects_total{game="test",reason="banned"} 0`,
+	)
+}
@@ -1,15 +1,19 @@
 package gameserver
 
 import (
+	"context"
 	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
-// Msg is a websocket message.
+// Msg is a message of a Conn.
 type Msg struct {
 	MsgType int
 	Payload []byte
+	// Prepared, if not nil, is the same message written to WebSocket connections
+	// instead of Payload, so that a message sent to many players is framed once.
+	Prepared *websocket.PreparedMessage
 }
 
 // Player represents a connected client.
@@ -17,37 +21,79 @@ type Player[D any] struct {
 	Data D
 	Stop chan struct{}
 
+	// Traffic is counted by the reader and writer of the connection.
+	Traffic *Traffic
+
 	recv     func(Msg)
 	sendBuf  chan Msg
-	stopOnce sync.Once
+	sendLock sync.Mutex
+	closed   bool
+	reason   CloseReason
 }
 
 // NewPlayer makes a Player with the embedded data, receive callback, and send buffer size.
 func NewPlayer[D any](data D, recv func(Msg), sendBufSize uint) Player[D] {
 	return Player[D]{
-		data,
-		make(chan struct{}),
+		Data: data,
+		Stop: make(chan struct{}),
+
+		Traffic: new(Traffic),
 
-		recv,
-		make(chan Msg, sendBufSize),
-		sync.Once{},
+		recv:    recv,
+		sendBuf: make(chan Msg, sendBufSize),
 	}
 }
 
 // Send enqueues an outgoing message, or
 // on failure, closes the Player.
+// Messages sent after the Player is closed are dropped.
 func (p *Player[D]) Send(msg Msg) {
+	p.sendLock.Lock()
+	defer p.sendLock.Unlock()
+
+	if p.closed {
+		return
+	}
+
 	select {
 	case p.sendBuf <- msg:
 	default:
 		// queue overflow
-		p.Close()
+		p.Traffic.Overflows.Add(1)
+		p.closeLocked(ReasonOverloaded)
 	}
 }
 
 // Close marks the player as "stopped" by closing the send and stop channels.
-// Close must not be called multiple times.
+// It is safe to call Close multiple times.
 func (p *Player[D]) Close() {
+	p.sendLock.Lock()
+	defer p.sendLock.Unlock()
+	p.closeLocked(0)
+}
+
+// Disconnect closes the Player like Close, but the connection is
+// closed with a close frame for the reason, after queued messages are sent.
+func (p *Player[D]) Disconnect(reason CloseReason) {
+	p.sendLock.Lock()
+	defer p.sendLock.Unlock()
+	p.closeLocked(reason)
+}
+
+// Reason returns why the server disconnected the Player,
+// or zero if it did not.
+func (p *Player[D]) Reason() CloseReason {
+	p.sendLock.Lock()
+	defer p.sendLock.Unlock()
+	return p.reason
+}
+
+func (p *Player[D]) closeLocked(reason CloseReason) {
+	if p.closed {
+		return
+	}
+	p.closed = true
+	p.reason = reason
 	close(p.Stop)
 	close(p.sendBuf)
 }
@@ -57,18 +103,32 @@ func (p *Player[D]) Close() {
 type BinaryPlayer[D any] struct {
 	Player[D]
 
+	// Meta describes the connection of the player.
+	Meta *ConnMeta
+
 	Recv func([]byte)
+
+	ctx context.Context
 }
 
-// NewBinaryPlayer makes a BinaryPlayer.
-func NewBinaryPlayer[D any](data D, recv func([]byte), sendBufSize uint) *BinaryPlayer[D] {
-	var p BinaryPlayer[D]
+// NewBinaryPlayer makes a BinaryPlayer for the connection described by meta,
+// which counts its traffic in meta.Traffic.
+// Its context is done when ctx is done.
+func NewBinaryPlayer[D any](ctx context.Context, meta *ConnMeta, data D, recv func([]byte), sendBufSize uint) *BinaryPlayer[D] {
+	p := BinaryPlayer[D]{Meta: meta, ctx: ctx}
 	p.Recv = recv
 	p.Player = NewPlayer(data, func(m Msg) { p.Recv(m.Payload) }, sendBufSize)
+	p.Traffic = meta.Traffic
 	return &p
 }
 
-// Send sends the byte slice as a binary message over the websocket.
+// Context returns the context of the connection,
+// which is done when the connection closes, before PlayerLeft.
+func (p *BinaryPlayer[D]) Context() context.Context {
+	return p.ctx
+}
+
+// Send sends the byte slice as a binary message over the connection.
 func (p *BinaryPlayer[D]) Send(b []byte) {
-	p.Player.Send(Msg{websocket.BinaryMessage, b})
+	p.Player.Send(Msg{MsgType: BinaryMessage, Payload: b})
 }
@@ -0,0 +1,142 @@
+package gameserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Forwarding headers, which reverse proxies set to the address of the client
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded" // RFC 7239
+	HeaderXRealIP       = "X-Real-Ip"
+)
+
+// TrustedProxies are the addresses of reverse proxies, such as nginx,
+// and the forwarding header that they set.
+type TrustedProxies struct {
+	Prefixes []netip.Prefix
+	// Header is the forwarding header of the proxies, one of the Header constants,
+	// or X-Forwarded-For if it is empty. Only that header is read: the proxies
+	// may pass other forwarding headers from clients unchanged.
+	Header string
+}
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR ranges
+// separated by commas or spaces, and the name of the forwarding header
+// that the proxies set, which is X-Forwarded-For if it is empty.
+func ParseTrustedProxies(s, header string) (TrustedProxies, error) {
+	t := TrustedProxies{Header: http.CanonicalHeaderKey(strings.TrimSpace(header))}
+	switch t.Header {
+	case "", HeaderXForwardedFor, HeaderForwarded, HeaderXRealIP:
+	default:
+		return TrustedProxies{}, fmt.Errorf("gameserver: unknown forwarding header %q", header)
+	}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if strings.Contains(f, "/") {
+			p, err := netip.ParsePrefix(f)
+			if err != nil {
+				return TrustedProxies{}, err
+			}
+			t.Prefixes = append(t.Prefixes, p.Masked())
+		} else {
+			ip, err := netip.ParseAddr(f)
+			if err != nil {
+				return TrustedProxies{}, err
+			}
+			ip = ip.Unmap()
+			t.Prefixes = append(t.Prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+		}
+	}
+	return t, nil
+}
+
+// Trusted returns whether ip is a trusted proxy.
+func (t TrustedProxies) Trusted(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range t.Prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client that made r.
+// If r comes from a trusted proxy, it is the address forwarded by the
+// Header of the proxies: the last address of the chain that is not
+// a trusted proxy. Otherwise, or if the header is missing, it is
+// the address of the peer.
+func (t TrustedProxies) ClientIP(r *http.Request) netip.Addr {
+	ip := remoteIP(r)
+	if !t.Trusted(ip) {
+		return ip
+	}
+	switch http.CanonicalHeaderKey(t.Header) {
+	case HeaderForwarded:
+		return t.walk(ip, forwardedFor(r.Header.Values(HeaderForwarded)))
+	case HeaderXRealIP:
+		if real, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(HeaderXRealIP))); err == nil {
+			return real.Unmap()
+		}
+		return ip
+	default:
+		return t.walk(ip, splitList(r.Header.Values(HeaderXForwardedFor)))
+	}
+}
+
+// walk goes through the chain of forwarded addresses from the proxy at ip,
+// from the nearest hop, and returns the first address that is not trusted.
+// It stops at an address that is not valid, such as "unknown".
+func (t TrustedProxies) walk(ip netip.Addr, chain []string) netip.Addr {
+	for i := len(chain) - 1; i >= 0 && t.Trusted(ip); i-- {
+		hop, ok := parseHop(chain[i])
+		if !ok {
+			break
+		}
+		ip = hop
+	}
+	return ip
+}
+
+// splitList splits the values of a comma-separated header.
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, e := range strings.Split(v, ",") {
+			list = append(list, strings.TrimSpace(e))
+		}
+	}
+	return list
+}
+
+// forwardedFor returns the for parameters of the elements of
+// Forwarded headers (RFC 7239), such as `for=192.0.2.60;proto=http`.
+// Elements without one are "unknown".
+func forwardedFor(values []string) []string {
+	var list []string
+	for _, elem := range splitList(values) {
+		node := "unknown"
+		for _, pair := range strings.Split(elem, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if strings.EqualFold(k, "for") {
+				node = strings.Trim(v, `"`)
+			}
+		}
+		list = append(list, node)
+	}
+	return list
+}
+
+// parseHop parses a forwarded address, which may have a port,
+// and may be an IPv6 address in brackets.
+func parseHop(s string) (netip.Addr, bool) {
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	ip, err := netip.ParseAddr(s)
+	return ip.Unmap(), err == nil
+}
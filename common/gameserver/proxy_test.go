@@ -0,0 +1,146 @@
+package gameserver
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+// allHeaders forwards a different address in each forwarding header.
+var allHeaders = http.Header{
+	"Forwarded":       {"for=198.51.100.1"},
+	"X-Forwarded-For": {"198.51.100.2"},
+	"X-Real-Ip":       {"198.51.100.3"},
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 2001:db8:ffff::1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		use    string // the header of the proxies
+		name   string
+		peer   string
+		header http.Header
+		want   string
+	}{
+		{"", "no proxy", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"", "spoofed X-Forwarded-For from untrusted peer", "203.0.113.5:1234",
+			http.Header{"X-Forwarded-For": {"198.51.100.7"}}, "203.0.113.5"},
+		{HeaderForwarded, "spoofed Forwarded from untrusted peer", "203.0.113.5:1234",
+			http.Header{"Forwarded": {"for=198.51.100.7"}}, "203.0.113.5"},
+		{HeaderXRealIP, "spoofed X-Real-IP from untrusted peer", "203.0.113.5:1234",
+			http.Header{"X-Real-Ip": {"198.51.100.7"}}, "203.0.113.5"},
+		{"", "trusted proxy without header", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"", "one hop", "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"198.51.100.7"}}, "198.51.100.7"},
+		{"", "two trusted hops", "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"198.51.100.7, 10.0.0.2"}}, "198.51.100.7"},
+		{"", "spoofed hop left of the client", "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"192.0.2.1, 198.51.100.7, 10.0.0.2"}}, "198.51.100.7"},
+		{"", "trusted hop left of an untrusted hop", "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"10.0.0.3, 198.51.100.7, 10.0.0.2"}}, "198.51.100.7"},
+		{"", "only trusted hops", "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"", "X-Forwarded-For over several lines", "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"198.51.100.7", "10.0.0.2"}}, "198.51.100.7"},
+		{"", "IPv4-mapped trusted peer", "[::ffff:10.0.0.1]:1234",
+			http.Header{"X-Forwarded-For": {"198.51.100.7"}}, "198.51.100.7"},
+		{"", "IPv6 trusted peer", "[2001:db8:ffff::1]:1234",
+			http.Header{"X-Forwarded-For": {"2001:db8::7"}}, "2001:db8::7"},
+
+		{HeaderForwarded, "Forwarded", "10.0.0.1:1234",
+			http.Header{"Forwarded": {"for=198.51.100.7;proto=https"}}, "198.51.100.7"},
+		{HeaderForwarded, "Forwarded with case and spaces", "10.0.0.1:1234",
+			http.Header{"Forwarded": {"by=10.0.0.1; For=198.51.100.7"}}, "198.51.100.7"},
+		{HeaderForwarded, "Forwarded IPv4 with port", "10.0.0.1:1234",
+			http.Header{"Forwarded": {`for="198.51.100.7:4711"`}}, "198.51.100.7"},
+		{HeaderForwarded, "Forwarded IPv6 with port", "10.0.0.1:1234",
+			http.Header{"Forwarded": {`for="[2001:db8:cafe::17]:4711"`}}, "2001:db8:cafe::17"},
+		{HeaderForwarded, "Forwarded bracketed IPv6", "10.0.0.1:1234",
+			http.Header{"Forwarded": {`for="[2001:db8:cafe::17]"`}}, "2001:db8:cafe::17"},
+		{HeaderForwarded, "Forwarded chain", "10.0.0.1:1234",
+			http.Header{"Forwarded": {"for=192.0.2.1, for=198.51.100.7", "for=10.0.0.2"}}, "198.51.100.7"},
+		{HeaderForwarded, "Forwarded unknown", "10.0.0.1:1234",
+			http.Header{"Forwarded": {"for=unknown"}}, "10.0.0.1"},
+		{HeaderForwarded, "Forwarded unknown nearest hop", "10.0.0.1:1234",
+			http.Header{"Forwarded": {"for=198.51.100.7, for=unknown"}}, "10.0.0.1"},
+		{HeaderForwarded, "Forwarded unknown after trusted hop", "10.0.0.1:1234",
+			http.Header{"Forwarded": {"for=unknown, for=10.0.0.2"}}, "10.0.0.2"},
+		{HeaderForwarded, "Forwarded obfuscated identifier", "10.0.0.1:1234",
+			http.Header{"Forwarded": {"for=_hidden"}}, "10.0.0.1"},
+		{HeaderForwarded, "Forwarded obfuscated port", "10.0.0.1:1234",
+			http.Header{"Forwarded": {`for="198.51.100.7:_port"`}}, "10.0.0.1"},
+		{HeaderForwarded, "Forwarded element without for", "10.0.0.1:1234",
+			http.Header{"Forwarded": {"proto=https"}}, "10.0.0.1"},
+
+		{HeaderXRealIP, "X-Real-IP", "10.0.0.1:1234",
+			http.Header{"X-Real-Ip": {" 198.51.100.7 "}}, "198.51.100.7"},
+		{HeaderXRealIP, "invalid X-Real-IP", "10.0.0.1:1234",
+			http.Header{"X-Real-Ip": {"unknown"}}, "10.0.0.1"},
+
+		// only the header of the proxies is read
+		{"", "X-Forwarded-For only", "10.0.0.1:1234", allHeaders, "198.51.100.2"},
+		{HeaderForwarded, "Forwarded only", "10.0.0.1:1234", allHeaders, "198.51.100.1"},
+		{HeaderXRealIP, "X-Real-IP only", "10.0.0.1:1234", allHeaders, "198.51.100.3"},
+		{"", "Forwarded without X-Forwarded-For", "10.0.0.1:1234",
+			http.Header{"Forwarded": {"for=198.51.100.1"}}, "10.0.0.1"},
+		{HeaderForwarded, "X-Forwarded-For without Forwarded", "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"198.51.100.2"}}, "10.0.0.1"},
+		{HeaderXRealIP, "X-Forwarded-For without X-Real-IP", "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"198.51.100.2"}}, "10.0.0.1"},
+		{"x-real-ip", "header of any case", "10.0.0.1:1234", allHeaders, "198.51.100.3"},
+	}
+	for _, tt := range tests {
+		r := &http.Request{RemoteAddr: tt.peer, Header: tt.header}
+		proxies.Header = tt.use
+		if got := proxies.ClientIP(r); got != netip.MustParseAddr(tt.want) {
+			t.Errorf("%s: ClientIP = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.1.2.3/8 192.0.2.1,::ffff:192.0.2.2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{
+		"10.255.0.1":       true,
+		"11.0.0.1":         false,
+		"192.0.2.1":        true,
+		"::ffff:192.0.2.1": true,
+		"192.0.2.2":        true,
+		"192.0.2.3":        false,
+	} {
+		if got := proxies.Trusted(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Trusted(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	for _, s := range []string{"10.0.0.0/33", "example.com"} {
+		if _, err := ParseTrustedProxies(s, ""); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded", s)
+		}
+	}
+}
+
+func TestParseTrustedProxyHeader(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                  "",
+		"X-Forwarded-For":   HeaderXForwardedFor,
+		"forwarded":         HeaderForwarded,
+		" X-REAL-IP ":       HeaderXRealIP,
+		"X-Client-IP":       "",
+		"True-Client-IP":    "",
+		"X-Forwarded-Host":  "",
+		"X-Forwarded-For, ": "",
+	} {
+		proxies, err := ParseTrustedProxies("10.0.0.1", header)
+		if valid := want != "" || header == ""; (err == nil) != valid {
+			t.Errorf("ParseTrustedProxies header %q: error %v, want valid %v", header, err, valid)
+		} else if proxies.Header != want {
+			t.Errorf("ParseTrustedProxies header %q = %q, want %q", header, proxies.Header, want)
+		}
+	}
+}
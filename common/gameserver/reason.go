@@ -0,0 +1,117 @@
+package gameserver
+
+import (
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseReason is why the server closes a connection.
+// It is sent to the client as the close code and text of the close frame.
+// A CloseReason may be used as an error.
+type CloseReason int
+
+// Close reasons
+const (
+	ReasonServerFull CloseReason = iota + 1
+	ReasonBanned
+	ReasonProtocolError
+	ReasonKicked
+	ReasonIdle
+	ReasonHandshakeTimeout
+	ReasonShuttingDown
+	ReasonOverloaded
+	ReasonMessageRate
+	ReasonMessageTooBig
+	ReasonSessionExpired
+	ReasonUnsupportedVersion
+)
+
+const numReasons = ReasonUnsupportedVersion + 1
+
+// Application-specific close codes
+const (
+	CloseServerFull         = 4000
+	CloseBanned             = 4003
+	CloseKicked             = 4004
+	CloseIdle               = 4008
+	CloseHandshakeTimeout   = 4009
+	CloseSessionExpired     = 4010
+	CloseUnsupportedVersion = 4011
+)
+
+var reasons = [numReasons]struct {
+	code       int
+	text, name string
+}{
+	ReasonServerFull:         {CloseServerFull, "server is full", "server_full"},
+	ReasonBanned:             {CloseBanned, "banned", "banned"},
+	ReasonProtocolError:      {websocket.CloseProtocolError, "protocol error", "protocol_error"},
+	ReasonKicked:             {CloseKicked, "kicked", "kicked"},
+	ReasonIdle:               {CloseIdle, "idle timeout", "idle"},
+	ReasonHandshakeTimeout:   {CloseHandshakeTimeout, "handshake timeout", "handshake_timeout"},
+	ReasonShuttingDown:       {websocket.CloseServiceRestart, "server is restarting", "shutting_down"},
+	ReasonOverloaded:         {websocket.CloseTryAgainLater, "too slow to receive messages", "overloaded"},
+	ReasonMessageRate:        {websocket.ClosePolicyViolation, "message rate exceeded", "message_rate"},
+	ReasonMessageTooBig:      {websocket.CloseMessageTooBig, "message too big", "message_too_big"},
+	ReasonSessionExpired:     {CloseSessionExpired, "session expired", "session_expired"},
+	ReasonUnsupportedVersion: {CloseUnsupportedVersion, "unsupported protocol version", "unsupported_version"},
+}
+
+// AllReasons lists every CloseReason.
+func AllReasons() []CloseReason {
+	all := make([]CloseReason, 0, numReasons-1)
+	for r := ReasonServerFull; r < numReasons; r++ {
+		all = append(all, r)
+	}
+	return all
+}
+
+func (r CloseReason) valid() bool { return r > 0 && r < numReasons }
+
+// Code returns the WebSocket close code.
+func (r CloseReason) Code() int {
+	if !r.valid() {
+		return websocket.CloseNormalClosure
+	}
+	return reasons[r].code
+}
+
+// Text returns the text sent in the close frame.
+func (r CloseReason) Text() string {
+	if !r.valid() {
+		return ""
+	}
+	return reasons[r].text
+}
+
+// String returns a short name, suitable for metrics and logs.
+func (r CloseReason) String() string {
+	if !r.valid() {
+		return "none"
+	}
+	return reasons[r].name
+}
+
+// Error returns the text of the reason.
+func (r CloseReason) Error() string { return r.Text() }
+
+// Resumable returns whether a player disconnected for the reason may resume
+// its session: the connection was lost, rather than closed by the server.
+func (r CloseReason) Resumable() bool {
+	return r == 0 || r == ReasonIdle || r == ReasonOverloaded
+}
+
+// closeMessage returns the payload of the close frame.
+func (r CloseReason) closeMessage() []byte {
+	return websocket.FormatCloseMessage(r.Code(), r.Text())
+}
+
+// ReasonOf returns the CloseReason in the chain of err, or zero if there is none.
+func ReasonOf(err error) CloseReason {
+	var r CloseReason
+	if errors.As(err, &r) {
+		return r
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package gameserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCloseReason(t *testing.T) {
+	tests := []struct {
+		r          CloseReason
+		code       int
+		text, name string
+		resumable  bool
+	}{
+		{0, websocket.CloseNormalClosure, "", "none", true},
+		{ReasonServerFull, CloseServerFull, "server is full", "server_full", false},
+		{ReasonBanned, CloseBanned, "banned", "banned", false},
+		{ReasonProtocolError, websocket.CloseProtocolError, "protocol error", "protocol_error", false},
+		{ReasonKicked, CloseKicked, "kicked", "kicked", false},
+		{ReasonIdle, CloseIdle, "idle timeout", "idle", true},
+		{ReasonHandshakeTimeout, CloseHandshakeTimeout, "handshake timeout", "handshake_timeout", false},
+		{ReasonShuttingDown, websocket.CloseServiceRestart, "server is restarting", "shutting_down", false},
+		{ReasonOverloaded, websocket.CloseTryAgainLater, "too slow to receive messages", "overloaded", true},
+		{ReasonMessageRate, websocket.ClosePolicyViolation, "message rate exceeded", "message_rate", false},
+		{ReasonMessageTooBig, websocket.CloseMessageTooBig, "message too big", "message_too_big", false},
+		{ReasonSessionExpired, CloseSessionExpired, "session expired", "session_expired", false},
+		{ReasonUnsupportedVersion, CloseUnsupportedVersion, "unsupported protocol version", "unsupported_version", false},
+		{numReasons, websocket.CloseNormalClosure, "", "none", false},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Code(); got != tt.code {
+			t.Errorf("%v.Code() = %d, want %d", tt.name, got, tt.code)
+		}
+		if got := tt.r.Text(); got != tt.text {
+			t.Errorf("%v.Text() = %q, want %q", tt.name, got, tt.text)
+		}
+		if got := tt.r.String(); got != tt.name {
+			t.Errorf("String() = %q, want %q", got, tt.name)
+		}
+		if got := tt.r.Resumable(); got != tt.resumable {
+			t.Errorf("%v.Resumable() = %v, want %v", tt.name, got, tt.resumable)
+		}
+		if msg, want := tt.r.closeMessage(), websocket.FormatCloseMessage(tt.code, tt.text); string(msg) != string(want) {
+			t.Errorf("%v.closeMessage() = %q, want %q", tt.name, msg, want)
+		}
+	}
+	if n := len(AllReasons()); n != len(tests)-2 {
+		t.Errorf("AllReasons() has %d reasons, want %d", n, len(tests)-2)
+	}
+}
+
+func TestReasonOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want CloseReason
+	}{
+		{nil, 0},
+		{io.EOF, 0},
+		{ReasonKicked, ReasonKicked},
+		{fmt.Errorf("hello: %w", ReasonUnsupportedVersion), ReasonUnsupportedVersion},
+		{&BanError{Ban{Reason: "cheating"}}, ReasonBanned},
+		{fmt.Errorf("join: %w", &BanError{}), ReasonBanned},
+		{ErrDraining, ReasonShuttingDown},
+		{ErrMessageRate, ReasonMessageRate},
+		{errors.Join(io.EOF, ReasonIdle), ReasonIdle},
+	}
+	for _, tt := range tests {
+		if got := ReasonOf(tt.err); got != tt.want {
+			t.Errorf("ReasonOf(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package gameserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Game is a game server that a Registry serves over HTTP.
+type Game interface {
+	// Name identifies the game in paths, logs and configuration, such as "duel".
+	Name() string
+	// HandlePlayer serves a player connecting over a WebSocket.
+	HandlePlayer(w http.ResponseWriter, r *http.Request)
+
+	// Start runs the game until ctx is cancelled or Stop is called.
+	Start(ctx context.Context)
+	// Shutdown drains the game, and waits for its players to leave until ctx is done.
+	Shutdown(ctx context.Context) error
+	// Stop stops the game, and Wait waits for it to stop.
+	Stop()
+	Wait()
+
+	// Count returns the number of players.
+	Count() uint
+	// IsDraining returns whether the game has started shutting down.
+	IsDraining() bool
+	// Stats returns statistics specific to the game, which are encoded as JSON.
+	Stats() any
+}
+
+// Mounter is implemented by a Game that serves more than the handlers
+// mounted by the Registry.
+type Mounter interface {
+	// Mount registers the handlers of the game under prefix, such as "/duel".
+	Mount(mux *http.ServeMux, prefix string)
+}
+
+// GameStatus is the status of a game, served at /{name}/status.
+type GameStatus struct {
+	Name     string `json:"name"`
+	Players  uint   `json:"players"`
+	Draining bool   `json:"draining"`
+	Stats    any    `json:"stats,omitempty"`
+}
+
+// Status returns the status of g.
+func Status(g Game) GameStatus {
+	return GameStatus{
+		Name:     g.Name(),
+		Players:  g.Count(),
+		Draining: g.IsDraining(),
+		Stats:    g.Stats(),
+	}
+}
+
+type registered struct {
+	Game
+	paths []string
+}
+
+// Registry is a set of games served together.
+type Registry struct {
+	games []registered
+}
+
+// Register adds a game, which is served at /{name}, and also at /{alias}
+// for each of aliases. It panics if the game is already registered.
+func (r *Registry) Register(g Game, aliases ...string) {
+	if r.Lookup(g.Name()) != nil {
+		panic("gameserver: game registered twice: " + g.Name())
+	}
+	r.games = append(r.games, registered{g, append([]string{g.Name()}, aliases...)})
+}
+
+// Games returns the registered games, in the order they were registered.
+func (r *Registry) Games() []Game {
+	games := make([]Game, len(r.games))
+	for i, g := range r.games {
+		games[i] = g.Game
+	}
+	return games
+}
+
+// Lookup returns the game with a name, or nil.
+func (r *Registry) Lookup(name string) Game {
+	for _, g := range r.games {
+		if g.Name() == name {
+			return g.Game
+		}
+	}
+	return nil
+}
+
+// Mount registers the handlers of every game on mux, at each of its paths:
+//
+//   - /{name} serves players with HandlePlayer;
+//   - /{name}/n writes the number of players;
+//   - /{name}/status writes the GameStatus as JSON;
+//
+// and the handlers of games that are Mounters.
+func (r *Registry) Mount(mux *http.ServeMux) {
+	for _, rg := range r.games {
+		g := rg.Game
+		for _, p := range rg.paths {
+			prefix := "/" + p
+			mux.HandleFunc(prefix, g.HandlePlayer)
+			mux.HandleFunc(prefix+"/n", func(w http.ResponseWriter, req *http.Request) {
+				fmt.Fprintf(w, "%v", g.Count())
+			})
+			mux.HandleFunc(prefix+"/status", func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(Status(g))
+			})
+			if m, ok := g.(Mounter); ok {
+				m.Mount(mux, prefix)
+			}
+		}
+	}
+}
+
+// Start starts every game.
+func (r *Registry) Start(ctx context.Context) {
+	for _, g := range r.games {
+		g.Start(ctx)
+	}
+}
+
+// Shutdown drains every game at once, and returns the errors of the games
+// whose players did not leave before ctx was done.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	errs := make([]error, len(r.games))
+	var wg sync.WaitGroup
+	for i, g := range r.games {
+		wg.Add(1)
+		go func(i int, g Game) {
+			defer wg.Done()
+			if err := g.Shutdown(ctx); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", g.Name(), err)
+			}
+		}(i, g.Game)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Stop stops every game, then waits for them to stop.
+func (r *Registry) Stop() {
+	for _, g := range r.games {
+		g.Stop()
+	}
+	for _, g := range r.games {
+		g.Wait()
+	}
+}
@@ -0,0 +1,151 @@
+package gameserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGame is a Game that records its lifecycle.
+type fakeGame struct {
+	name     string
+	players  uint
+	draining bool
+	err      error // returned by Shutdown
+
+	lock   sync.Mutex
+	events []string
+}
+
+func (g *fakeGame) record(e string) {
+	g.lock.Lock()
+	g.events = append(g.events, e)
+	g.lock.Unlock()
+}
+
+func (g *fakeGame) Name() string { return g.name }
+func (g *fakeGame) HandlePlayer(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("play " + g.name))
+}
+func (g *fakeGame) Start(ctx context.Context) { g.record("start") }
+func (g *fakeGame) Shutdown(ctx context.Context) error {
+	g.record("shutdown")
+	return g.err
+}
+func (g *fakeGame) Stop()            { g.record("stop") }
+func (g *fakeGame) Wait()            { g.record("wait") }
+func (g *fakeGame) Count() uint      { return g.players }
+func (g *fakeGame) IsDraining() bool { return g.draining }
+func (g *fakeGame) Stats() any       { return map[string]int{"matches": 2} }
+
+// mountingGame is a fakeGame that serves more handlers.
+type mountingGame struct{ *fakeGame }
+
+func (g mountingGame) Mount(mux *http.ServeMux, prefix string) {
+	mux.HandleFunc(prefix+"/replays", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("replays at " + prefix))
+	})
+}
+
+func TestRegistryRegister(t *testing.T) {
+	var r Registry
+	a, b := &fakeGame{name: "a"}, &fakeGame{name: "b"}
+	r.Register(a)
+	r.Register(b, "bb")
+	if games := r.Games(); !reflect.DeepEqual(games, []Game{a, b}) {
+		t.Errorf("Games() = %v, want [a b]", games)
+	}
+	if r.Lookup("b") != b || r.Lookup("bb") != nil || r.Lookup("c") != nil {
+		t.Error("Lookup does not find games by name")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	r.Register(&fakeGame{name: "a"})
+}
+
+func TestRegistryMount(t *testing.T) {
+	var r Registry
+	r.Register(&fakeGame{name: "duel", players: 3}, "d")
+	r.Register(mountingGame{&fakeGame{name: "slime", draining: true}})
+	mux := http.NewServeMux()
+	r.Mount(mux)
+
+	for path, want := range map[string]string{
+		"/duel":          "play duel",
+		"/d":             "play duel",
+		"/duel/n":        "3",
+		"/d/n":           "3",
+		"/slime":         "play slime",
+		"/slime/n":       "0",
+		"/slime/replays": "replays at /slime",
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("GET %s = %d %q, want %q", path, w.Code, w.Body, want)
+		}
+	}
+
+	for path, want := range map[string]GameStatus{
+		"/d/status":     {Name: "duel", Players: 3},
+		"/slime/status": {Name: "slime", Draining: true},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("GET %s: Content-Type %q", path, ct)
+		}
+		var got GameStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		if got.Stats == nil {
+			t.Errorf("GET %s: no stats", path)
+		}
+		got.Stats = nil
+		if got != want {
+			t.Errorf("GET %s = %+v, want %+v", path, got, want)
+		}
+	}
+}
+
+func TestRegistryLifecycle(t *testing.T) {
+	var r Registry
+	errSlow := errors.New("players still connected")
+	a, b, c := &fakeGame{name: "a"}, &fakeGame{name: "b", err: errSlow}, &fakeGame{name: "c", err: context.DeadlineExceeded}
+	r.Register(a)
+	r.Register(b)
+	r.Register(c)
+
+	r.Start(context.Background())
+	err := r.Shutdown(context.Background())
+	// the errors of every game are joined
+	if !errors.Is(err, errSlow) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() = %v, want the errors of b and c", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "b: "+errSlow.Error()) || !strings.Contains(msg, "c: ") || strings.Contains(msg, "a: ") {
+		t.Errorf("Shutdown() = %q, want errors named after b and c", msg)
+	}
+	r.Stop()
+
+	for _, g := range []*fakeGame{a, b, c} {
+		if want := []string{"start", "shutdown", "stop", "wait"}; !reflect.DeepEqual(g.events, want) {
+			t.Errorf("game %s: %v, want %v", g.name, g.events, want)
+		}
+	}
+
+	var empty Registry
+	if err := empty.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown of no games = %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package gameserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ResumeToken lets a player that lost its connection resume its session.
+type ResumeToken [16]byte
+
+// NewResumeToken makes a random ResumeToken.
+func NewResumeToken() ResumeToken {
+	var t ResumeToken
+	if _, err := rand.Read(t[:]); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// String returns the token in hex, as sent in resume messages.
+func (t ResumeToken) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// ResumeMessage returns the token of a resume message.
+// A client resumes its session by sending its token as a text message
+// instead of the hello message.
+func ResumeMessage(mt int, msg []byte) (t ResumeToken, ok bool) {
+	if mt != TextMessage || hex.DecodedLen(len(msg)) != len(t) {
+		return
+	}
+	_, err := hex.Decode(t[:], msg)
+	return t, err == nil
+}
+
+// Sessions keeps the sessions of disconnected players until they
+// resume or their grace period ends.
+type Sessions[T any] struct {
+	// Grace is how long a session is kept. Zero disables resuming.
+	Grace time.Duration
+
+	parked map[ResumeToken]*parkedSession[T]
+	lock   sync.Mutex
+}
+
+type parkedSession[T any] struct {
+	session T
+	timer   *time.Timer
+}
+
+// Park keeps a session until it is resumed with token.
+// If it is not resumed within the grace period, expire is called.
+func (s *Sessions[T]) Park(token ResumeToken, session T, expire func(T)) {
+	p := &parkedSession[T]{session: session}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.parked == nil {
+		s.parked = make(map[ResumeToken]*parkedSession[T])
+	}
+	s.parked[token] = p
+	p.timer = time.AfterFunc(s.Grace, func() {
+		s.lock.Lock()
+		current := s.parked[token] == p
+		if current {
+			delete(s.parked, token)
+		}
+		s.lock.Unlock()
+
+		if current {
+			expire(session)
+		}
+	})
+}
+
+// Resume removes and returns the session parked with token.
+func (s *Sessions[T]) Resume(token ResumeToken) (session T, ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p, ok := s.parked[token]
+	if !ok {
+		return
+	}
+	p.timer.Stop()
+	delete(s.parked, token)
+	return p.session, true
+}
+
+// Len returns the number of parked sessions.
+func (s *Sessions[T]) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.parked)
+}
@@ -0,0 +1,64 @@
+package gameserver
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	s := Sessions[string]{Grace: time.Second}
+	token := NewResumeToken()
+	s.Park(token, "alice", func(string) { t.Error("resumed session expired") })
+
+	if _, ok := s.Resume(NewResumeToken()); ok {
+		t.Error("resumed with a wrong token")
+	}
+	if got, ok := s.Resume(token); !ok || got != "alice" {
+		t.Errorf("Resume = %q, %v, want alice", got, ok)
+	}
+	if _, ok := s.Resume(token); ok {
+		t.Error("resumed twice with a token")
+	}
+	if s.Len() != 0 {
+		t.Errorf("%d sessions parked", s.Len())
+	}
+}
+
+func TestSessionsExpire(t *testing.T) {
+	s := Sessions[string]{Grace: 10 * time.Millisecond}
+	token := NewResumeToken()
+	expired := make(chan string, 1)
+	s.Park(token, "alice", func(session string) { expired <- session })
+
+	if got := recv(t, expired); got != "alice" {
+		t.Errorf("expired %q, want alice", got)
+	}
+	if _, ok := s.Resume(token); ok {
+		t.Error("resumed an expired session")
+	}
+	if s.Len() != 0 {
+		t.Errorf("%d sessions parked", s.Len())
+	}
+}
+
+func TestResumeMessage(t *testing.T) {
+	token := NewResumeToken()
+	if got, ok := ResumeMessage(TextMessage, []byte(token.String())); !ok || got != token {
+		t.Errorf("ResumeMessage(%s) = %v, %v", token, got, ok)
+	}
+	for _, tt := range []struct {
+		mt  int
+		msg string
+	}{
+		{BinaryMessage, token.String()},
+		{TextMessage, token.String()[2:]},
+		{TextMessage, token.String() + "00"},
+		{TextMessage, strings.Repeat("zz", 16)},
+		{TextMessage, ""},
+	} {
+		if _, ok := ResumeMessage(tt.mt, []byte(tt.msg)); ok {
+			t.Errorf("ResumeMessage(%d, %q) accepted", tt.mt, tt.msg)
+		}
+	}
+}
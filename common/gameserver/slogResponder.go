@@ -0,0 +1,136 @@
+package gameserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Event types of records logged by SlogResponder.
+const (
+	EventConnected   = "connected"
+	EventUpgradeFail = "upgrade_fail"
+	EventInitFail    = "init_fail"
+	EventJoined      = "joined"
+	EventLeft        = "left"
+
+	EventLimitWarn       = "limit_warn"
+	EventLimitDrop       = "limit_drop"
+	EventLimitDisconnect = "limit_disconnect"
+)
+
+// DefaultSlogLevels are the levels used by SlogResponder for each event type.
+var DefaultSlogLevels = map[string]slog.Level{
+	EventConnected:   slog.LevelDebug,
+	EventUpgradeFail: slog.LevelWarn,
+	EventInitFail:    slog.LevelInfo,
+	EventJoined:      slog.LevelInfo,
+	EventLeft:        slog.LevelInfo,
+
+	EventLimitWarn:       slog.LevelDebug,
+	EventLimitDrop:       slog.LevelInfo,
+	EventLimitDisconnect: slog.LevelWarn,
+}
+
+// SlogResponder logs player events as structured records.
+type SlogResponder[P LogNamer] struct {
+	Responder[P]
+	Logger *slog.Logger
+	// Levels overrides DefaultSlogLevels for some event types.
+	Levels map[string]slog.Level
+
+	game    string
+	counter Counter
+}
+
+// NewSlogResponder makes a SlogResponder for the named game.
+// If counter is not nil, the number of players is logged when they join or leave.
+func NewSlogResponder[P LogNamer](r Responder[P], logger *slog.Logger, game string, counter Counter) *SlogResponder[P] {
+	return &SlogResponder[P]{
+		Responder: r,
+		Logger:    logger,
+		game:      game,
+		counter:   counter,
+	}
+}
+
+func (l *SlogResponder[P]) level(event string) slog.Level {
+	if level, ok := l.Levels[event]; ok {
+		return level
+	}
+	return DefaultSlogLevels[event]
+}
+
+func (l *SlogResponder[P]) log(event string, attrs ...slog.Attr) {
+	level := l.level(event)
+	ctx := context.Background()
+	if !l.Logger.Enabled(ctx, level) {
+		return
+	}
+	attrs = append(attrs, slog.String("event", event), slog.String("game", l.game))
+	l.Logger.LogAttrs(ctx, level, "player "+event, attrs...)
+}
+
+// connAttrs returns the attributes of a connection in every record.
+func connAttrs(meta *ConnMeta) []slog.Attr {
+	return []slog.Attr{
+		slog.Uint64("conn_id", meta.ID),
+		slog.String("remote_addr", meta.Addr()),
+	}
+}
+
+func (l *SlogResponder[P]) PlayerConnected(meta *ConnMeta, r *http.Request) {
+	l.log(EventConnected, append(connAttrs(meta), slog.String("user_agent", meta.UserAgent))...)
+	l.Responder.PlayerConnected(meta, r)
+}
+
+func (l *SlogResponder[P]) PlayerUpgradeFail(meta *ConnMeta, r *http.Request, err error) {
+	l.log(EventUpgradeFail, append(connAttrs(meta), slog.Any("error", err))...)
+	l.Responder.PlayerUpgradeFail(meta, r, err)
+}
+
+func (l *SlogResponder[P]) PlayerInitFail(meta *ConnMeta, c Conn, err error) {
+	l.log(EventInitFail, append(connAttrs(meta), slog.Any("error", err))...)
+	l.Responder.PlayerInitFail(meta, c, err)
+}
+
+func (l *SlogResponder[P]) PlayerJoined(c Conn, player *BinaryPlayer[P]) {
+	l.Responder.PlayerJoined(c, player)
+
+	attrs := append(connAttrs(player.Meta),
+		slog.String("player", player.Data.LogNameEnter()),
+	)
+	if l.counter != nil {
+		attrs = append(attrs, slog.Uint64("players", uint64(l.counter.Count())))
+	}
+	l.log(EventJoined, attrs...)
+}
+
+func (l *SlogResponder[P]) PlayerLeft(c Conn, player *BinaryPlayer[P]) {
+	l.Responder.PlayerLeft(c, player)
+
+	t := player.Meta.Traffic
+	attrs := append(connAttrs(player.Meta),
+		slog.String("player", player.Data.LogNameLeave()),
+		slog.Duration("duration", time.Since(player.Meta.Connected)),
+		slog.Uint64("bytes_in", t.BytesIn.Load()),
+		slog.Uint64("bytes_out", t.BytesOut.Load()),
+	)
+	if reason := player.Reason(); reason != 0 {
+		attrs = append(attrs, slog.String("reason", reason.String()))
+	}
+	if l.counter != nil {
+		attrs = append(attrs, slog.Uint64("players", uint64(l.counter.Count())))
+	}
+	l.log(EventLeft, attrs...)
+}
+
+func (l *SlogResponder[P]) MessageLimited(player *BinaryPlayer[P], action InboundAction, err error) {
+	messageLimited(l.Responder, player, action, err)
+
+	l.log("limit_"+action.String(), append(connAttrs(player.Meta),
+		slog.String("player", player.Data.LogNameLeave()),
+		slog.Any("error", err),
+	)...)
+}
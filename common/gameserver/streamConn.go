@@ -0,0 +1,89 @@
+package gameserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxFrameSize limits the messages of a stream connection without a read limit.
+const maxFrameSize = 16 << 20
+
+var errFrame = errors.New("gameserver: bad frame")
+
+// NewStreamConn makes a Conn that sends length-prefixed messages over a stream,
+// such as a TCP connection. Each message is sent as a 4-byte big-endian length,
+// then that many bytes: the message type, followed by the payload.
+func NewStreamConn(nc net.Conn) Conn {
+	return &msgConn{frameTransport: &streamConn{Conn: nc, r: bufio.NewReader(nc)}}
+}
+
+// DialTCP connects to a server that serves players with ServeTCP.
+func DialTCP(addr string) (Conn, error) {
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamConn(nc), nil
+}
+
+// streamConn frames messages over a net.Conn.
+type streamConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	writeLock     sync.Mutex
+	writeDeadline time.Time
+}
+
+func (c *streamConn) readFrame(limit int64) (Msg, error) {
+	var h [5]byte
+	if _, err := io.ReadFull(c.r, h[:]); err != nil {
+		return Msg{}, err
+	}
+	n := int64(binary.BigEndian.Uint32(h[:]))
+	if n < 1 {
+		return Msg{}, errFrame
+	}
+	n--
+	if (limit > 0 && n > limit) || n > maxFrameSize {
+		// the payload is left unread, so msgConn fails later reads
+		return Msg{}, ErrReadLimit
+	}
+
+	m := Msg{MsgType: int(h[4]), Payload: make([]byte, n)}
+	if _, err := io.ReadFull(c.r, m.Payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Msg{}, err
+	}
+	return m, nil
+}
+
+func (c *streamConn) writeFrame(m Msg, deadline time.Time) error {
+	b := make([]byte, 5+len(m.Payload))
+	binary.BigEndian.PutUint32(b, uint32(1+len(m.Payload)))
+	b[4] = byte(m.MsgType)
+	copy(b[5:], m.Payload)
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if !deadline.IsZero() {
+		c.Conn.SetWriteDeadline(deadline)
+		defer c.Conn.SetWriteDeadline(c.writeDeadline)
+	}
+	_, err := c.Conn.Write(b)
+	return err
+}
+
+func (c *streamConn) SetWriteDeadline(t time.Time) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.writeDeadline = t
+	return c.Conn.SetWriteDeadline(t)
+}
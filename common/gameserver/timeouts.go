@@ -0,0 +1,61 @@
+package gameserver
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// TimeoutConfig configures connection timeouts and keepalive.
+// Zero values disable the corresponding timeout.
+type TimeoutConfig struct {
+	// Time allowed for the client to send its hello message
+	Handshake time.Duration
+	// Time allowed without receiving any message or pong
+	Idle time.Duration
+	// Interval of WebSocket ping control frames
+	PingInterval time.Duration
+	// Time allowed for writing each message
+	Write time.Duration
+}
+
+// isTimeout returns whether err is a network timeout.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// deadline returns the time after d from now, or the zero time if d is zero.
+func deadline(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+// extendIdle pushes back the read deadline after receiving a message or pong.
+func (t *TimeoutConfig) extendIdle(c Conn) {
+	if t.Idle > 0 {
+		c.SetReadDeadline(deadline(t.Idle))
+	}
+}
+
+// pinger sends ping control frames until the player stops.
+func (t *TimeoutConfig) pinger(c Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(t.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			writeTimeout := t.Write
+			if writeTimeout <= 0 {
+				writeTimeout = t.PingInterval
+			}
+			if err := c.WriteControl(PingMessage, nil, deadline(writeTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gameserver
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHandshakeTimeout(t *testing.T) {
+	g, r := newTestServer()
+	g.Timeouts = TimeoutConfig{Handshake: 20 * time.Millisecond}
+	client, server := Pipe(16)
+	defer client.Close()
+	go g.ServeConn(server)
+
+	// no hello
+	if code := readClose(t, client); code != CloseHandshakeTimeout {
+		t.Errorf("close code %d, want %d", code, CloseHandshakeTimeout)
+	}
+	if err := recv(t, r.initFailed); !errors.Is(err, ReasonHandshakeTimeout) {
+		t.Errorf("PlayerInitFail(%v), want %v", err, ReasonHandshakeTimeout)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	g, r := newTestServer()
+	g.Timeouts = TimeoutConfig{Handshake: time.Second, Idle: 30 * time.Millisecond}
+	c := serve(t, g, "alice")
+	recv(t, r.joined)
+
+	// messages extend the deadline
+	for i := 0; i < 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+		c.WriteMessage(BinaryMessage, []byte("move"))
+	}
+	select {
+	case p := <-r.left:
+		t.Fatalf("left with reason %v while sending messages", p.Reason())
+	default:
+	}
+
+	if code := readClose(t, c); code != CloseIdle {
+		t.Errorf("close code %d, want %d", code, CloseIdle)
+	}
+	if p := recv(t, r.left); p.Reason() != ReasonIdle {
+		t.Errorf("left with reason %v, want %v", p.Reason(), ReasonIdle)
+	}
+}
+
+func TestPingKeepsAlive(t *testing.T) {
+	g, r := newTestServer()
+	g.Timeouts = TimeoutConfig{Idle: 50 * time.Millisecond, PingInterval: 10 * time.Millisecond}
+	c := serve(t, g, "alice")
+	recv(t, r.joined)
+
+	// ReadMessage answers the pings with pongs until the deadline
+	c.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, _, err := c.ReadMessage(); !isTimeout(err) {
+		t.Fatalf("read %v, want a timeout while pinged", err)
+	}
+	select {
+	case p := <-r.left:
+		t.Fatalf("left with reason %v while answering pings", p.Reason())
+	default:
+	}
+
+	// without pongs, the player is idle
+	time.Sleep(100 * time.Millisecond)
+	if p := recv(t, r.left); p.Reason() != ReasonIdle {
+		t.Errorf("left with reason %v, want %v", p.Reason(), ReasonIdle)
+	}
+}
+
+func TestPinger(t *testing.T) {
+	client, server := Pipe(16)
+	defer client.Close()
+	defer server.Close()
+	pongs := make(chan struct{}, 16)
+	server.SetPongHandler(func(string) error {
+		pongs <- struct{}{}
+		return nil
+	})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	cfg := TimeoutConfig{PingInterval: 5 * time.Millisecond}
+	go func() {
+		cfg.pinger(server, stop)
+		close(done)
+	}()
+	go client.ReadMessage()
+	go server.ReadMessage()
+
+	for i := 0; i < 3; i++ {
+		recv(t, pongs)
+	}
+	close(stop)
+	recv(t, done)
+}
@@ -0,0 +1,24 @@
+package gameserver
+
+import "sync/atomic"
+
+// Traffic counts the messages and bytes sent to and received from a player.
+type Traffic struct {
+	MsgsIn    atomic.Uint64
+	BytesIn   atomic.Uint64
+	MsgsOut   atomic.Uint64
+	BytesOut  atomic.Uint64
+	Overflows atomic.Uint64 // messages dropped because the send queue was full
+}
+
+// Received counts a received message of n bytes.
+func (t *Traffic) Received(n int) {
+	t.MsgsIn.Add(1)
+	t.BytesIn.Add(uint64(n))
+}
+
+// Sent counts a sent message of n bytes.
+func (t *Traffic) Sent(n int) {
+	t.MsgsOut.Add(1)
+	t.BytesOut.Add(uint64(n))
+}
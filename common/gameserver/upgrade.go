@@ -0,0 +1,125 @@
+package gameserver
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrSubprotocol is reported to PlayerUpgradeFail when a client
+// does not offer any supported subprotocol and one is required.
+var ErrSubprotocol = errors.New("no supported subprotocol")
+
+// UpgradeConfig is the policy for upgrading HTTP requests to WebSockets.
+// It must not be changed after the server starts serving players.
+type UpgradeConfig struct {
+	// AllowedOrigins lists the origins that may connect from browsers.
+	// Entries are "*" (any origin), "scheme://host[:port]", or
+	// "scheme://*.domain[:port]" to allow any subdomain of domain,
+	// on any port unless one is given.
+	// The scheme may be omitted to match any scheme.
+	// If empty, only same-origin requests are allowed.
+	// Requests without an Origin header (non-browser clients) are always allowed.
+	AllowedOrigins []string
+
+	// Subprotocols lists the supported subprotocols in order of preference.
+	Subprotocols []string
+	// RequireSubprotocol rejects clients that offer none of Subprotocols.
+	RequireSubprotocol bool
+
+	// Buffer sizes; zero uses the defaults of the websocket package.
+	ReadBufferSize, WriteBufferSize int
+
+	// EnableCompression negotiates per-message compression.
+	EnableCompression bool
+}
+
+// ParseOrigins splits a comma-separated list of origins.
+func ParseOrigins(s string) []string {
+	var origins []string
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+// matchOrigin returns whether origin (a parsed Origin header) matches a pattern
+// of AllowedOrigins.
+func matchOrigin(pattern string, origin *url.URL) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	scheme, host, ok := strings.Cut(pattern, "://")
+	if !ok {
+		scheme, host = "", pattern
+	}
+	if scheme != "" && !strings.EqualFold(scheme, origin.Scheme) {
+		return false
+	}
+
+	if suffix, ok := strings.CutPrefix(host, "*."); ok {
+		if domain, port, err := net.SplitHostPort(suffix); err == nil {
+			if port != origin.Port() {
+				return false
+			}
+			suffix = domain
+		}
+		// subdomains only, not the domain itself
+		name := origin.Hostname()
+		return len(name) > len(suffix)+1 &&
+			strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(suffix))
+	}
+	return strings.EqualFold(host, origin.Host)
+}
+
+// checkOrigin returns whether the request is allowed by the origin policy.
+func (cfg *UpgradeConfig) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if len(cfg.AllowedOrigins) == 0 {
+		return strings.EqualFold(u.Host, r.Host)
+	}
+	for _, pattern := range cfg.AllowedOrigins {
+		if matchOrigin(pattern, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSubprotocol returns whether the client offers a supported subprotocol.
+func (cfg *UpgradeConfig) hasSubprotocol(r *http.Request) bool {
+	for _, offered := range websocket.Subprotocols(r) {
+		for _, supported := range cfg.Subprotocols {
+			if offered == supported {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newUpgrader makes an Upgrader for the policy.
+func (cfg *UpgradeConfig) newUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		Subprotocols:      cfg.Subprotocols,
+		CheckOrigin:       cfg.checkOrigin,
+		EnableCompression: cfg.EnableCompression,
+	}
+}
@@ -0,0 +1,59 @@
+package gameserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	cfg := UpgradeConfig{AllowedOrigins: []string{
+		"https://game.example.org",
+		"http://localhost:8080",
+		"*.example.com",
+		"https://*.example.net:8443",
+	}}
+	for origin, want := range map[string]bool{
+		"":                              true, // not a browser
+		"https://game.example.org":      true,
+		"HTTPS://Game.Example.org":      true,
+		"http://game.example.org":       false,
+		"https://game.example.org:8443": false,
+		"http://localhost:8080":         true,
+		"http://localhost":              false,
+		"https://a.example.com":         true,
+		"http://a.b.example.com":        true,
+		"https://a.example.com:8443":    true,
+		"https://example.com":           false,
+		"https://aexample.com":          false,
+		"https://a.example.com.evil":    false,
+		"https://a.example.net:8443":    true,
+		"https://a.example.net":         false,
+		"https://a.example.net:443":     false,
+		"https://a.example.net:8443.x":  false,
+		"http://[::1]:80":               false,
+		"://bad":                        false,
+	} {
+		r := &http.Request{Host: "game.example.org", Header: http.Header{}}
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if got := cfg.checkOrigin(r); got != want {
+			t.Errorf("checkOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestCheckOriginDefault(t *testing.T) {
+	var cfg UpgradeConfig
+	for origin, want := range map[string]bool{
+		"https://game.example.org:8080": true,
+		"http://game.example.org:8080":  true,
+		"https://game.example.org":      false,
+		"https://evil.example.org:8080": false,
+	} {
+		r := &http.Request{Host: "game.example.org:8080", Header: http.Header{"Origin": {origin}}}
+		if got := cfg.checkOrigin(r); got != want {
+			t.Errorf("checkOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
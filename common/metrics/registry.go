@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector writes its current metrics to a Writer.
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// Registry serves the metrics of its collectors over HTTP.
+type Registry struct {
+	collectors []Collector
+	lock       sync.Mutex
+}
+
+// Register adds collectors to the registry.
+func (r *Registry) Register(c ...Collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, c...)
+}
+
+// ServeHTTP responds with the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.lock.Unlock()
+
+	var w Writer
+	for _, c := range collectors {
+		c.Collect(&w)
+	}
+
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(res)
+	w.writeTo(bw)
+	bw.Flush()
+}
+
+type family struct {
+	name, help, typ string
+	samples         []string
+}
+
+// Writer groups samples into metric families,
+// so that collectors may write samples of the same metric.
+type Writer struct {
+	families []*family
+	byName   map[string]*family
+}
+
+func (w *Writer) family(name, help, typ string) *family {
+	if f, ok := w.byName[name]; ok {
+		return f
+	}
+	if w.byName == nil {
+		w.byName = make(map[string]*family)
+	}
+	f := &family{name: name, help: help, typ: typ}
+	w.families = append(w.families, f)
+	w.byName[name] = f
+	return f
+}
+
+// formatLabels formats label pairs (key, value, key, value, ...).
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		labelEscaper.WriteString(&b, labels[i+1])
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// The escapes of label values and help texts in the text format.
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter writes a counter sample. labels are pairs of keys and values.
+func (w *Writer) Counter(name, help string, v uint64, labels ...string) {
+	f := w.family(name, help, "counter")
+	f.samples = append(f.samples, name+formatLabels(labels)+" "+strconv.FormatUint(v, 10))
+}
+
+// Gauge writes a gauge sample. labels are pairs of keys and values.
+func (w *Writer) Gauge(name, help string, v float64, labels ...string) {
+	f := w.family(name, help, "gauge")
+	f.samples = append(f.samples, name+formatLabels(labels)+" "+formatValue(v))
+}
+
+// Histogram writes the samples of a histogram. labels are pairs of keys and values.
+func (w *Writer) Histogram(name, help string, h *Histogram, labels ...string) {
+	f := w.family(name, help, "histogram")
+
+	var cumulative uint64
+	for i := range h.buckets {
+		cumulative += h.buckets[i].Load()
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = formatValue(h.bounds[i])
+		}
+		f.samples = append(f.samples, name+"_bucket"+formatLabels(append(labels[:len(labels):len(labels)], "le", le))+" "+strconv.FormatUint(cumulative, 10))
+	}
+	l := formatLabels(labels)
+	f.samples = append(f.samples,
+		name+"_sum"+l+" "+formatValue(h.Sum()),
+		name+"_count"+l+" "+strconv.FormatUint(cumulative, 10),
+	)
+}
+
+func (w *Writer) writeTo(bw *bufio.Writer) {
+	for _, f := range w.families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.samples {
+			bw.WriteString(s)
+			bw.WriteByte('\n')
+		}
+	}
+}
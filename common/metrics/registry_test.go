@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+type collectorFunc func(w *Writer)
+
+func (f collectorFunc) Collect(w *Writer) { f(w) }
+
+func TestRegistry(t *testing.T) {
+	var c Counter
+	c.Add(3)
+	c.Inc()
+	h := NewHistogram([]float64{0.5, 1})
+	for _, v := range []float64{0.25, 0.5, 0.75, 2} {
+		h.Observe(v)
+	}
+
+	var r Registry
+	r.Register(collectorFunc(func(w *Writer) {
+		w.Counter("requests_total", "Requests received.", c.Value(), "game", "duel")
+		w.Gauge("players", "Number of players.", 1.5)
+		w.Histogram("tick_seconds", "Time of a tick.", h, "game", "duel")
+	}))
+	r.Register(collectorFunc(func(w *Writer) {
+		// samples of the same metric from another collector join its family
+		w.Counter("requests_total", "Requests received.", 0, "game", `a "b" \c`+"\nd")
+		w.Gauge("escaped", "Help with \\ and\nnewline.", 0)
+	}))
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+
+	const want = `# HELP requests_total Requests received.
+# TYPE requests_total counter
+requests_total{game="duel"} 4
+requests_total{game="a \"b\" \\c\nd"} 0
+# HELP players Number of players.
+# TYPE players gauge
+players 1.5
+# HELP tick_seconds Time of a tick.
+# TYPE tick_seconds histogram
+tick_seconds_bucket{game="duel",le="0.5"} 2
+tick_seconds_bucket{game="duel",le="1"} 3
+tick_seconds_bucket{game="duel",le="+Inf"} 4
+tick_seconds_sum{game="duel"} 3.5
+tick_seconds_count{game="duel"} 4
+# HELP escaped Help with \\ and\nnewline.
+# TYPE escaped gauge
+escaped 0
+`
+	if got := res.Body.String(); got != want {
+		t.Errorf("metrics:\n%s\nwant:\n%s", got, want)
+	}
+	if ct := res.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type %q", ct)
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	var w Writer
+	w.Histogram("empty", "Nothing observed.", NewHistogram(nil))
+	f := w.families[0]
+	want := []string{`empty_bucket{le="+Inf"} 0`, "empty_sum 0", "empty_count 0"}
+	if len(f.samples) != len(want) {
+		t.Fatalf("samples %q, want %q", f.samples, want)
+	}
+	for i := range want {
+		if f.samples[i] != want[i] {
+			t.Errorf("sample %d = %q, want %q", i, f.samples[i], want[i])
+		}
+	}
+}
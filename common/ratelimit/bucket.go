@@ -0,0 +1,51 @@
+// Package ratelimit implements token buckets.
+package ratelimit
+
+import "time"
+
+// Bucket is a token bucket. It is not safe for concurrent use.
+// The zero Bucket allows nothing; use NewBucket.
+type Bucket struct {
+	// Tokens added per second
+	Rate float64
+	// Maximum number of tokens
+	Burst float64
+
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket makes a full Bucket.
+func NewBucket(rate, burst float64) *Bucket {
+	return &Bucket{Rate: rate, Burst: burst, tokens: burst}
+}
+
+// refill adds the tokens accumulated since the last call.
+func (b *Bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		if elapsed := now.Sub(b.last); elapsed > 0 {
+			b.tokens += elapsed.Seconds() * b.Rate
+			if b.tokens > b.Burst {
+				b.tokens = b.Burst
+			}
+		}
+	}
+	b.last = now
+}
+
+// Allow takes one token if available and returns whether it did.
+func (b *Bucket) Allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Full returns whether the bucket would be full at now.
+// Full buckets behave the same as new buckets, so they may be discarded.
+func (b *Bucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.Burst
+}
@@ -0,0 +1,228 @@
+package tick
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stepper is a simulation that is stepped by a Pool.
+type Stepper interface {
+	// Step runs the processing that is due at now.
+	// It returns false when the simulation is over.
+	Step(now time.Time) bool
+}
+
+// Clocked is a Stepper with its own clock, such as a fake clock in tests
+// or replays. The Pool steps it at the time of its clock rather than
+// the time of the tick, so it is stepped with the same clock it started with.
+type Clocked interface {
+	Stepper
+	Now() time.Time
+}
+
+type poolEntry struct {
+	s    Stepper
+	done chan struct{}
+	over bool
+}
+
+// PoolStats is a snapshot of the timing of a Pool.
+type PoolStats struct {
+	// Number of simulations being stepped
+	Active int
+	// Number of ticks run
+	Ticks uint64
+	// Number of ticks that finished after the next tick was due
+	Overruns uint64
+	// Delay between when the last tick was due and when it finished
+	LastLag time.Duration
+	// Largest lag of any tick
+	MaxLag time.Duration
+}
+
+// Pool steps many simulations on a bounded number of workers.
+// Every interval, all simulations are stepped in one batch,
+// which is split between the workers. Simulations are stepped at the
+// time of the tick, or of their own clock if they are Clocked.
+type Pool struct {
+	interval time.Duration
+	workers  int
+
+	// OnTick, if set, is called with the time taken by each tick.
+	OnTick func(d time.Duration)
+
+	entries []*poolEntry
+	added   []*poolEntry
+	lock    sync.Mutex
+
+	stopped bool
+
+	ticks    atomic.Uint64
+	overruns atomic.Uint64
+	lastLag  atomic.Int64
+	maxLag   atomic.Int64
+}
+
+// NewPool makes a Pool that steps simulations every interval
+// using the given number of workers.
+func NewPool(interval time.Duration, workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{
+		interval: interval,
+		workers:  workers,
+	}
+}
+
+// Add schedules s to be stepped from the next tick.
+// The returned chan is closed when s is over or the pool stops.
+func (p *Pool) Add(s Stepper) <-chan struct{} {
+	e := &poolEntry{s: s, done: make(chan struct{})}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopped {
+		close(e.done)
+	} else {
+		p.added = append(p.added, e)
+	}
+	return e.done
+}
+
+// Stats returns the current timing statistics.
+func (p *Pool) Stats() PoolStats {
+	p.lock.Lock()
+	active := len(p.entries) + len(p.added)
+	p.lock.Unlock()
+
+	return PoolStats{
+		Active:   active,
+		Ticks:    p.ticks.Load(),
+		Overruns: p.overruns.Load(),
+		LastLag:  time.Duration(p.lastLag.Load()),
+		MaxLag:   time.Duration(p.maxLag.Load()),
+	}
+}
+
+// poolBatch is a part of a tick that is run by one worker.
+type poolBatch struct {
+	entries []*poolEntry
+	now     time.Time
+	wg      *sync.WaitGroup
+}
+
+// worker steps batches of entries.
+func worker(batches <-chan poolBatch) {
+	for b := range batches {
+		for _, e := range b.entries {
+			now := b.now
+			if c, ok := e.s.(Clocked); ok {
+				now = c.Now()
+			}
+			e.over = !e.s.Step(now)
+		}
+		b.wg.Done()
+	}
+}
+
+// tick steps every entry once using the workers.
+func (p *Pool) tick(now time.Time, batches chan<- poolBatch) {
+	p.lock.Lock()
+	p.entries = append(p.entries, p.added...)
+	p.added = nil
+	entries := p.entries
+	p.lock.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+
+	// split into one batch per worker
+	size := (len(entries) + p.workers - 1) / p.workers
+	var wg sync.WaitGroup
+	for i := 0; i < len(entries); i += size {
+		end := i + size
+		if end > len(entries) {
+			end = len(entries)
+		}
+		wg.Add(1)
+		batches <- poolBatch{entries[i:end], now, &wg}
+	}
+	wg.Wait()
+
+	// remove finished entries
+	p.lock.Lock()
+	n := 0
+	for _, e := range p.entries {
+		if e.over {
+			close(e.done)
+		} else {
+			p.entries[n] = e
+			n++
+		}
+	}
+	for i := n; i < len(p.entries); i++ {
+		p.entries[i] = nil
+	}
+	p.entries = p.entries[:n]
+	p.lock.Unlock()
+}
+
+// Run steps the simulations every interval until ctx is done.
+// When Run returns, the chans of all remaining simulations are closed.
+func (p *Pool) Run(ctx context.Context) {
+	batches := make(chan poolBatch)
+	for i := 0; i < p.workers; i++ {
+		go worker(batches)
+	}
+	defer close(batches)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	defer p.stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case due := <-ticker.C:
+			now := time.Now()
+			p.tick(now, batches)
+			if p.OnTick != nil {
+				p.OnTick(time.Since(now))
+			}
+			p.record(time.Since(due))
+		}
+	}
+}
+
+// record updates the lag statistics after a tick.
+func (p *Pool) record(lag time.Duration) {
+	p.ticks.Add(1)
+	if lag > p.interval {
+		p.overruns.Add(1)
+	}
+	p.lastLag.Store(int64(lag))
+	for {
+		max := p.maxLag.Load()
+		if int64(lag) <= max || p.maxLag.CompareAndSwap(max, int64(lag)) {
+			break
+		}
+	}
+}
+
+// stop closes the chans of all remaining simulations
+// and makes later calls to Add return closed chans.
+func (p *Pool) stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stopped = true
+	for _, e := range append(p.entries, p.added...) {
+		close(e.done)
+	}
+	p.entries = nil
+	p.added = nil
+}
@@ -0,0 +1,150 @@
+package tick
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type stepper struct{ stepped []time.Time }
+
+func (s *stepper) Step(now time.Time) bool {
+	s.stepped = append(s.stepped, now)
+	return true
+}
+
+type clockedStepper struct {
+	stepper
+	clock time.Time
+}
+
+func (s *clockedStepper) Now() time.Time { return s.clock }
+
+func TestPoolClock(t *testing.T) {
+	batches := make(chan poolBatch)
+	go worker(batches)
+	defer close(batches)
+
+	p := NewPool(time.Millisecond, 1)
+	plain := new(stepper)
+	clocked := &clockedStepper{clock: time.Unix(100, 0)}
+	p.Add(plain)
+	p.Add(clocked)
+
+	now := time.Unix(200, 0)
+	p.tick(now, batches)
+	if len(plain.stepped) != 1 || !plain.stepped[0].Equal(now) {
+		t.Errorf("stepper stepped at %v, want %v", plain.stepped, now)
+	}
+	if len(clocked.stepped) != 1 || !clocked.stepped[0].Equal(clocked.clock) {
+		t.Errorf("clocked stepper stepped at %v, want its clock %v", clocked.stepped, clocked.clock)
+	}
+}
+
+// countdown is a simulation that is over after steps steps.
+type countdown struct{ steps int }
+
+func (c *countdown) Step(now time.Time) bool {
+	c.steps--
+	return c.steps > 0
+}
+
+func TestPoolTick(t *testing.T) {
+	batches := make(chan poolBatch)
+	for i := 0; i < 3; i++ {
+		go worker(batches)
+	}
+	defer close(batches)
+
+	p := NewPool(time.Millisecond, 3)
+	sims := make([]*countdown, 10)
+	done := make([]<-chan struct{}, len(sims))
+	for i := range sims {
+		sims[i] = &countdown{steps: i + 1}
+		done[i] = p.Add(sims[i])
+	}
+
+	for tick := 1; tick <= len(sims); tick++ {
+		p.tick(time.Now(), batches)
+		if active := p.Stats().Active; active != len(sims)-tick {
+			t.Errorf("tick %d: %d active, want %d", tick, active, len(sims)-tick)
+		}
+		for i, c := range done {
+			select {
+			case <-c:
+				if i >= tick {
+					t.Errorf("tick %d: simulation %d over early", tick, i)
+				}
+			default:
+				if i < tick {
+					t.Errorf("tick %d: chan of simulation %d not closed", tick, i)
+				}
+			}
+		}
+	}
+}
+
+func TestPoolStop(t *testing.T) {
+	p := NewPool(time.Millisecond, 2)
+	running := p.Add(&countdown{steps: -1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(stopped)
+	}()
+	cancel()
+	<-stopped
+
+	select {
+	case <-running:
+	default:
+		t.Error("chan of a running simulation not closed by stop")
+	}
+	select {
+	case <-p.Add(&countdown{steps: -1}):
+	default:
+		t.Error("chan of a simulation added after stop not closed")
+	}
+}
+
+// work is a simulation that does some arithmetic, like a match of physics.
+type work struct{ x, v float64 }
+
+func (w *work) Step(now time.Time) bool {
+	for i := 0; i < 100; i++ {
+		w.v -= w.x * 0.001
+		w.x += w.v * 0.001
+	}
+	return true
+}
+
+// BenchmarkPoolTick measures a tick of many matches on few workers,
+// and reports the time per match.
+func BenchmarkPoolTick(b *testing.B) {
+	const matches = 10000
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			batches := make(chan poolBatch)
+			for i := 0; i < workers; i++ {
+				go worker(batches)
+			}
+			defer close(batches)
+
+			p := NewPool(time.Millisecond, workers)
+			for i := 0; i < matches; i++ {
+				p.Add(&work{x: 1})
+			}
+			now := time.Now()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.tick(now, batches)
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*matches), "ns/match")
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Package tick implements a fixed-timestep scheduler for game simulations.
+package tick
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds the rates of a Scheduler.
+type Config struct {
+	// Interval of physics frames
+	PhysicsInterval time.Duration
+	// Interval of world state updates, or zero to disable
+	NetworkInterval time.Duration
+	// Interval of pings, or zero to disable
+	PingInterval time.Duration
+
+	// MaxCatchUp is the maximum number of physics frames run by one Advance.
+	// If the simulation is further behind, the extra time is dropped and
+	// counted as an overrun. Zero means no limit.
+	MaxCatchUp int
+
+	// Clock returns the current time for Run, or nil for time.Now.
+	Clock func() time.Time
+}
+
+// Scheduler accumulates elapsed time and runs physics frames at a fixed
+// timestep, and network updates and pings at most once per Advance.
+type Scheduler struct {
+	Config
+
+	Physics func()
+	Network func()
+	Ping    func()
+
+	// OnOverrun, if set, is called with the number of dropped physics frames
+	// whenever the catch-up limit is hit.
+	OnOverrun func(dropped int)
+
+	last        time.Time
+	acc         time.Duration
+	nextNetwork time.Time
+	nextPing    time.Time
+
+	overruns      atomic.Uint64
+	droppedFrames atomic.Uint64
+}
+
+// New makes a Scheduler with the given rates and callbacks.
+// Callbacks for disabled rates may be nil.
+func New(cfg Config, physics, network, ping func()) *Scheduler {
+	return &Scheduler{
+		Config:  cfg,
+		Physics: physics,
+		Network: network,
+		Ping:    ping,
+	}
+}
+
+// Reset restarts the timers at now. The first network update and ping
+// are due immediately, and the first physics frame after one interval.
+func (s *Scheduler) Reset(now time.Time) {
+	s.last = now
+	s.acc = 0
+	s.nextNetwork = now
+	s.nextPing = now
+}
+
+// nextTimer advances a timer by one interval, skipping missed intervals.
+func nextTimer(next time.Time, interval time.Duration, now time.Time) time.Time {
+	next = next.Add(interval)
+	if !next.After(now) {
+		next = now.Add(interval)
+	}
+	return next
+}
+
+// Advance runs the callbacks that are due at now and returns the number of
+// physics frames that were run.
+func (s *Scheduler) Advance(now time.Time) int {
+	if elapsed := now.Sub(s.last); elapsed > 0 {
+		s.acc += elapsed
+	}
+	s.last = now
+
+	frames := 0
+	for s.acc >= s.PhysicsInterval {
+		if s.MaxCatchUp > 0 && frames >= s.MaxCatchUp {
+			dropped := int(s.acc / s.PhysicsInterval)
+			s.acc %= s.PhysicsInterval
+			s.overruns.Add(1)
+			s.droppedFrames.Add(uint64(dropped))
+			if s.OnOverrun != nil {
+				s.OnOverrun(dropped)
+			}
+			break
+		}
+		s.Physics()
+		s.acc -= s.PhysicsInterval
+		frames++
+	}
+
+	if s.NetworkInterval > 0 && !now.Before(s.nextNetwork) {
+		s.Network()
+		s.nextNetwork = nextTimer(s.nextNetwork, s.NetworkInterval, now)
+	}
+
+	if s.PingInterval > 0 && !now.Before(s.nextPing) {
+		s.Ping()
+		s.nextPing = nextTimer(s.nextPing, s.PingInterval, now)
+	}
+
+	return frames
+}
+
+// Next returns the time when a callback is next due.
+func (s *Scheduler) Next() time.Time {
+	next := s.last.Add(s.PhysicsInterval - s.acc)
+	if s.NetworkInterval > 0 && s.nextNetwork.Before(next) {
+		next = s.nextNetwork
+	}
+	if s.PingInterval > 0 && s.nextPing.Before(next) {
+		next = s.nextPing
+	}
+	return next
+}
+
+// Overruns returns how many times the catch-up limit was hit.
+func (s *Scheduler) Overruns() uint64 { return s.overruns.Load() }
+
+// DroppedFrames returns the total number of physics frames dropped by overruns.
+func (s *Scheduler) DroppedFrames() uint64 { return s.droppedFrames.Load() }
+
+// now returns the current time of the Clock.
+func (s *Scheduler) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
+
+// Run resets the timers and calls step whenever a callback is due,
+// until ctx is done or step returns false. step should call Advance.
+func (s *Scheduler) Run(ctx context.Context, step func(now time.Time) bool) {
+	s.Reset(s.now())
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if !step(s.now()) {
+			return
+		}
+		timer.Reset(s.Next().Sub(s.now()))
+	}
+}
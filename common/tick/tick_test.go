@@ -0,0 +1,182 @@
+package tick
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const ms = time.Millisecond
+
+// counter counts the calls of the callbacks of a Scheduler.
+type counter struct {
+	physics, network, ping int
+}
+
+func (c *counter) scheduler(cfg Config) *Scheduler {
+	return New(cfg, func() { c.physics++ }, func() { c.network++ }, func() { c.ping++ })
+}
+
+func TestAdvancePhysics(t *testing.T) {
+	var c counter
+	s := c.scheduler(Config{PhysicsInterval: 10 * ms})
+	t0 := time.Unix(1700000000, 0)
+	s.Reset(t0)
+
+	steps := []struct {
+		at     time.Duration
+		frames int
+	}{
+		{0, 0},
+		{5 * ms, 0},
+		{10 * ms, 1},
+		{35 * ms, 2}, // 5ms left over
+		{40 * ms, 1},
+		{30 * ms, 0}, // the clock went back, and counts again from there
+		{49 * ms, 1}, // 9ms left over
+		{50 * ms, 1},
+	}
+	total := 0
+	for _, st := range steps {
+		if got := s.Advance(t0.Add(st.at)); got != st.frames {
+			t.Errorf("Advance(+%v) = %d frames, want %d", st.at, got, st.frames)
+		}
+		total += st.frames
+	}
+	if c.physics != total {
+		t.Errorf("physics called %d times, want %d", c.physics, total)
+	}
+	if s.Overruns() != 0 || s.DroppedFrames() != 0 {
+		t.Errorf("%d overruns, %d dropped frames without a catch-up limit", s.Overruns(), s.DroppedFrames())
+	}
+}
+
+func TestAdvanceCatchUp(t *testing.T) {
+	var c counter
+	s := c.scheduler(Config{PhysicsInterval: 10 * ms, MaxCatchUp: 3})
+	var dropped []int
+	s.OnOverrun = func(n int) { dropped = append(dropped, n) }
+	t0 := time.Unix(1700000000, 0)
+	s.Reset(t0)
+
+	if got := s.Advance(t0.Add(105 * ms)); got != 3 {
+		t.Errorf("Advance after 105ms = %d frames, want 3", got)
+	}
+	if len(dropped) != 1 || dropped[0] != 7 {
+		t.Errorf("OnOverrun called with %v, want [7]", dropped)
+	}
+	if s.Overruns() != 1 || s.DroppedFrames() != 7 {
+		t.Errorf("%d overruns, %d dropped frames, want 1, 7", s.Overruns(), s.DroppedFrames())
+	}
+
+	// the remainder of the dropped time is kept
+	if got := s.Advance(t0.Add(110 * ms)); got != 1 {
+		t.Errorf("Advance after 110ms = %d frames, want 1", got)
+	}
+	if got := s.Advance(t0.Add(140 * ms)); got != 3 {
+		t.Errorf("Advance after 140ms = %d frames, want 3", got)
+	}
+	if s.Overruns() != 1 {
+		t.Errorf("%d overruns after catching up within the limit, want 1", s.Overruns())
+	}
+	if c.physics != 7 {
+		t.Errorf("physics called %d times, want 7", c.physics)
+	}
+}
+
+func TestAdvanceNetworkPing(t *testing.T) {
+	var c counter
+	s := c.scheduler(Config{PhysicsInterval: 10 * ms, NetworkInterval: 50 * ms, PingInterval: 1000 * ms})
+	t0 := time.Unix(1700000000, 0)
+	s.Reset(t0)
+
+	steps := []struct {
+		at            time.Duration
+		network, ping int // total calls
+	}{
+		{0, 1, 1}, // due immediately
+		{10 * ms, 1, 1},
+		{49 * ms, 1, 1},
+		{50 * ms, 2, 1},
+		{60 * ms, 2, 1},
+		{500 * ms, 3, 1}, // missed updates are skipped
+		{549 * ms, 3, 1},
+		{550 * ms, 4, 1},
+		{1000 * ms, 5, 2},
+		{1010 * ms, 5, 2},
+	}
+	for _, st := range steps {
+		s.Advance(t0.Add(st.at))
+		if c.network != st.network || c.ping != st.ping {
+			t.Errorf("after +%v: %d network updates, %d pings, want %d, %d",
+				st.at, c.network, c.ping, st.network, st.ping)
+		}
+	}
+}
+
+func TestAdvanceDisabled(t *testing.T) {
+	physics := 0
+	s := New(Config{PhysicsInterval: 10 * ms}, func() { physics++ }, nil, nil)
+	t0 := time.Unix(1700000000, 0)
+	s.Reset(t0)
+	s.Advance(t0.Add(time.Second)) // must not call the nil callbacks
+	if physics != 100 {
+		t.Errorf("physics called %d times, want 100", physics)
+	}
+}
+
+func TestNext(t *testing.T) {
+	var c counter
+	s := c.scheduler(Config{PhysicsInterval: 10 * ms, NetworkInterval: 50 * ms, PingInterval: 1000 * ms})
+	t0 := time.Unix(1700000000, 0)
+	s.Reset(t0)
+
+	steps := []struct {
+		at, next time.Duration
+	}{
+		{-1, 0}, // before Advance, the network update and ping are due
+		{0, 10 * ms},
+		{15 * ms, 20 * ms},
+		{45 * ms, 50 * ms},
+		{50 * ms, 60 * ms},
+		{1000 * ms, 1010 * ms},
+	}
+	for _, st := range steps {
+		if st.at >= 0 {
+			s.Advance(t0.Add(st.at))
+		}
+		if got := s.Next(); !got.Equal(t0.Add(st.next)) {
+			t.Errorf("after +%v: Next = +%v, want +%v", st.at, got.Sub(t0), st.next)
+		}
+	}
+
+	s = New(Config{PhysicsInterval: 10 * ms, NetworkInterval: 4 * ms}, func() {}, func() {}, nil)
+	s.Reset(t0)
+	s.Advance(t0)
+	if got := s.Next(); !got.Equal(t0.Add(4 * ms)) {
+		t.Errorf("Next = +%v, want the network update at +4ms", got.Sub(t0))
+	}
+}
+
+func TestRunClock(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	var c counter
+	s := c.scheduler(Config{PhysicsInterval: 10 * ms, Clock: func() time.Time { return t0 }})
+	var stepped []time.Time
+	s.Run(context.Background(), func(now time.Time) bool {
+		stepped = append(stepped, now)
+		s.Advance(now)
+		return len(stepped) < 3
+	})
+	if len(stepped) != 3 {
+		t.Fatalf("stepped %d times, want 3", len(stepped))
+	}
+	for _, now := range stepped {
+		if !now.Equal(t0) {
+			t.Errorf("stepped at %v, want the time of the Clock %v", now, t0)
+		}
+	}
+	if c.physics != 0 {
+		t.Errorf("physics called %d times while the clock stood still", c.physics)
+	}
+}
@@ -0,0 +1,96 @@
+package duel
+
+import (
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/duel/codec"
+)
+
+// AdminPlayer describes a player or bot for the admin API.
+type AdminPlayer struct {
+	Slot   int    `json:"slot"`
+	Name   string `json:"name"`
+	Color  uint8  `json:"color"`
+	Mass   uint   `json:"mass"`
+	Kills  uint   `json:"kills"`
+	Deaths uint   `json:"deaths"`
+	// Ping is in milliseconds, or -1 if it is unknown or the player is a bot.
+	Ping int  `json:"ping_ms"`
+	Bot  bool `json:"bot"`
+	// ConnID is the connection of a player, or zero while reconnecting.
+	ConnID       uint64 `json:"conn_id,omitempty"`
+	Reconnecting bool   `json:"reconnecting,omitempty"`
+}
+
+// AdminStatus is the state of the game for the admin API.
+type AdminStatus struct {
+	Players []AdminPlayer `json:"players"`
+}
+
+// AdminStatus returns the players of the game.
+func (s *Server) AdminStatus() any {
+	ids := make(map[*Client]uint64)
+	for _, p := range s.Players() {
+		ids[p.Data] = p.Meta.ID
+	}
+
+	g := s.Game
+	g.pLock.Lock()
+	defer g.pLock.Unlock()
+
+	status := AdminStatus{Players: []AdminPlayer{}}
+	for i := range g.players {
+		p := &g.players[i]
+		if !p.IsValid {
+			continue
+		}
+		a := AdminPlayer{
+			Slot:   i,
+			Name:   p.Name,
+			Color:  p.Color,
+			Mass:   p.M,
+			Kills:  p.Kills,
+			Deaths: p.Deaths,
+			Ping:   -1,
+			Bot:    p.Client == nil,
+		}
+		if c := p.Client; c != nil {
+			if c.ping != 0xFFFF {
+				a.Ping = int(c.ping)
+			}
+			a.ConnID = ids[c]
+			a.Reconnecting = c.Reconnecting()
+		}
+		status.Players = append(status.Players, a)
+	}
+	return status
+}
+
+// KickSlot disconnects the player in slot,
+// and returns false if no player is connected there.
+func (s *Server) KickSlot(slot int) bool {
+	for _, p := range s.Players() {
+		p.Data.lock.Lock()
+		cn := p.Data.cn
+		p.Data.lock.Unlock()
+		if cn == slot {
+			p.Disconnect(gameserver.ReasonKicked)
+			return true
+		}
+	}
+	return false
+}
+
+// Announce sends a message from the operators to the players whose clients
+// show messages, and returns how many players it was sent to and skipped.
+// Legacy clients cannot show messages, so they are skipped.
+func (s *Server) Announce(text string) (sent, skipped int) {
+	msg := gameserver.Msg{MsgType: gameserver.BinaryMessage, Payload: MsgMessage(text)}
+	for _, p := range s.Players() {
+		if p.Data.handshake.Caps.Has(codec.CapMessage) && p.Data.trySend(msg) {
+			sent++
+		} else {
+			skipped++
+		}
+	}
+	return sent, skipped
+}
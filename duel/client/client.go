@@ -0,0 +1,107 @@
+// Package client implements a client for the Duel server.
+package client
+
+import (
+	"encoding"
+	"errors"
+
+	"victorz.ca/gameserv/common/gameclient"
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/duel/codec"
+)
+
+// ErrMessage is returned by Err when the server sent a malformed message.
+var ErrMessage = codec.ErrMessage
+
+// Event is a message from the server, which is one of the event types of this package.
+type Event = codec.ServerMessage
+
+// Events are the messages of the codec.
+type (
+	Accept       = codec.Accept
+	Message      = codec.Message
+	Welcome      = codec.Welcome
+	PlayerInfo   = codec.PlayerInfo
+	Enter        = codec.Enter
+	EnterBot     = codec.EnterBot
+	Leave        = codec.Leave
+	PlayerState  = codec.PlayerState
+	WorldState   = codec.WorldState
+	Death        = codec.Death
+	PingTime     = codec.PingTime
+	Ping         = codec.Ping
+	Restart      = codec.Restart
+	Reconnecting = codec.Reconnecting
+	Reconnected  = codec.Reconnected
+)
+
+// Client is a connection to a Duel server.
+type Client struct {
+	*gameclient.Client[Event]
+}
+
+// Dial connects to a Duel server at a WebSocket URL and joins the game.
+func Dial(url, name string, color uint8) (*Client, error) {
+	c, err := gameclient.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return New(c, name, color)
+}
+
+// New joins the game over a connection, with the latest version of the protocol.
+func New(c gameserver.Conn, name string, color uint8) (*Client, error) {
+	return start(c, func(cl *Client) error {
+		return cl.send(codec.Hello{Color: color, Name: []byte(name), Handshake: codec.Protocol.Latest()})
+	})
+}
+
+// Resume resumes a session over a new connection.
+func Resume(c gameserver.Conn, token gameserver.ResumeToken) (*Client, error) {
+	return start(c, func(cl *Client) error { return cl.SendText([]byte(token.String())) })
+}
+
+func start(c gameserver.Conn, hello func(*Client) error) (*Client, error) {
+	cl := &Client{gameclient.New[Event](c)}
+	if err := hello(cl); err != nil {
+		c.Close()
+		return nil, err
+	}
+	go cl.Run(cl.decode)
+	return cl, nil
+}
+
+// Move sets the destination of the player.
+func (c *Client) Move(x, y float64) error {
+	return c.send(codec.Move{X: x, Y: y})
+}
+
+// Spawn asks to be spawned, or not.
+func (c *Client) Spawn(want bool) error {
+	return c.send(codec.Spawn{Want: want})
+}
+
+func (c *Client) send(m encoding.BinaryMarshaler) error {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return c.Send(b)
+}
+
+func (c *Client) decode(b []byte) (Event, bool, error) {
+	e, err := codec.Decode(b)
+	if errors.Is(err, codec.ErrOpcode) {
+		// unknown messages are skipped
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if p, ok := e.(Ping); ok {
+		// answer with the timestamp
+		if err := c.send(codec.Pong{Time: p.Time}); err != nil {
+			return nil, false, err
+		}
+	}
+	return e, true, nil
+}
@@ -0,0 +1,561 @@
+// Package codec encodes and decodes the messages of the Duel protocol.
+//
+// Every message is a binary WebSocket message. Messages from the server
+// start with an opcode. Messages from the client are told apart by length:
+// the first message is a Hello, then 8 bytes is a Pong, 4 bytes is a Move,
+// and 1 byte is a Spawn. Integers are big-endian.
+//
+// The Hello of a client may carry its protocol version and capabilities
+// (see gameserver.HelloMagic). Such clients receive an Accept before the Welcome.
+// Version 1 has the same messages as legacy clients, and Messages for
+// clients with CapMessage.
+package codec
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"victorz.ca/gameserv/common/gameserver"
+)
+
+// Errors returned by UnmarshalBinary and Decode.
+var (
+	ErrMessage = errors.New("duel: malformed message")
+	ErrOpcode  = errors.New("duel: unknown opcode")
+)
+
+// Protocol is the versions and capabilities of the server.
+// Legacy clients have no capabilities: they cannot resume their sessions.
+var Protocol = gameserver.Protocol{
+	MinVersion: 1,
+	MaxVersion: 1,
+	Caps:       CapResume | CapMessage,
+	Legacy:     0,
+}
+
+// Capabilities
+const (
+	// CapResume is a client that resumes its session after losing its connection.
+	CapResume gameserver.Caps = 1 << iota
+	// CapMessage is a client that shows messages from the server operators.
+	// Other clients do not receive Messages.
+	CapMessage
+)
+
+// World size, which positions are scaled to. It is the arena of the game.
+const (
+	MaxX = 1600.0
+	MaxY = 900.0
+)
+
+// Opcodes of server messages
+const (
+	OpWelcome byte = iota
+	OpEnter
+	OpEnterBot
+	OpLeave
+	OpWorldState
+	OpDeath
+	OpPingTime
+	OpPing
+	OpRestart
+	OpReconnecting
+	OpReconnected
+	OpAccept
+	OpMessage
+)
+
+// ServerMessage is a message from the server.
+type ServerMessage interface {
+	encoding.BinaryMarshaler
+	Opcode() byte
+}
+
+// Welcome tells a player its slot, and the token to resume its session.
+// Legacy clients only receive the slot: the token is only sent
+// if it is not zero, to clients with CapResume.
+//
+//	[0] [slot]
+//	[0] [slot] [token: 16]
+type Welcome struct {
+	Slot  int
+	Token gameserver.ResumeToken
+}
+
+// PlayerInfo describes a player that entered the game.
+//
+//	[op] [slot] [kills: 4] [deaths: 4] [combo: 4] [score: 4] [color] [name...]
+type PlayerInfo struct {
+	Slot                        int
+	Color                       uint8
+	Kills, Deaths, Combo, Score uint
+	Name                        string
+}
+
+// Enter is a remote player that entered the game.
+type Enter struct{ PlayerInfo }
+
+// EnterBot is a bot that entered the game.
+type EnterBot struct{ PlayerInfo }
+
+// Leave is a player that left the game.
+//
+//	[3] [slot]
+type Leave struct{ Slot int }
+
+// PlayerState is the state of a living player in a WorldState.
+//
+//	[slot] [x: 2] [y: 2] [dx: 2] [dy: 2] [mass: 4]
+//
+// Positions are scaled from [0, MaxX] and [0, MaxY] to [0, 0xFFFF].
+type PlayerState struct {
+	Slot         int
+	X, Y, DX, DY float64 // position and destination
+	Mass         uint
+}
+
+// WorldState is the state of the living players.
+//
+//	[4] [PlayerState: 13]...
+type WorldState struct{ Players []PlayerState }
+
+// Death is a player killed by another player.
+//
+//	[5] [killer] [victim]
+type Death struct{ Killer, Victim int }
+
+// PingTime is the ping of the player measured by the server.
+//
+//	[6] [milliseconds: 2]
+type PingTime struct{ Ping time.Duration }
+
+// Ping is a ping from the server, which the client answers with a Pong.
+//
+//	[7] [unix nanoseconds: 8]
+type Ping struct{ Time time.Time }
+
+// Restart tells players that the server restarts after a time.
+//
+//	[8] [seconds: 2]
+type Restart struct{ In time.Duration }
+
+// Reconnecting is a player that lost its connection, whose slot is kept.
+//
+//	[9] [slot]
+type Reconnecting struct{ Slot int }
+
+// Reconnected is a player that resumed its session.
+//
+//	[10] [slot]
+type Reconnected struct{ Slot int }
+
+// Accept is the handshake of the connection, which answers a versioned Hello.
+//
+//	[11] [version] [capabilities: 2]
+type Accept struct{ gameserver.Handshake }
+
+// Message is a message from the server operators, shown to players.
+//
+//	[12] [UTF-8 text...]
+type Message struct{ Text string }
+
+// Hello is the first message from a client.
+// After UnmarshalBinary, Name refers to the decoded bytes.
+//
+//	[color] [name...]
+//	[color] [HelloMagic] [version] [capabilities: 2] [name...]
+//
+// A zero Handshake is a legacy hello.
+type Hello struct {
+	Color     uint8
+	Name      []byte
+	Handshake gameserver.Handshake
+}
+
+// Move sets the destination of the player.
+//
+//	[x: 2] [y: 2]
+type Move struct{ X, Y float64 }
+
+// Spawn asks to be spawned, or not.
+//
+//	[want]
+type Spawn struct{ Want bool }
+
+// Pong answers a Ping with its time.
+//
+//	[unix nanoseconds: 8]
+type Pong struct{ Time time.Time }
+
+func (Welcome) Opcode() byte      { return OpWelcome }
+func (Enter) Opcode() byte        { return OpEnter }
+func (EnterBot) Opcode() byte     { return OpEnterBot }
+func (Leave) Opcode() byte        { return OpLeave }
+func (WorldState) Opcode() byte   { return OpWorldState }
+func (Death) Opcode() byte        { return OpDeath }
+func (PingTime) Opcode() byte     { return OpPingTime }
+func (Ping) Opcode() byte         { return OpPing }
+func (Restart) Opcode() byte      { return OpRestart }
+func (Reconnecting) Opcode() byte { return OpReconnecting }
+func (Reconnected) Opcode() byte  { return OpReconnected }
+func (Accept) Opcode() byte       { return OpAccept }
+func (Message) Opcode() byte      { return OpMessage }
+
+// Decode decodes a message from the server.
+func Decode(b []byte) (ServerMessage, error) {
+	if len(b) == 0 {
+		return nil, ErrMessage
+	}
+	switch b[0] {
+	case OpWelcome:
+		return decode[Welcome](b)
+	case OpEnter:
+		return decode[Enter](b)
+	case OpEnterBot:
+		return decode[EnterBot](b)
+	case OpLeave:
+		return decode[Leave](b)
+	case OpWorldState:
+		return decode[WorldState](b)
+	case OpDeath:
+		return decode[Death](b)
+	case OpPingTime:
+		return decode[PingTime](b)
+	case OpPing:
+		return decode[Ping](b)
+	case OpRestart:
+		return decode[Restart](b)
+	case OpReconnecting:
+		return decode[Reconnecting](b)
+	case OpReconnected:
+		return decode[Reconnected](b)
+	case OpAccept:
+		return decode[Accept](b)
+	case OpMessage:
+		return decode[Message](b)
+	}
+	return nil, ErrOpcode
+}
+
+func decode[M ServerMessage, PM interface {
+	*M
+	encoding.BinaryUnmarshaler
+}](b []byte) (ServerMessage, error) {
+	var m M
+	if err := PM(&m).UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// scale maps v in [0, max] to [0, 0xFFFF], truncating like legacy servers.
+func scale(v, max float64) uint16 {
+	return uint16(math.Max(0, math.Min(v, max)) * (0xFFFF / max))
+}
+
+// unscale maps u in [0, 0xFFFF] to [0, max].
+func unscale(u uint16, max float64) float64 {
+	return float64(u) * (max / 0xFFFF)
+}
+
+// seconds rounds d up to whole seconds that fit in 16 bits.
+func seconds(d time.Duration) uint16 {
+	secs := (d + time.Second - 1) / time.Second
+	if secs < 0 {
+		secs = 0
+	} else if secs > 0xFFFF {
+		secs = 0xFFFF
+	}
+	return uint16(secs)
+}
+
+// header checks the opcode and length of a server message,
+// and returns the rest of the message.
+func header(b []byte, op byte, n int) ([]byte, error) {
+	if len(b) < 1+n || b[0] != op {
+		return nil, ErrMessage
+	}
+	return b[1:], nil
+}
+
+func (m Welcome) MarshalBinary() ([]byte, error) {
+	if m.Token == (gameserver.ResumeToken{}) {
+		return []byte{OpWelcome, byte(m.Slot)}, nil
+	}
+	b := make([]byte, 2+len(m.Token))
+	b[0] = OpWelcome
+	b[1] = byte(m.Slot)
+	copy(b[2:], m.Token[:])
+	return b, nil
+}
+
+// UnmarshalBinary decodes a Welcome. The token is zero if it is missing.
+func (m *Welcome) UnmarshalBinary(b []byte) error {
+	b, err := header(b, OpWelcome, 1)
+	if err != nil {
+		return err
+	}
+	*m = Welcome{Slot: int(b[0])}
+	copy(m.Token[:], b[1:])
+	return nil
+}
+
+func (m PlayerInfo) marshal(op byte) []byte {
+	b := make([]byte, 19+len(m.Name))
+	b[0] = op
+	b[1] = byte(m.Slot)
+	binary.BigEndian.PutUint32(b[2:], uint32(m.Kills))
+	binary.BigEndian.PutUint32(b[6:], uint32(m.Deaths))
+	binary.BigEndian.PutUint32(b[10:], uint32(m.Combo))
+	binary.BigEndian.PutUint32(b[14:], uint32(m.Score))
+	b[18] = m.Color
+	copy(b[19:], m.Name)
+	return b
+}
+
+func (m *PlayerInfo) unmarshal(b []byte, op byte) error {
+	b, err := header(b, op, 18)
+	if err != nil {
+		return err
+	}
+	*m = PlayerInfo{
+		Slot:   int(b[0]),
+		Kills:  uint(binary.BigEndian.Uint32(b[1:])),
+		Deaths: uint(binary.BigEndian.Uint32(b[5:])),
+		Combo:  uint(binary.BigEndian.Uint32(b[9:])),
+		Score:  uint(binary.BigEndian.Uint32(b[13:])),
+		Color:  b[17],
+		Name:   string(b[18:]),
+	}
+	return nil
+}
+
+func (m Enter) MarshalBinary() ([]byte, error)     { return m.marshal(OpEnter), nil }
+func (m *Enter) UnmarshalBinary(b []byte) error    { return m.unmarshal(b, OpEnter) }
+func (m EnterBot) MarshalBinary() ([]byte, error)  { return m.marshal(OpEnterBot), nil }
+func (m *EnterBot) UnmarshalBinary(b []byte) error { return m.unmarshal(b, OpEnterBot) }
+
+// Slot messages
+//
+//	[op] [slot]
+
+func marshalSlot(op byte, slot int) ([]byte, error) {
+	return []byte{op, byte(slot)}, nil
+}
+
+func unmarshalSlot(b []byte, op byte, slot *int) error {
+	b, err := header(b, op, 1)
+	if err == nil {
+		*slot = int(b[0])
+	}
+	return err
+}
+
+func (m Leave) MarshalBinary() ([]byte, error)        { return marshalSlot(OpLeave, m.Slot) }
+func (m *Leave) UnmarshalBinary(b []byte) error       { return unmarshalSlot(b, OpLeave, &m.Slot) }
+func (m Reconnecting) MarshalBinary() ([]byte, error) { return marshalSlot(OpReconnecting, m.Slot) }
+func (m *Reconnecting) UnmarshalBinary(b []byte) error {
+	return unmarshalSlot(b, OpReconnecting, &m.Slot)
+}
+func (m Reconnected) MarshalBinary() ([]byte, error) { return marshalSlot(OpReconnected, m.Slot) }
+func (m *Reconnected) UnmarshalBinary(b []byte) error {
+	return unmarshalSlot(b, OpReconnected, &m.Slot)
+}
+
+func (m WorldState) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 1+13*len(m.Players))
+	b[0] = OpWorldState
+	for i, p := range m.Players {
+		pb := b[1+13*i:]
+		pb[0] = byte(p.Slot)
+		binary.BigEndian.PutUint16(pb[1:], scale(p.X, MaxX))
+		binary.BigEndian.PutUint16(pb[3:], scale(p.Y, MaxY))
+		binary.BigEndian.PutUint16(pb[5:], scale(p.DX, MaxX))
+		binary.BigEndian.PutUint16(pb[7:], scale(p.DY, MaxY))
+		binary.BigEndian.PutUint32(pb[9:], uint32(p.Mass))
+	}
+	return b, nil
+}
+
+func (m *WorldState) UnmarshalBinary(b []byte) error {
+	b, err := header(b, OpWorldState, 0)
+	if err != nil {
+		return err
+	}
+	if len(b)%13 != 0 {
+		return ErrMessage
+	}
+	m.Players = make([]PlayerState, len(b)/13)
+	for i := range m.Players {
+		pb := b[13*i:]
+		m.Players[i] = PlayerState{
+			Slot: int(pb[0]),
+			X:    unscale(binary.BigEndian.Uint16(pb[1:]), MaxX),
+			Y:    unscale(binary.BigEndian.Uint16(pb[3:]), MaxY),
+			DX:   unscale(binary.BigEndian.Uint16(pb[5:]), MaxX),
+			DY:   unscale(binary.BigEndian.Uint16(pb[7:]), MaxY),
+			Mass: uint(binary.BigEndian.Uint32(pb[9:])),
+		}
+	}
+	return nil
+}
+
+func (m Death) MarshalBinary() ([]byte, error) {
+	return []byte{OpDeath, byte(m.Killer), byte(m.Victim)}, nil
+}
+
+func (m *Death) UnmarshalBinary(b []byte) error {
+	b, err := header(b, OpDeath, 2)
+	if err != nil {
+		return err
+	}
+	*m = Death{int(b[0]), int(b[1])}
+	return nil
+}
+
+func (m PingTime) MarshalBinary() ([]byte, error) {
+	ms := m.Ping / time.Millisecond
+	if ms > 0xFFFF {
+		ms = 0xFFFF
+	}
+	b := make([]byte, 3)
+	b[0] = OpPingTime
+	binary.BigEndian.PutUint16(b[1:], uint16(ms))
+	return b, nil
+}
+
+func (m *PingTime) UnmarshalBinary(b []byte) error {
+	b, err := header(b, OpPingTime, 2)
+	if err != nil {
+		return err
+	}
+	m.Ping = time.Duration(binary.BigEndian.Uint16(b)) * time.Millisecond
+	return nil
+}
+
+func (m Ping) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 9)
+	b[0] = OpPing
+	binary.BigEndian.PutUint64(b[1:], uint64(m.Time.UnixNano()))
+	return b, nil
+}
+
+func (m *Ping) UnmarshalBinary(b []byte) error {
+	b, err := header(b, OpPing, 8)
+	if err != nil {
+		return err
+	}
+	m.Time = time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+	return nil
+}
+
+func (m Restart) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 3)
+	b[0] = OpRestart
+	binary.BigEndian.PutUint16(b[1:], seconds(m.In))
+	return b, nil
+}
+
+func (m *Restart) UnmarshalBinary(b []byte) error {
+	b, err := header(b, OpRestart, 2)
+	if err != nil {
+		return err
+	}
+	m.In = time.Duration(binary.BigEndian.Uint16(b)) * time.Second
+	return nil
+}
+
+func (m Accept) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4)
+	b[0] = OpAccept
+	b[1] = m.Version
+	binary.BigEndian.PutUint16(b[2:], uint16(m.Caps))
+	return b, nil
+}
+
+func (m *Accept) UnmarshalBinary(b []byte) error {
+	b, err := header(b, OpAccept, 3)
+	if err != nil {
+		return err
+	}
+	m.Version = b[0]
+	m.Caps = gameserver.Caps(binary.BigEndian.Uint16(b[1:]))
+	return nil
+}
+
+func (m Message) MarshalBinary() ([]byte, error) {
+	return append([]byte{OpMessage}, m.Text...), nil
+}
+
+func (m *Message) UnmarshalBinary(b []byte) error {
+	b, err := header(b, OpMessage, 0)
+	if err != nil {
+		return err
+	}
+	m.Text = string(b)
+	return nil
+}
+
+func (m Hello) MarshalBinary() ([]byte, error) {
+	return append(m.Handshake.AppendHello([]byte{m.Color}), m.Name...), nil
+}
+
+func (m *Hello) UnmarshalBinary(b []byte) error {
+	if len(b) < 1 {
+		return ErrMessage
+	}
+	h, name, err := gameserver.CutHello(b[1:])
+	if err != nil {
+		return ErrMessage
+	}
+	*m = Hello{Color: b[0], Name: name, Handshake: h}
+	return nil
+}
+
+func (m Move) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint16(b, scale(m.X, MaxX))
+	binary.BigEndian.PutUint16(b[2:], scale(m.Y, MaxY))
+	return b, nil
+}
+
+func (m *Move) UnmarshalBinary(b []byte) error {
+	if len(b) != 4 {
+		return ErrMessage
+	}
+	m.X = unscale(binary.BigEndian.Uint16(b), MaxX)
+	m.Y = unscale(binary.BigEndian.Uint16(b[2:]), MaxY)
+	return nil
+}
+
+func (m Spawn) MarshalBinary() ([]byte, error) {
+	if m.Want {
+		return []byte{1}, nil
+	}
+	return []byte{0}, nil
+}
+
+func (m *Spawn) UnmarshalBinary(b []byte) error {
+	if len(b) != 1 {
+		return ErrMessage
+	}
+	m.Want = b[0] != 0
+	return nil
+}
+
+func (m Pong) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(m.Time.UnixNano()))
+	return b, nil
+}
+
+func (m *Pong) UnmarshalBinary(b []byte) error {
+	if len(b) != 8 {
+		return ErrMessage
+	}
+	m.Time = time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+	return nil
+}
@@ -0,0 +1,163 @@
+package codec
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"victorz.ca/gameserv/common/gameserver"
+)
+
+var token = [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+// serverMessages are messages whose values survive encoding exactly.
+var serverMessages = []ServerMessage{
+	Welcome{Slot: 3, Token: token},
+	Welcome{Slot: 255},
+	Enter{PlayerInfo{Slot: 1, Color: 7, Kills: 2, Deaths: 3, Combo: 4, Score: 5, Name: "alice"}},
+	EnterBot{PlayerInfo{Slot: 2, Color: 0xFF, Kills: 1 << 31, Name: ""}},
+	Leave{Slot: 9},
+	WorldState{Players: []PlayerState{}},
+	WorldState{Players: []PlayerState{
+		{Slot: 0, X: 0, Y: 0, DX: MaxX, DY: MaxY, Mass: 400},
+		{Slot: 15, X: MaxX, Y: MaxY, DX: 0, DY: 0, Mass: 1 << 20},
+	}},
+	Death{Killer: 4, Victim: 5},
+	PingTime{Ping: 123 * time.Millisecond},
+	Ping{Time: time.Unix(0, 1700000000123456789)},
+	Restart{In: 30 * time.Second},
+	Reconnecting{Slot: 6},
+	Reconnected{Slot: 7},
+	Accept{gameserver.Handshake{Version: 1, Caps: CapResume}},
+	Message{Text: "server restarts at 12:00 ✓"},
+	Message{},
+}
+
+func TestServerRoundTrip(t *testing.T) {
+	for _, m := range serverMessages {
+		b, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%T: %v", m, err)
+		}
+		if b[0] != m.Opcode() {
+			t.Errorf("%T: opcode %d, want %d", m, b[0], m.Opcode())
+		}
+		got, err := Decode(b)
+		if err != nil {
+			t.Fatalf("%T: %v", m, err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("round trip of %#v gave %#v", m, got)
+		}
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	tests := []struct {
+		m   encoding.BinaryMarshaler
+		new func() encoding.BinaryUnmarshaler
+	}{
+		{Hello{Color: 5, Name: []byte("bob")}, func() encoding.BinaryUnmarshaler { return new(Hello) }},
+		{Hello{Color: 5, Name: []byte("bob"), Handshake: gameserver.Handshake{Version: 1, Caps: CapResume}}, func() encoding.BinaryUnmarshaler { return new(Hello) }},
+		{Move{X: MaxX, Y: 0}, func() encoding.BinaryUnmarshaler { return new(Move) }},
+		{Spawn{Want: true}, func() encoding.BinaryUnmarshaler { return new(Spawn) }},
+		{Spawn{Want: false}, func() encoding.BinaryUnmarshaler { return new(Spawn) }},
+		{Pong{Time: time.Unix(0, 42)}, func() encoding.BinaryUnmarshaler { return new(Pong) }},
+	}
+	for _, tt := range tests {
+		b, err := tt.m.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%T: %v", tt.m, err)
+		}
+		got := tt.new()
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%T: %v", tt.m, err)
+		}
+		if got := reflect.ValueOf(got).Elem().Interface(); !reflect.DeepEqual(got, tt.m) {
+			t.Errorf("round trip of %#v gave %#v", tt.m, got)
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	// coordinates out of the world are clamped, and others are within one step
+	m := Move{X: -10, Y: MaxY * 2}
+	b, _ := m.MarshalBinary()
+	var got Move
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.X != 0 || got.Y != MaxY {
+		t.Errorf("got %v, want clamped", got)
+	}
+
+	m = Move{X: 123.456, Y: 789.012}
+	b, _ = m.MarshalBinary()
+	got.UnmarshalBinary(b)
+	if d := got.X - m.X; d > MaxX/0xFFFF || d < -MaxX/0xFFFF {
+		t.Errorf("X = %v, want %v", got.X, m.X)
+	}
+	if d := got.Y - m.Y; d > MaxY/0xFFFF || d < -MaxY/0xFFFF {
+		t.Errorf("Y = %v, want %v", got.Y, m.Y)
+	}
+
+	// coordinates are truncated like legacy servers
+	for _, v := range []float64{0.01, 123.456, 450.5, 899.99} {
+		b, _ := Move{X: v, Y: v}.MarshalBinary()
+		if x, want := binary.BigEndian.Uint16(b), uint16(v*(0xFFFF/MaxX)); x != want {
+			t.Errorf("x %v sent as %d, want %d", v, x, want)
+		}
+		if y, want := binary.BigEndian.Uint16(b[2:]), uint16(v*(0xFFFF/MaxY)); y != want {
+			t.Errorf("y %v sent as %d, want %d", v, y, want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		b   []byte
+		err error
+	}{
+		{nil, ErrMessage},
+		{[]byte{OpWelcome}, ErrMessage},
+		{[]byte{OpEnter, 1, 2}, ErrMessage},
+		{[]byte{OpWorldState, 1}, ErrMessage},
+		{[]byte{OpPing, 1, 2, 3}, ErrMessage},
+		{[]byte{200}, ErrOpcode},
+	}
+	for _, tt := range tests {
+		if _, err := Decode(tt.b); !errors.Is(err, tt.err) {
+			t.Errorf("Decode(%v) = %v, want %v", tt.b, err, tt.err)
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, m := range serverMessages {
+		b, _ := m.MarshalBinary()
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		m, err := Decode(b)
+		if err != nil {
+			return
+		}
+		// decoded messages encode to a message that decodes the same
+		b2, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2, err := Decode(b2)
+		if err != nil {
+			t.Fatalf("%v: %v", b2, err)
+		}
+		b3, _ := m2.MarshalBinary()
+		if !bytes.Equal(b2, b3) {
+			t.Errorf("%v encodes to %v then %v", b, b2, b3)
+		}
+	})
+}
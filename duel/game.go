@@ -1,8 +1,15 @@
 package duel
 
 import (
+	"context"
+	"log/slog"
+	"math/rand"
 	"sync"
 	"time"
+
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/common/metrics"
+	"victorz.ca/gameserv/common/tick"
 )
 
 // Timing constants
@@ -17,6 +24,8 @@ const (
 	NETW_TIME = time.Second / NETW_FPS
 	// Interval of pings
 	PING_TIME = 250 * time.Millisecond
+	// Maximum physics frames run at once to catch up
+	MAX_CATCHUP = 5
 )
 
 // Limits
@@ -28,7 +37,7 @@ const (
 )
 
 // A server should have one Game instance,
-// and execute Game.Run() in a new goroutine.
+// and execute Game.Run(ctx) in a new goroutine.
 type Game struct {
 	players [MAX_PL]Player
 	pLock   sync.Mutex
@@ -36,23 +45,59 @@ type Game struct {
 	pCount     int // current number of players
 	pCountLock sync.Mutex
 
-	gameStart      time.Time
-	lastPhysics    time.Time
-	lastWorldState time.Time
-	nextPing       time.Time
+	gameStart time.Time
+	sched     *tick.Scheduler
+	seed      int64
+
+	// Rand makes the random choices of the game, such as spawn positions,
+	// the winners of collisions and the colors of bots.
+	// It must only be used with the game lock held.
+	Rand *rand.Rand
+	// Clock returns the current time of the game. It defaults to time.Now.
+	Clock func() time.Time
+
+	// TickDurations records how long each server slice takes.
+	TickDurations *metrics.Histogram
+	// Logger receives game events such as kills.
+	Logger *slog.Logger
 }
 
+// NewGame makes a game with a random seed.
 func NewGame() *Game {
+	return NewGameSeed(rand.Int63())
+}
+
+// NewGameSeed makes a game whose random choices are made from seed,
+// so that a game with the same seed and inputs plays the same.
+func NewGameSeed(seed int64) *Game {
 	var g Game
+	g.TickDurations = metrics.NewHistogram(metrics.DurationBuckets)
+	g.Logger = slog.Default()
+	g.seed = seed
+	g.Rand = rand.New(rand.NewSource(seed))
+	g.Clock = time.Now
 	for i := 0; i < BOT_BALANCE; i++ {
-		g.players[i].InitBot()
+		g.players[i].InitBot(g.Rand)
 	}
+	g.sched = tick.New(
+		tick.Config{
+			PhysicsInterval: PHYS_TIME,
+			NetworkInterval: NETW_TIME,
+			PingInterval:    PING_TIME,
+			MaxCatchUp:      MAX_CATCHUP,
+			Clock:           func() time.Time { return g.Clock() },
+		},
+		g.PhysicsFrame,
+		func() { g.Broadcast(buildWorldState(&g)) },
+		func() { g.Broadcast(MsgPing()) },
+	)
 	return &g
 }
 
-// AddPlayer adds a remotely-controlled player to the game and returns a Client,
-// or nil on failure.
-func (g *Game) AddPlayer(name []byte, col uint8) *Client {
+// AddPlayer adds a remotely-controlled player, whose connection has the
+// handshake hs, to the game and returns a Client, or nil on failure.
+// Messages to the Client are queued until its connection joins.
+func (g *Game) AddPlayer(name []byte, col uint8, hs gameserver.Handshake) *Client {
 	g.pLock.Lock()
 	defer g.pLock.Unlock()
 
@@ -61,27 +106,15 @@ func (g *Game) AddPlayer(name []byte, col uint8) *Client {
 		if !p.IsValid || p.Client == nil {
 			p.InitPlayer(name, col)
 
-			p.Client = newClient(g, i)
+			p.Client = newClient(g, i, p.Name)
+			p.Client.handshake = hs
 
-			p.Client.SendB(MsgWelcome(i))
+			g.sendWelcome(i)
 			msg := PrepareMessage(MsgEnter(i, p.Color, 0, 0, 0, 0, p.Name))
 			for j := range g.players {
 				pp := &g.players[j]
-				if i == j || !pp.IsValid {
-					continue
-				} else if pp.Client != nil {
-					p.Client.SendB(MsgEnter(
-						j, pp.Color,
-						pp.Kills, pp.Deaths, pp.Combo, pp.Score,
-						pp.Name,
-					))
+				if i != j && pp.IsValid && pp.Client != nil {
 					pp.Client.Send(msg)
-				} else {
-					p.Client.SendB(MsgEnterBot(
-						j, pp.Color,
-						pp.Kills, pp.Deaths, pp.Combo, pp.Score,
-						pp.Name,
-					))
 				}
 			}
 
@@ -96,6 +129,83 @@ func (g *Game) AddPlayer(name []byte, col uint8) *Client {
 	return nil
 }
 
+// sendWelcome sends the welcome message and the other players to player cn.
+// The game lock must be held.
+func (g *Game) sendWelcome(cn int) {
+	c := g.players[cn].Client
+	var token gameserver.ResumeToken
+	if c.CanResume() {
+		token = c.token
+	}
+	c.SendB(MsgWelcome(cn, token))
+	for j := range g.players {
+		pp := &g.players[j]
+		if cn == j || !pp.IsValid {
+			continue
+		} else if pp.Client != nil {
+			c.SendB(MsgEnter(
+				j, pp.Color,
+				pp.Kills, pp.Deaths, pp.Combo, pp.Score,
+				pp.Name,
+			))
+		} else {
+			c.SendB(MsgEnterBot(
+				j, pp.Color,
+				pp.Kills, pp.Deaths, pp.Combo, pp.Score,
+				pp.Name,
+			))
+		}
+	}
+}
+
+// DetachPlayer keeps the slot of a player that lost its connection,
+// and tells the other players that it is reconnecting.
+// It returns the token to resume the session, or false if the player
+// has already left.
+func (g *Game) DetachPlayer(c *Client) (gameserver.ResumeToken, bool) {
+	g.pLock.Lock()
+	defer g.pLock.Unlock()
+
+	c.lock.Lock()
+	cn, token := c.cn, c.token
+	ok := cn != -1 && !c.away
+	c.conn, c.pending, c.away = nil, nil, true
+	c.lock.Unlock()
+	if !ok {
+		return token, false
+	}
+
+	// stop moving while away
+	p := &g.players[cn]
+	p.D = p.O
+	g.Broadcast(MsgReconnecting(cn))
+	return token, true
+}
+
+// ResumePlayer reattaches a detached player, whose messages are queued
+// until its new connection joins, and returns whether the player still
+// has its slot.
+func (g *Game) ResumePlayer(c *Client) bool {
+	g.pLock.Lock()
+	defer g.pLock.Unlock()
+
+	c.lock.Lock()
+	cn := c.cn
+	ok := cn != -1 && c.away
+	if ok {
+		c.away = false
+		c.token = gameserver.NewResumeToken()
+	}
+	c.lock.Unlock()
+	if !ok {
+		return false
+	}
+
+	g.sendWelcome(cn)
+	g.Broadcast(MsgReconnected(cn))
+	return true
+}
+
 // DelPlayer removes a player from the game.
 func (g *Game) DelPlayer(cn int) {
 	g.pLock.Lock()
@@ -113,7 +223,7 @@ func (g *Game) DelPlayer(cn int) {
 
 	if g.pCount < BOT_BALANCE {
 		// Replace with bot
-		p.InitBot()
+		p.InitBot(g.Rand)
 		msg = MsgEnterBot(cn, p.Color, 0, 0, 0, 0, p.Name)
 	} else {
 		// Remove player
@@ -135,41 +245,46 @@ func (g *Game) Broadcast(msg []byte) {
 }
 
 // serverslice periodically runs, and runs needed processing for the game.
-func (g *Game) serverslice() {
+func (g *Game) serverslice(now time.Time) bool {
 	g.pLock.Lock()
 	defer g.pLock.Unlock()
 
-	now := time.Now()
+	// Apply physics, send world state, and send pings
+	g.sched.Advance(now)
+	g.TickDurations.ObserveDuration(g.Clock().Sub(now))
+	return true
+}
 
-	// Apply physics
-	if now.After(g.lastPhysics) {
-		g.PhysicsFrame()
-		g.lastPhysics = g.lastPhysics.Add(PHYS_TIME)
-	}
+// Overruns returns how many times the game fell too far behind to catch up.
+func (g *Game) Overruns() uint64 {
+	return g.sched.Overruns()
+}
 
-	// Send world state
-	if now.After(g.lastWorldState) {
-		g.Broadcast(buildWorldState(g))
-		g.lastWorldState = g.lastWorldState.Add(NETW_TIME)
-	}
+// PlayerCounts returns the number of remote players and bots.
+func (g *Game) PlayerCounts() (humans, bots int) {
+	g.pLock.Lock()
+	defer g.pLock.Unlock()
 
-	// Send pings and ping results
-	if now.After(g.nextPing) {
-		g.Broadcast(MsgPing())
-		g.nextPing = now.Add(PING_TIME)
+	for i := range g.players {
+		p := &g.players[i]
+		if !p.IsValid {
+			continue
+		} else if p.Client != nil {
+			humans++
+		} else {
+			bots++
+		}
 	}
+	return
 }
 
-// Run is a loop that runs the game forever.
-func (g *Game) Run() {
-	// timers
-	now := time.Now()
-	g.gameStart = now
-	g.lastPhysics = now
-	g.lastWorldState = now
-	g.nextPing = now
-	for {
-		g.serverslice()
-		time.Sleep(10 * time.Millisecond)
-	}
+// Seed returns the seed of the random choices of the game.
+func (g *Game) Seed() int64 {
+	return g.seed
+}
+
+// Run is a loop that runs the game until ctx is cancelled.
+func (g *Game) Run(ctx context.Context) {
+	g.gameStart = g.Clock()
+	g.sched.Run(ctx, g.serverslice)
 }
@@ -3,91 +3,129 @@ package duel
 import (
 	"sync"
 
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/duel/codec"
+
 	"github.com/gorilla/websocket"
 )
 
-type WSWriter interface {
-	Write(c *websocket.Conn) error
-}
-
-// PrepareMessage tries to create a prepared message, but fallbacks
-// to a byte slice if it fails.
-func PrepareMessage(msg []byte) WSWriter {
-	const mt = websocket.BinaryMessage
-	pm, err := websocket.NewPreparedMessage(mt, msg)
-	if err == nil {
-		return WSPreparedWriter{pm}
+// PrepareMessage makes a binary message to send to many players,
+// which is prepared for WebSocket connections if possible.
+func PrepareMessage(b []byte) gameserver.Msg {
+	msg := gameserver.Msg{MsgType: gameserver.BinaryMessage, Payload: b}
+	if pm, err := websocket.NewPreparedMessage(msg.MsgType, b); err == nil {
+		msg.Prepared = pm
 	}
-	return WSByteWriter(msg)
-}
-
-type WSByteWriter []byte
-
-func (msg WSByteWriter) Write(c *websocket.Conn) error {
-	const mt = websocket.BinaryMessage
-	return c.WriteMessage(mt, msg)
-}
-
-type WSPreparedWriter struct{ *websocket.PreparedMessage }
-
-func (msg WSPreparedWriter) Write(c *websocket.Conn) error {
-	return c.WritePreparedMessage(msg.PreparedMessage)
+	return msg
 }
 
 type Client struct {
 	g    *Game
 	cn   int
-	Conn *websocket.Conn
+	name string
 	lock sync.Mutex
 	ping uint16
+
+	// conn queues the messages of the client once it has joined,
+	// and pending keeps them until then. Both are nil while reconnecting.
+	conn    *gameserver.BinaryPlayer[*Client]
+	pending []gameserver.Msg
+	away    bool
+
+	token     gameserver.ResumeToken
+	handshake gameserver.Handshake
 }
 
-// newClient makes a new Client for a specific game and client number.
-func newClient(g *Game, cn int) *Client {
+// newClient makes a new Client for a specific game, client number and name.
+func newClient(g *Game, cn int, name string) *Client {
 	return &Client{
-		g,
-		cn,
-		nil,
-		sync.Mutex{},
-		0xFFFF,
+		g:     g,
+		cn:    cn,
+		name:  name,
+		ping:  0xFFFF,
+		token: gameserver.NewResumeToken(),
 	}
 }
 
-// Send enqueues an outgoing message, or
-// on failure, closes the Player.
-func (c *Client) Send(msg WSWriter) {
+// Send enqueues an outgoing message. It never blocks, so it can be called
+// while holding the game lock. If the queue of the connection overflows,
+// the connection is closed.
+func (c *Client) Send(msg gameserver.Msg) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.send(msg)
+}
+
+// trySend calls Send, and returns false if the client is reconnecting or closed,
+// so the message is dropped.
+func (c *Client) trySend(msg gameserver.Msg) bool {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	return c.send(msg)
+}
 
-	if c.cn == -1 {
-		return
+// send is Send with the client lock held.
+func (c *Client) send(msg gameserver.Msg) bool {
+	if c.cn == -1 || c.away {
+		return false
 	}
 
-	if c.Conn != nil {
-		msg.Write(c.Conn)
+	if c.conn != nil {
+		c.conn.Player.Send(msg)
+	} else {
+		c.pending = append(c.pending, msg)
 	}
+	return true
 }
 
 // SendB calls Send for a byte slice.
 func (c *Client) SendB(msg []byte) {
-	c.Send(WSByteWriter(msg))
+	c.Send(gameserver.Msg{MsgType: gameserver.BinaryMessage, Payload: msg})
+}
+
+// attach queues the messages of the client on the connection of the player
+// that joined, starting with those sent since it was added or resumed.
+func (c *Client) attach(player *gameserver.BinaryPlayer[*Client]) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn = player
+	for _, msg := range c.pending {
+		player.Player.Send(msg)
+	}
+	c.pending = nil
+}
+
+// CanResume returns whether the client resumes its session after losing its connection.
+func (c *Client) CanResume() bool {
+	return c.handshake.Caps.Has(codec.CapResume)
+}
+
+// Reconnecting returns whether the client lost its connection and may resume.
+func (c *Client) Reconnecting() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.away
 }
 
 // Close prevents future received messages from being forwarded to the Game.
 // It is safe to call Close multiple times.
 func (c *Client) Close() {
 	c.lock.Lock()
-	defer c.lock.Unlock()
-
-	if c.cn != -1 {
-		c.g.DelPlayer(c.cn)
-		c.cn = -1
+	cn := c.cn
+	c.cn = -1
+	c.lock.Unlock()
+
+	// The game lock must not be acquired while holding the client lock,
+	// because the game sends messages while holding the game lock.
+	if cn != -1 {
+		c.g.DelPlayer(cn)
 	}
 }
 
 // LogNameEnter returns a name for logging when connecting.
 func (p *Client) LogNameEnter() string {
-	return p.g.players[p.cn].Name
+	return p.name
 }
 
 // LogNameLeave returns a name for logging when leaving.
@@ -1,15 +1,18 @@
 package duel
 
 import (
-	"math/rand"
+	"context"
+	"log/slog"
+
+	"victorz.ca/gameserv/duel/codec"
 )
 
 // Arena constants
 const (
 	// Width
-	MAX_W = 1600.0
+	MAX_W = codec.MaxX
 	// Height
-	MAX_H = 900.0
+	MAX_H = codec.MaxY
 )
 
 // Player constants
@@ -115,7 +118,7 @@ func (g *Game) checkCollision(a, b *Player, aCn, bCn int) {
 			p += 0.9
 		}
 	}
-	if rand.Float64() >= p {
+	if g.Rand.Float64() >= p {
 		// Player B wins
 		a, b = b, a
 		aCn, bCn = bCn, aCn
@@ -135,13 +138,33 @@ func (g *Game) checkCollision(a, b *Player, aCn, bCn int) {
 	b.Combo = 0
 	b.IsAlive = false
 	g.Broadcast(MsgDeath(aCn, bCn))
+	g.logKill(a, b, aCn, bCn)
+}
+
+// logKill logs a kill. Kills between bots are logged at the debug level.
+func (g *Game) logKill(killer, victim *Player, killerCn, victimCn int) {
+	level := slog.LevelInfo
+	if killer.Client == nil && victim.Client == nil {
+		level = slog.LevelDebug
+	}
+	g.Logger.LogAttrs(context.Background(), level, "kill",
+		slog.String("event", "kill"),
+		slog.Int("killer_slot", killerCn),
+		slog.String("killer", killer.Name),
+		slog.Bool("killer_bot", killer.Client == nil),
+		slog.Uint64("killer_mass", uint64(killer.M)),
+		slog.Uint64("killer_combo", uint64(killer.Combo)),
+		slog.Int("victim_slot", victimCn),
+		slog.String("victim", victim.Name),
+		slog.Bool("victim_bot", victim.Client == nil),
+	)
 }
 
 func (g *Game) spawnPlayer(p *Player) {
 BRUTE_FORCE_SPAWN_POS:
 	for i := 0; i < 256; i++ {
-		p.O.X = rand.Float64() * MAX_W
-		p.O.Y = rand.Float64() * MAX_H
+		p.O.X = g.Rand.Float64() * MAX_W
+		p.O.Y = g.Rand.Float64() * MAX_H
 
 		for j := range g.players {
 			pp := &g.players[j]
@@ -59,11 +59,11 @@ func (p *Player) InitPlayer(name []byte, col uint8) {
 	p.Color = col
 }
 
-// InitBot initializes a bot-controlled Player.
-func (p *Player) InitBot() {
+// InitBot initializes a bot-controlled Player with a color chosen by rng.
+func (p *Player) InitBot(rng *rand.Rand) {
 	p.init()
 	p.Name = "" // randomName()
-	p.Color = uint8(rand.Intn(0x100))
+	p.Color = uint8(rng.Intn(0x100))
 }
 
 /*
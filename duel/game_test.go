@@ -0,0 +1,26 @@
+package duel
+
+import "testing"
+
+// TestNewGameSeed checks that games with the same seed play the same.
+func TestNewGameSeed(t *testing.T) {
+	a, b := NewGameSeed(1), NewGameSeed(1)
+	kills := 0
+	for frame := 0; frame < 20*PHYS_FPS; frame++ {
+		a.PhysicsFrame()
+		b.PhysicsFrame()
+		for i := range a.players {
+			pa, pb := &a.players[i], &b.players[i]
+			if pa.O != pb.O || pa.M != pb.M || pa.Kills != pb.Kills || pa.Color != pb.Color {
+				t.Fatalf("frame %d: player %d differs: %v %d %d, %v %d %d",
+					frame, i, pa.O, pa.M, pa.Kills, pb.O, pb.M, pb.Kills)
+			}
+		}
+	}
+	for i := range a.players {
+		kills += int(a.players[i].Kills)
+	}
+	if kills == 0 {
+		t.Error("no collisions to compare")
+	}
+}
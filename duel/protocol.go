@@ -1,23 +1,25 @@
 package duel
 
 import (
-	"encoding/binary"
+	"encoding"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/duel/codec"
 )
 
-// processHello processes the first incoming message.
-func processHello(c *websocket.Conn) (name []byte, col uint8) {
-	mt, h, err := c.ReadMessage()
-
-	if mt != websocket.BinaryMessage || err != nil || len(h) < 1 {
+// processHello processes the first incoming message, when it is not a resume message,
+// and negotiates the handshake of the connection.
+func processHello(mt int, h []byte) (name []byte, col uint8, hs gameserver.Handshake, err error) {
+	var hello codec.Hello
+	if mt != gameserver.BinaryMessage || hello.UnmarshalBinary(h) != nil {
+		err = gameserver.ReasonProtocolError
 		return
 	}
-
-	name = h[1:]
-	col = h[0]
-	return
+	if hs, err = codec.Protocol.Negotiate(hello.Handshake); err != nil {
+		return
+	}
+	return hello.Name, hello.Color, hs, nil
 }
 
 // Recv processes incoming messages after the hello message.
@@ -25,14 +27,20 @@ func Recv(c *Client, msg []byte) {
 	c.g.pLock.Lock()
 	defer c.g.pLock.Unlock()
 
-	if c.cn == -1 {
+	c.lock.Lock()
+	cn := c.cn
+	c.lock.Unlock()
+	if cn == -1 {
 		return
 	}
 
-	if len(msg) == 8 {
+	var pong codec.Pong
+	var move codec.Move
+	var spawn codec.Spawn
+	if pong.UnmarshalBinary(msg) == nil {
 		// handle pongs
-		t := binary.BigEndian.Uint64(msg)
-		n := uint64(time.Now().UnixNano())
+		t := pong.Time.UnixNano()
+		n := time.Now().UnixNano()
 		if n >= t {
 			newPing := uint((n - t) / 1000000)
 			if c.ping != 0xFFFF {
@@ -41,15 +49,14 @@ func Recv(c *Client, msg []byte) {
 			c.ping = uint16(newPing)
 		}
 	} else {
-		p := &c.g.players[c.cn]
-		if len(msg) == 4 {
+		p := &c.g.players[cn]
+		if move.UnmarshalBinary(msg) == nil {
 			// movement
-			p.D.X = float64(binary.BigEndian.Uint16(msg)) * (MAX_W / 0xFFFF)
-			p.D.Y = float64(binary.BigEndian.Uint16(msg[2:])) * (MAX_H / 0xFFFF)
-		} else if len(msg) == 1 {
+			p.D.X = move.X
+			p.D.Y = move.Y
+		} else if spawn.UnmarshalBinary(msg) == nil {
 			// spawn
-			wantSpawn := msg[0] != 0
-			if wantSpawn {
+			if spawn.Want {
 				// TODO add to queue
 			} else {
 				// TODO remove from queue
@@ -58,80 +65,86 @@ func Recv(c *Client, msg []byte) {
 	}
 }
 
-func MsgWelcome(cn int) []byte {
-	return []byte{0, byte(cn)}
+// marshal encodes a message of the codec.
+func marshal(m encoding.BinaryMarshaler) []byte {
+	b, _ := m.MarshalBinary()
+	return b
 }
 
-func msgEnter(code, cn int, col uint8, k, d, c, s uint, name string) []byte {
-	b := make([]byte, 19+len(name))
-	b[0] = byte(code)
-	b[1] = byte(cn)
-	binary.BigEndian.PutUint32(b[2:], uint32(k))
-	binary.BigEndian.PutUint32(b[6:], uint32(d))
-	binary.BigEndian.PutUint32(b[10:], uint32(c))
-	binary.BigEndian.PutUint32(b[14:], uint32(s))
-	b[18] = col
-	copy(b[19:], name)
-	return b
+// MsgAccept tells a versioned client the handshake of its connection.
+func MsgAccept(hs gameserver.Handshake) []byte {
+	return marshal(codec.Accept{Handshake: hs})
+}
+
+// MsgWelcome tells a player its slot, and the token to resume its session
+// unless it is zero.
+func MsgWelcome(cn int, token gameserver.ResumeToken) []byte {
+	return marshal(codec.Welcome{Slot: cn, Token: token})
+}
+
+func playerInfo(cn int, col uint8, k, d, c, s uint, name string) codec.PlayerInfo {
+	return codec.PlayerInfo{Slot: cn, Color: col, Kills: k, Deaths: d, Combo: c, Score: s, Name: name}
 }
 
 func MsgEnter(cn int, col uint8, k, d, c, s uint, name string) []byte {
-	return msgEnter(1, cn, col, k, d, c, s, name)
+	return marshal(codec.Enter{PlayerInfo: playerInfo(cn, col, k, d, c, s, name)})
 }
 
 func MsgEnterBot(cn int, col uint8, k, d, c, s uint, name string) []byte {
-	return msgEnter(2, cn, col, k, d, c, s, name)
+	return marshal(codec.EnterBot{PlayerInfo: playerInfo(cn, col, k, d, c, s, name)})
 }
 
 func MsgLeave(cn int) []byte {
-	return []byte{3, byte(cn)}
+	return marshal(codec.Leave{Slot: cn})
 }
 
 func buildWorldState(g *Game) []byte {
-	// Pre-allocate size
-	n := uint(0)
-	for i := range g.players {
-		p := &g.players[i]
-		if p.IsAlive {
-			n++
-		}
-	}
-
-	// Build message
-	msg := make([]byte, n*13+1)
-	msg[0] = 4
-
-	n = 1
+	w := codec.WorldState{Players: make([]codec.PlayerState, 0, len(g.players))}
 	for i := range g.players {
 		p := &g.players[i]
 		if p.IsAlive {
-			b := msg[n:]
-			b[0] = byte(i)
-			binary.BigEndian.PutUint16(b[1:], uint16(p.O.X*(0xFFFF/MAX_W)))
-			binary.BigEndian.PutUint16(b[3:], uint16(p.O.Y*(0xFFFF/MAX_H)))
-			binary.BigEndian.PutUint16(b[5:], uint16(p.D.X*(0xFFFF/MAX_W)))
-			binary.BigEndian.PutUint16(b[7:], uint16(p.D.Y*(0xFFFF/MAX_H)))
-			binary.BigEndian.PutUint32(b[9:], uint32(p.M))
-			n += 13
+			w.Players = append(w.Players, codec.PlayerState{
+				Slot: i,
+				X:    p.O.X,
+				Y:    p.O.Y,
+				DX:   p.D.X,
+				DY:   p.D.Y,
+				Mass: p.M,
+			})
 		}
 	}
-
-	return msg
+	return marshal(w)
 }
 
 func MsgDeath(killer, victim int) []byte {
-	return []byte{5, byte(killer), byte(victim)}
+	return marshal(codec.Death{Killer: killer, Victim: victim})
 }
 
 func MsgPingTime(cn int, ping uint16) []byte {
-	b := [3]byte{6}
-	binary.BigEndian.PutUint16(b[1:], ping)
-	return b[:]
+	return marshal(codec.PingTime{Ping: time.Duration(ping) * time.Millisecond})
 }
 
 func MsgPing() []byte {
-	t := uint64(time.Now().UnixNano())
-	b := [9]byte{7}
-	binary.BigEndian.PutUint64(b[1:], t)
-	return b[:]
+	return marshal(codec.Ping{Time: time.Now()})
+}
+
+// MsgRestart tells players that the server restarts after the remaining time.
+func MsgRestart(remaining time.Duration) []byte {
+	return marshal(codec.Restart{In: remaining})
+}
+
+// MsgReconnecting tells players that a player lost its connection,
+// and keeps its slot while it reconnects.
+func MsgReconnecting(cn int) []byte {
+	return marshal(codec.Reconnecting{Slot: cn})
+}
+
+// MsgReconnected tells players that a player resumed its session.
+func MsgReconnected(cn int) []byte {
+	return marshal(codec.Reconnected{Slot: cn})
+}
+
+// MsgMessage is a message from the server operators.
+func MsgMessage(text string) []byte {
+	return marshal(codec.Message{Text: text})
 }
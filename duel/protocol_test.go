@@ -0,0 +1,71 @@
+package duel
+
+import (
+	"bytes"
+	"testing"
+
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/duel/codec"
+)
+
+func TestProcessHelloVersion(t *testing.T) {
+	tests := []struct {
+		h   []byte
+		hs  gameserver.Handshake
+		err error
+	}{
+		{[]byte("\x05alice"), gameserver.Handshake{}, nil},
+		{[]byte("\x05\xFF\x01\x00\x01alice"), gameserver.Handshake{Version: 1, Caps: codec.CapResume}, nil},
+		{[]byte("\x05\xFF\x01\xFF\xFEalice"), gameserver.Handshake{Version: 1, Caps: codec.CapMessage}, nil},
+		{[]byte("\x05\xFF\x02\x00\x01alice"), gameserver.Handshake{}, gameserver.ReasonUnsupportedVersion},
+		{[]byte("\x05\xFF\x01"), gameserver.Handshake{}, gameserver.ReasonProtocolError},
+	}
+	for _, tt := range tests {
+		name, _, hs, err := processHello(gameserver.BinaryMessage, tt.h)
+		if err != tt.err || hs != tt.hs {
+			t.Errorf("processHello(%q) = %v, %v, want %v, %v", tt.h, hs, err, tt.hs, tt.err)
+		}
+		if err == nil && string(name) != "alice" {
+			t.Errorf("processHello(%q) name = %q", tt.h, name)
+		}
+	}
+}
+
+func FuzzProcessHello(f *testing.F) {
+	f.Add(gameserver.BinaryMessage, []byte("\x05alice"))
+	f.Add(gameserver.BinaryMessage, []byte("\x05\xFF\x01\x00\x01alice"))
+	f.Add(gameserver.BinaryMessage, []byte{})
+	f.Add(gameserver.TextMessage, []byte("\x05alice"))
+	f.Fuzz(func(t *testing.T, mt int, h []byte) {
+		name, col, hs, err := processHello(mt, h)
+		if err != nil {
+			return
+		}
+		if mt != gameserver.BinaryMessage || len(h) == 0 {
+			t.Fatalf("accepted type %d message %v", mt, h)
+		}
+		if col != h[0] || !bytes.HasSuffix(h, name) {
+			t.Errorf("processHello(%v) = %q, %d", h, name, col)
+		}
+		if hs.IsLegacy() != (len(h) == 1+len(name)) {
+			t.Errorf("processHello(%v) = %q with handshake %v", h, name, hs)
+		}
+	})
+}
+
+func FuzzRecv(f *testing.F) {
+	f.Add([]byte{0xFF, 0xFF, 0, 0})
+	f.Add([]byte{1})
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0, 1})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		g := NewGame()
+		c := g.AddPlayer([]byte("fuzz"), 1, gameserver.Handshake{})
+		Recv(c, msg)
+
+		p := &g.players[c.cn]
+		if p.D.X < 0 || p.D.X > MAX_W || p.D.Y < 0 || p.D.Y > MAX_H {
+			t.Errorf("destination %v out of bounds", p.D)
+		}
+	})
+}
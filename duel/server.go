@@ -2,56 +2,147 @@
 package duel
 
 import (
-	"victorz.ca/gameserv/common/gameserver"
+	"context"
+	"log/slog"
+	"time"
 
-	"github.com/gorilla/websocket"
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/common/metrics"
 )
 
 // Server is a Duel game server.
 type Server struct {
+	// Responder ignores the events that the Server does not handle.
 	gameserver.Responder[*Client]
 	*gameserver.GameServerCount[Client]
 	*Game
+	gameserver.Lifecycle
+	// Sessions keeps the slots of players that lost their connection.
+	Sessions gameserver.Sessions[*Client]
+
+	metrics *gameserver.MetricsResponder[*Client]
 }
 
-// NewServer makes a new game server.
-func NewServer() Server {
+// NewServer makes a new game server that logs to logger.
+func NewServer(logger *slog.Logger) *Server {
 	const sendBufSize = 300 // enough for at least 2 seconds
 
-	var s Server
+	s := new(Server)
 	s.Game = NewGame()
+	s.Game.Logger = logger.With("game", "duel")
 
-	r := gameserver.DefaultResponder[Client]()
-	r = gameserver.NewLogCountResponder(r, &s)
-	s.Responder = r
-	s.GameServerCount = gameserver.NewGameServerCount[Client](&s, sendBufSize)
+	s.Responder = gameserver.DefaultResponder[Client]()
+	s.metrics = gameserver.NewMetricsResponder[*Client](nil, "duel")
+	s.GameServerCount = gameserver.NewGameServerCount[Client](sendBufSize, s,
+		s.metrics.Wrap,
+		gameserver.Slog[*Client](logger, "duel", s),
+	)
 	return s
 }
 
-// Run runs the game server. It should normally be called in its
-// own goroutine.
-func (s *Server) Run() {
-	// s.Game.Run()
+// Start runs the game in a new goroutine until ctx is cancelled
+// or Stop is called.
+func (s *Server) Start(ctx context.Context) {
+	s.Lifecycle.Start(ctx)
+	s.Go(s.Game.Run)
 }
 
-func (s *Server) PlayerInit(c *websocket.Conn) *Client {
-	return s.AddPlayer(processHello(c))
+// Shutdown drains the server, telling players when it restarts.
+// See gameserver.BaseGameServer.Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.GameServerCount.Shutdown(ctx, func(player *gameserver.BinaryPlayer[*Client], remaining time.Duration) {
+		player.Data.SendB(MsgRestart(remaining))
+	})
 }
 
-func (s *Server) PlayerJoined(c *websocket.Conn, player *gameserver.BinaryPlayer[*Client]) {
-	s.Responder.PlayerJoined(c, player)
+func (s *Server) PlayerInit(meta *gameserver.ConnMeta, c gameserver.Conn) (*Client, error) {
+	mt, h, err := c.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := gameserver.ResumeMessage(mt, h); ok {
+		return s.resume(token)
+	}
 
-	player.Data.Conn = c
+	name, col, hs, err := processHello(mt, h)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.CheckName(filterName(name)); err != nil {
+		return nil, err
+	}
+	if !hs.IsLegacy() {
+		// the accept precedes the welcome
+		if err := c.WriteMessage(gameserver.BinaryMessage, MsgAccept(hs)); err != nil {
+			return nil, err
+		}
+	}
+	client := s.AddPlayer(name, col, hs)
+	if client == nil {
+		return nil, gameserver.ReasonServerFull
+	}
+	return client, nil
 }
 
-func (s *Server) PlayerLeft(c *websocket.Conn, player *gameserver.BinaryPlayer[*Client]) {
-	player.Data.Close()
+// resume reattaches a player to the slot it had before losing its connection.
+func (s *Server) resume(token gameserver.ResumeToken) (*Client, error) {
+	client, ok := s.Sessions.Resume(token)
+	if !ok || !s.ResumePlayer(client) {
+		return nil, gameserver.ReasonSessionExpired
+	}
+	return client, nil
+}
 
-	s.Responder.PlayerLeft(c, player)
+// park keeps the slot of a player that lost its connection, so that
+// it can resume. It returns false if the player cannot resume.
+func (s *Server) park(player *gameserver.BinaryPlayer[*Client]) bool {
+	if s.Sessions.Grace <= 0 || !player.Reason().Resumable() || s.IsDraining() || !player.Data.CanResume() {
+		return false
+	}
+	token, ok := s.DetachPlayer(player.Data)
+	if ok {
+		s.Sessions.Park(token, player.Data, (*Client).Close)
+	}
+	return ok
 }
 
-func (s *Server) MessageReceived(player *gameserver.BinaryPlayer[*Client], msg []byte) {
-	s.Responder.MessageReceived(player, msg)
+// Name returns "duel", the name of the game.
+func (s *Server) Name() string { return "duel" }
+
+// Stats are the statistics of a duel server.
+type Stats struct {
+	Humans   int    `json:"humans"`
+	Bots     int    `json:"bots"`
+	Overruns uint64 `json:"tick_overruns"`
+}
+
+// Stats returns the statistics of the server.
+func (s *Server) Stats() any {
+	humans, bots := s.PlayerCounts()
+	return Stats{humans, bots, s.Overruns()}
+}
 
+// Collect writes the metrics of the server.
+func (s *Server) Collect(w *metrics.Writer) {
+	s.metrics.Collect(w)
+
+	humans, bots := s.PlayerCounts()
+	w.Gauge("gameserv_duel_players", "Number of duel players by kind.", float64(humans), "kind", "human")
+	w.Gauge("gameserv_duel_players", "Number of duel players by kind.", float64(bots), "kind", "bot")
+	w.Histogram("gameserv_tick_duration_seconds", "Time taken to process one game tick.", s.TickDurations, "game", "duel")
+	w.Counter("gameserv_tick_overruns_total", "Times the simulation fell too far behind to catch up.", s.Overruns(), "game", "duel")
+}
+
+func (s *Server) PlayerJoined(c gameserver.Conn, player *gameserver.BinaryPlayer[*Client]) {
+	player.Data.attach(player)
+}
+
+func (s *Server) PlayerLeft(c gameserver.Conn, player *gameserver.BinaryPlayer[*Client]) {
+	if !s.park(player) {
+		player.Data.Close()
+	}
+}
+
+func (s *Server) MessageReceived(player *gameserver.BinaryPlayer[*Client], msg []byte) {
 	Recv(player.Data, msg)
 }
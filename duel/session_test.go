@@ -0,0 +1,183 @@
+package duel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/duel/codec"
+)
+
+// newTestServer starts a server whose slots are kept for grace.
+func newTestServer(t *testing.T, grace time.Duration) *Server {
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s.Sessions.Grace = grace
+	s.Start(context.Background())
+	t.Cleanup(func() {
+		s.Stop()
+		s.Wait()
+	})
+	return s
+}
+
+// connect connects to s over a Pipe, and sends the first message.
+func connect(t *testing.T, s *Server, mt int, first []byte) gameserver.Conn {
+	t.Helper()
+	client, server := gameserver.Pipe(1024)
+	t.Cleanup(func() { client.Close() })
+	go s.ServeConn(server)
+	if err := client.WriteMessage(mt, first); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// join connects a player with a hello with the handshake hs,
+// which is a legacy hello if hs is zero.
+func join(t *testing.T, s *Server, name string, hs gameserver.Handshake) gameserver.Conn {
+	t.Helper()
+	hello := codec.Hello{Color: 1, Name: []byte(name)}
+	hello.Handshake = hs
+	b, _ := hello.MarshalBinary()
+	return connect(t, s, gameserver.BinaryMessage, b)
+}
+
+// resume connects with a resume message.
+func resume(t *testing.T, s *Server, token gameserver.ResumeToken) gameserver.Conn {
+	t.Helper()
+	return connect(t, s, gameserver.TextMessage, []byte(token.String()))
+}
+
+// expect reads messages from c until one of type T that is accepted
+// by match, if it is not nil, and returns it.
+func expect[T codec.ServerMessage](t *testing.T, c gameserver.Conn, match func(T) bool) T {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, b, err := c.ReadMessage()
+		if err != nil {
+			var zero T
+			t.Fatalf("read %v, want %T", err, zero)
+		}
+		m, err := codec.Decode(b)
+		if err != nil {
+			t.Fatalf("decode %v: %v", b, err)
+		}
+		if m, ok := m.(T); ok && (match == nil || match(m)) {
+			return m
+		}
+	}
+}
+
+// expectClose reads messages from c until it is closed with code.
+func expectClose(t *testing.T, c gameserver.Conn, code int) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := c.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) || ce.Code != code {
+			t.Fatalf("read %v, want close code %d", err, code)
+		}
+		return
+	}
+}
+
+func TestResume(t *testing.T) {
+	s := newTestServer(t, time.Second)
+	a := join(t, s, "alice", codec.Protocol.Latest())
+	welcome := expect[codec.Welcome](t, a, nil)
+	if welcome.Token == (gameserver.ResumeToken{}) {
+		t.Fatal("no token in the welcome of a client that can resume")
+	}
+	slot := welcome.Slot
+	b := join(t, s, "bob", codec.Protocol.Latest())
+	expect(t, a, func(m codec.Enter) bool { return m.Name == "bob" })
+
+	a.Close()
+	expect(t, b, func(m codec.Reconnecting) bool { return m.Slot == slot })
+
+	a = resume(t, s, welcome.Token)
+	resumed := expect[codec.Welcome](t, a, nil)
+	if resumed.Slot != slot {
+		t.Errorf("resumed in slot %d, want %d", resumed.Slot, slot)
+	}
+	if resumed.Token == welcome.Token || resumed.Token == (gameserver.ResumeToken{}) {
+		t.Errorf("resumed with token %v after %v, want a new token", resumed.Token, welcome.Token)
+	}
+	expect(t, a, func(m codec.Enter) bool { return m.Name == "bob" })
+	expect(t, b, func(m codec.Reconnected) bool { return m.Slot == slot })
+
+	// a token can only be used once
+	expectClose(t, resume(t, s, welcome.Token), gameserver.CloseSessionExpired)
+}
+
+func TestResumeWrongToken(t *testing.T) {
+	s := newTestServer(t, time.Second)
+	expectClose(t, resume(t, s, gameserver.NewResumeToken()), gameserver.CloseSessionExpired)
+}
+
+func TestResumeExpired(t *testing.T) {
+	s := newTestServer(t, 200*time.Millisecond)
+	a := join(t, s, "alice", codec.Protocol.Latest())
+	welcome := expect[codec.Welcome](t, a, nil)
+	b := join(t, s, "bob", codec.Protocol.Latest())
+	expect[codec.Welcome](t, b, nil)
+
+	a.Close()
+	expect(t, b, func(m codec.Reconnecting) bool { return m.Slot == welcome.Slot })
+	// the slot is given to a bot when the grace period ends
+	expect(t, b, func(m codec.EnterBot) bool { return m.Slot == welcome.Slot })
+
+	expectClose(t, resume(t, s, welcome.Token), gameserver.CloseSessionExpired)
+}
+
+func TestWelcomeWithoutResume(t *testing.T) {
+	s := newTestServer(t, time.Second)
+	c := join(t, s, "alice", gameserver.Handshake{Version: 1, Caps: codec.CapMessage})
+	expect[codec.Accept](t, c, nil)
+	_, b, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 2 || b[0] != codec.OpWelcome {
+		t.Errorf("client without CapResume welcomed with %v, want [%d slot]", b, codec.OpWelcome)
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	s := newTestServer(t, time.Second)
+	a := join(t, s, "alice", gameserver.Handshake{})
+	_, w, err := a.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w) != 2 || w[0] != codec.OpWelcome {
+		t.Fatalf("legacy client welcomed with %v, want [%d slot]", w, codec.OpWelcome)
+	}
+	slot := int(w[1])
+	b := join(t, s, "bob", codec.Protocol.Latest())
+	expect(t, b, func(m codec.Enter) bool { return m.Slot == slot })
+
+	// the session of a legacy client is not kept
+	a.Close()
+	expect(t, b, func(m codec.ServerMessage) bool {
+		if m, ok := m.(codec.Reconnecting); ok && m.Slot == slot {
+			t.Error("legacy client reconnecting after losing its connection")
+		}
+		m2, ok := m.(codec.EnterBot)
+		return ok && m2.Slot == slot
+	})
+	if n := s.Sessions.Len(); n != 0 {
+		t.Errorf("%d sessions parked for a legacy client", n)
+	}
+}
@@ -1,5 +1,5 @@
 module victorz.ca/gameserv
 
-go 1.19
+go 1.21
 
 require github.com/gorilla/websocket v1.5.0
@@ -0,0 +1,93 @@
+package slime
+
+import "victorz.ca/gameserv/slime/codec"
+
+// AdminPlayer describes a player for the admin API.
+type AdminPlayer struct {
+	Name  string `json:"name"`
+	Color int    `json:"color"`
+	// Ping is in milliseconds, or -1 if it is unknown.
+	Ping int `json:"ping_ms"`
+	// ConnID is the connection of the player, or zero while reconnecting.
+	ConnID uint64 `json:"conn_id,omitempty"`
+	Away   bool   `json:"away,omitempty"`
+}
+
+// AdminMatch describes a match in progress for the admin API.
+type AdminMatch struct {
+	Players  [2]AdminPlayer `json:"players"`
+	Score    [2]int         `json:"score"`
+	Duration float64        `json:"duration_seconds"`
+}
+
+// AdminStatus is the state of the game for the admin API.
+type AdminStatus struct {
+	Matches []AdminMatch `json:"matches"`
+}
+
+// AdminStatus returns the matches in progress.
+func (s *Server) AdminStatus() any {
+	s.matchesLock.Lock()
+	games := make([]*Game, 0, len(s.matches))
+	for g := range s.matches {
+		games = append(games, g)
+	}
+	s.matchesLock.Unlock()
+
+	status := AdminStatus{Matches: make([]AdminMatch, 0, len(games))}
+	for _, g := range games {
+		status.Matches = append(status.Matches, AdminMatch{
+			Players:  [2]AdminPlayer{g.P1.admin(), g.P2.admin()},
+			Score:    g.Score(),
+			Duration: g.Clock().Sub(g.start).Seconds(),
+		})
+	}
+	return status
+}
+
+// Score returns the number of rounds won by P1 and P2.
+func (g *Game) Score() [2]int {
+	g.winsLock.Lock()
+	defer g.winsLock.Unlock()
+	return g.wins
+}
+
+func (p *Player) admin() AdminPlayer {
+	a := AdminPlayer{Name: p.Name, Color: p.Color, Ping: p.Ping, Away: p.Away()}
+	p.connLock.Lock()
+	if p.conn != nil {
+		a.ConnID = p.conn.Meta.ID
+	}
+	p.connLock.Unlock()
+	return a
+}
+
+// Announce sends a message from the operators to the players whose clients
+// show messages, and returns how many players it was sent to and skipped.
+// Legacy clients cannot show messages, so they are skipped.
+func (s *Server) Announce(text string) (sent, skipped int) {
+	for _, p := range s.Players() {
+		if p.Data.SendMessage(text) {
+			sent++
+		} else {
+			skipped++
+		}
+	}
+	return sent, skipped
+}
+
+// SendMessage sends a message from the operators, and returns false
+// if the client does not show messages or is reconnecting.
+func (r *RemotePlayer) SendMessage(text string) bool {
+	if !r.handshake.Caps.Has(codec.CapMessage) {
+		return false
+	}
+	b, _ := codec.Message{Text: text}.MarshalBinary()
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+	if r.conn == nil {
+		return false
+	}
+	r.conn.Send(b)
+	return true
+}
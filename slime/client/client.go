@@ -0,0 +1,101 @@
+// Package client implements a client for the Slime Volleyball Multiplayer server.
+package client
+
+import (
+	"encoding"
+	"errors"
+
+	"victorz.ca/gameserv/common/gameclient"
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/slime"
+	"victorz.ca/gameserv/slime/codec"
+)
+
+// ErrMessage is returned by Err when the server sent a malformed message.
+var ErrMessage = codec.ErrMessage
+
+// Event is a message from the server, which is one of the event types of this package.
+type Event = codec.ServerMessage
+
+// Events are the messages of the codec.
+type (
+	Accept       = codec.Accept
+	Message      = codec.Message
+	Welcome      = codec.Welcome
+	ResumeToken  = codec.ResumeToken
+	WorldState   = codec.WorldState
+	Enter        = codec.Enter
+	Leave        = codec.Leave
+	EndRound     = codec.EndRound
+	NextRound    = codec.NextRound
+	PingTimes    = codec.PingTimes
+	Ping         = codec.Ping
+	Restart      = codec.Restart
+	OpponentAway = codec.OpponentAway
+)
+
+// Client is a connection to a Slime server.
+type Client struct {
+	*gameclient.Client[Event]
+}
+
+// Dial connects to a Slime server at a WebSocket URL and waits for a match.
+func Dial(url, name string, color int) (*Client, error) {
+	c, err := gameclient.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return New(c, name, color)
+}
+
+// New waits for a match over a connection, with the latest version of the protocol.
+func New(c gameserver.Conn, name string, color int) (*Client, error) {
+	return start(c, func(cl *Client) error {
+		return cl.send(codec.Hello{Color: color, Name: []byte(name), Handshake: codec.Protocol.Latest()})
+	})
+}
+
+// Resume resumes a session over a new connection.
+func Resume(c gameserver.Conn, token gameserver.ResumeToken) (*Client, error) {
+	return start(c, func(cl *Client) error { return cl.SendText([]byte(token.String())) })
+}
+
+func start(c gameserver.Conn, hello func(*Client) error) (*Client, error) {
+	cl := &Client{gameclient.New[Event](c)}
+	if err := hello(cl); err != nil {
+		c.Close()
+		return nil, err
+	}
+	go cl.Run(cl.decode)
+	return cl, nil
+}
+
+// Input sets the keys that are pressed.
+func (c *Client) Input(keys slime.InputState) error {
+	return c.send(codec.Input{InputState: codec.InputState(keys)})
+}
+
+func (c *Client) send(m encoding.BinaryMarshaler) error {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return c.Send(b)
+}
+
+func (c *Client) decode(b []byte) (Event, bool, error) {
+	e, err := codec.Decode(b)
+	if errors.Is(err, codec.ErrOpcode) {
+		// unknown messages are skipped
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if p, ok := e.(Ping); ok {
+		// answer with the timestamp
+		if err := c.send(codec.Pong{Time: p.Time}); err != nil {
+			return nil, false, err
+		}
+	}
+	return e, true, nil
+}
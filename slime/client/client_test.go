@@ -0,0 +1,122 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/slime"
+	"victorz.ca/gameserv/slime/codec"
+)
+
+// serverRead reads a binary message that the client sent to server.
+func serverRead(t *testing.T, server gameserver.Conn) []byte {
+	t.Helper()
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	mt, b, err := server.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt != gameserver.BinaryMessage {
+		t.Fatalf("client sent message type %d, want binary", mt)
+	}
+	return b
+}
+
+func TestClient(t *testing.T) {
+	client, server := gameserver.Pipe(16)
+	defer server.Close()
+	c, err := New(client, "alice", 0xFF8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var hello codec.Hello
+	if err := hello.UnmarshalBinary(serverRead(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	if string(hello.Name) != "alice" || hello.Color != 0xFF8000 || hello.Handshake != codec.Protocol.Latest() {
+		t.Errorf("hello %+v, want alice of color FF8000 with the latest version", hello)
+	}
+
+	ping := time.Unix(0, 1234567890)
+	want := []Event{
+		Accept{Handshake: codec.Protocol.Latest()},
+		Welcome{Name: "alice", Color: 0xFF8000},
+		ResumeToken{Token: gameserver.NewResumeToken()},
+		Enter{Name: "bob", Color: 0x0000FF},
+		Ping{Time: ping},
+		OpponentAway{Away: true},
+		Leave{},
+	}
+	for i, e := range want {
+		b, _ := e.MarshalBinary()
+		server.WriteMessage(gameserver.BinaryMessage, b)
+		if i == 0 {
+			// unknown messages are skipped
+			server.WriteMessage(gameserver.BinaryMessage, []byte{0xFF})
+		}
+	}
+	for _, w := range want {
+		if e := <-c.Events; !reflect.DeepEqual(e, w) {
+			t.Errorf("event %#v, want %#v", e, w)
+		}
+	}
+
+	// the ping is answered with its time
+	var pong codec.Pong
+	if err := pong.UnmarshalBinary(serverRead(t, server)); err != nil || !pong.Time.Equal(ping) {
+		t.Errorf("pong %v, %v, want %v", pong.Time, err, ping)
+	}
+	c.Input(slime.InputState{L: true, U: true})
+	var input codec.Input
+	if err := input.UnmarshalBinary(serverRead(t, server)); err != nil || input.InputState != (codec.InputState{L: true, U: true}) {
+		t.Errorf("input %+v, %v, want L and U", input, err)
+	}
+
+	server.WriteControl(gameserver.CloseMessage, websocket.FormatCloseMessage(gameserver.CloseKicked, "bye"), time.Now().Add(time.Second))
+	for range c.Events {
+	}
+	var ce *websocket.CloseError
+	if err := c.Err(); !errors.As(err, &ce) || ce.Code != gameserver.CloseKicked || ce.Text != "bye" {
+		t.Errorf("Err() = %v, want close %d bye", err, gameserver.CloseKicked)
+	}
+}
+
+func TestClientResume(t *testing.T) {
+	client, server := gameserver.Pipe(16)
+	defer server.Close()
+	token := gameserver.NewResumeToken()
+	c, err := Resume(client, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	mt, b, err := server.ReadMessage()
+	if err != nil || mt != gameserver.TextMessage || string(b) != token.String() {
+		t.Errorf("resume sent %d %q, %v, want the token as text", mt, b, err)
+	}
+}
+
+func TestClientBadMessage(t *testing.T) {
+	client, server := gameserver.Pipe(16)
+	defer server.Close()
+	c, err := New(client, "alice", 0xFF8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	server.WriteMessage(gameserver.BinaryMessage, []byte{codec.OpPing})
+	for range c.Events {
+	}
+	if err := c.Err(); !errors.Is(err, ErrMessage) {
+		t.Errorf("Err() = %v, want %v", err, ErrMessage)
+	}
+}
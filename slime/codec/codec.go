@@ -0,0 +1,587 @@
+// Package codec encodes and decodes the messages of the Slime Volleyball protocol.
+//
+// Every message is a binary WebSocket message. Messages from the server
+// start with an opcode. Messages from the client are told apart by length:
+// the first message is a Hello, then 8 bytes is a Pong, and other messages
+// are Inputs. Integers are big-endian.
+//
+// The Hello of a client may carry its protocol version and capabilities
+// (see gameserver.HelloMagic). Such clients receive an Accept before the Welcome.
+// Version 1 has the same messages as legacy clients, and Messages for
+// clients with CapMessage.
+package codec
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/common/geom"
+)
+
+// Errors returned by UnmarshalBinary and Decode.
+var (
+	ErrMessage = errors.New("slime: malformed message")
+	ErrOpcode  = errors.New("slime: unknown opcode")
+)
+
+// Protocol is the versions and capabilities of the server.
+// Legacy clients have no capabilities: they cannot resume their sessions.
+var Protocol = gameserver.Protocol{
+	MinVersion: 1,
+	MaxVersion: 1,
+	Caps:       CapResume | CapMessage,
+	Legacy:     0,
+}
+
+// Capabilities
+const (
+	// CapResume is a client that resumes its session after losing its connection.
+	// Other clients do not receive a ResumeToken.
+	CapResume gameserver.Caps = 1 << iota
+	// CapMessage is a client that shows messages from the server operators.
+	// Other clients do not receive Messages.
+	CapMessage
+)
+
+// Opcodes of server messages
+const (
+	OpWelcome byte = iota
+	OpWorldState
+	OpEnter
+	OpLeave
+	OpEndRoundWon
+	OpEndRoundLost
+	OpNextRoundServe
+	OpNextRoundReceive
+	OpPingTimes
+	OpPing
+	OpRestart
+	OpResumeToken
+	OpOpponentAway
+	OpOpponentBack
+	OpAccept
+	OpMessage
+)
+
+// ServerMessage is a message from the server.
+type ServerMessage interface {
+	encoding.BinaryMarshaler
+	Opcode() byte
+}
+
+// MoveState is the position and velocity of an entity.
+type MoveState struct {
+	O, V geom.Vec2
+}
+
+// InputState is the keys pressed by a player.
+type InputState struct {
+	L, R, U bool
+}
+
+// Welcome tells a player its name and color, after they are sanitized.
+//
+//	[0] [r] [g] [b] [name...]
+type Welcome struct {
+	Name  string
+	Color int
+}
+
+// WorldState is the state of the match, in the space of the receiving player:
+// players go from 0 (far from the net) to 1 (at the net), and the ball goes
+// from 0 (on the side of the player) to 2 (on the other side).
+// The horizontal velocities of the players are not sent.
+//
+//	[1] [keys] [self x: 2] [self y: 2] [self vy: 2]
+//	[other x - 1: 2] [other y: 2] [other vy: 2]
+//	[ball x / 2: 2] [ball y: 2] [ball vx: 2] [ball vy: 2]
+//
+// Keys are bits LRU of the player, then LRU of the other player, from the lowest bit.
+// Positions are scaled from [0, 1] to [0, 0xFFFF], and velocities by 0x3FFF.
+// The x of the other player, in (0, 1) since it is on the other side of the net,
+// is sent as x - 1 truncated to 16 bits, which wraps to about 1 + x * 0xFFFF.
+type WorldState struct {
+	Self, Other, Ball   MoveState
+	SelfKeys, OtherKeys InputState
+}
+
+// Enter is the opponent of a new match.
+//
+//	[2] [r] [g] [b] [name...]
+type Enter struct {
+	Name  string
+	Color int
+}
+
+// Leave tells a player that the opponent left.
+//
+//	[3]
+type Leave struct{}
+
+// EndRound is the end of a round.
+//
+//	[4] if won, [5] if lost
+type EndRound struct{ Won bool }
+
+// NextRound is the start of a round.
+//
+//	[6] if the player serves, [7] otherwise
+type NextRound struct{ Serve bool }
+
+// PingTimes are the pings of the player and its opponent measured by the server,
+// in milliseconds of 12 bits each.
+//
+//	[8] [self low 8 bits] [self high 4 bits, other high 4 bits] [other low 8 bits]
+type PingTimes struct{ Self, Other time.Duration }
+
+// Ping is a ping from the server, which the client answers with a Pong.
+//
+//	[9] [unix nanoseconds: 8]
+type Ping struct{ Time time.Time }
+
+// Restart tells players that the server restarts after a time.
+//
+//	[10] [seconds: 2]
+type Restart struct{ In time.Duration }
+
+// ResumeToken is the token to resume the session. It follows Welcome.
+//
+//	[11] [token: 16]
+type ResumeToken struct{ Token gameserver.ResumeToken }
+
+// OpponentAway tells a player whether the opponent is reconnecting.
+//
+//	[12] if away, [13] when back
+type OpponentAway struct{ Away bool }
+
+// Accept is the handshake of the connection, which answers a versioned Hello.
+//
+//	[14] [version] [capabilities: 2]
+type Accept struct{ gameserver.Handshake }
+
+// Message is a message from the server operators, shown to players.
+//
+//	[15] [UTF-8 text...]
+type Message struct{ Text string }
+
+// Hello is the first message from a client.
+// After UnmarshalBinary, Name refers to the decoded bytes.
+//
+//	[r] [g] [b] [name...]
+//	[r] [g] [b] [HelloMagic] [version] [capabilities: 2] [name...]
+//
+// A zero Handshake is a legacy hello.
+type Hello struct {
+	Color     int
+	Name      []byte
+	Handshake gameserver.Handshake
+}
+
+// Input sets the keys pressed by the player.
+//
+//	[keys]
+//
+// Keys are bits LRU from the lowest bit. When there are more bytes,
+// only the last is used.
+type Input struct{ InputState }
+
+// Pong answers a Ping with its time.
+//
+//	[unix nanoseconds: 8]
+type Pong struct{ Time time.Time }
+
+func (Welcome) Opcode() byte     { return OpWelcome }
+func (WorldState) Opcode() byte  { return OpWorldState }
+func (Enter) Opcode() byte       { return OpEnter }
+func (Leave) Opcode() byte       { return OpLeave }
+func (PingTimes) Opcode() byte   { return OpPingTimes }
+func (Ping) Opcode() byte        { return OpPing }
+func (Restart) Opcode() byte     { return OpRestart }
+func (ResumeToken) Opcode() byte { return OpResumeToken }
+func (Accept) Opcode() byte      { return OpAccept }
+func (Message) Opcode() byte     { return OpMessage }
+
+func (m EndRound) Opcode() byte {
+	if m.Won {
+		return OpEndRoundWon
+	}
+	return OpEndRoundLost
+}
+
+func (m NextRound) Opcode() byte {
+	if m.Serve {
+		return OpNextRoundServe
+	}
+	return OpNextRoundReceive
+}
+
+func (m OpponentAway) Opcode() byte {
+	if m.Away {
+		return OpOpponentAway
+	}
+	return OpOpponentBack
+}
+
+// Decode decodes a message from the server.
+func Decode(b []byte) (ServerMessage, error) {
+	if len(b) == 0 {
+		return nil, ErrMessage
+	}
+	switch b[0] {
+	case OpWelcome:
+		return decode[Welcome](b)
+	case OpWorldState:
+		return decode[WorldState](b)
+	case OpEnter:
+		return decode[Enter](b)
+	case OpLeave:
+		return decode[Leave](b)
+	case OpEndRoundWon, OpEndRoundLost:
+		return decode[EndRound](b)
+	case OpNextRoundServe, OpNextRoundReceive:
+		return decode[NextRound](b)
+	case OpPingTimes:
+		return decode[PingTimes](b)
+	case OpPing:
+		return decode[Ping](b)
+	case OpRestart:
+		return decode[Restart](b)
+	case OpResumeToken:
+		return decode[ResumeToken](b)
+	case OpOpponentAway, OpOpponentBack:
+		return decode[OpponentAway](b)
+	case OpAccept:
+		return decode[Accept](b)
+	case OpMessage:
+		return decode[Message](b)
+	}
+	return nil, ErrOpcode
+}
+
+func decode[M ServerMessage, PM interface {
+	*M
+	encoding.BinaryUnmarshaler
+}](b []byte) (ServerMessage, error) {
+	var m M
+	if err := PM(&m).UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// header checks the opcode and length of a server message,
+// and returns the rest of the message.
+func header(b []byte, n int, ops ...byte) ([]byte, error) {
+	if len(b) < 1+n {
+		return nil, ErrMessage
+	}
+	for _, op := range ops {
+		if b[0] == op {
+			return b[1:], nil
+		}
+	}
+	return nil, ErrMessage
+}
+
+// Scales of world state coordinates
+const (
+	dmf = 0xFFFF
+	dvf = 0x3FFF
+)
+
+// position scales v in [0, 1] to [0, 0xFFFF], truncating like legacy servers.
+func position(v float64) uint16 {
+	return uint16(math.Max(0, math.Min(v, 1)) * dmf)
+}
+
+// otherPosition scales x in (0, 1) as x - 1 wrapped to 16 bits, like legacy servers.
+func otherPosition(x float64) uint16 {
+	return uint16(int32((x - 1) * dmf))
+}
+
+// unOtherPosition is the inverse of otherPosition. It returns the middle of the
+// values that otherPosition truncates to v, so that encoding it again gives v.
+func unOtherPosition(v uint16) float64 {
+	return 1 + (float64(v)-0x10000-0.5)/dmf
+}
+
+// velocity scales v in about [-2, 2] to 16 signed bits, truncating toward zero.
+func velocity(v float64) uint16 {
+	return uint16(int16(math.Max(math.MinInt16, math.Min(v*dvf, math.MaxInt16))))
+}
+
+func keys(k InputState) byte {
+	var b byte
+	if k.L {
+		b |= 1
+	}
+	if k.R {
+		b |= 2
+	}
+	if k.U {
+		b |= 4
+	}
+	return b
+}
+
+func inputState(b byte) InputState {
+	return InputState{L: b&1 != 0, R: b&2 != 0, U: b&4 != 0}
+}
+
+// Player messages
+//
+//	[op] [r] [g] [b] [name...]
+
+func marshalPlayer(op byte, name string, col int) ([]byte, error) {
+	b := make([]byte, 4+len(name))
+	binary.BigEndian.PutUint32(b, uint32(col))
+	b[0] = op
+	copy(b[4:], name)
+	return b, nil
+}
+
+func unmarshalPlayer(b []byte, op byte, name *string, col *int) error {
+	b, err := header(b, 3, op)
+	if err != nil {
+		return err
+	}
+	*col = int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	*name = string(b[3:])
+	return nil
+}
+
+func (m Welcome) MarshalBinary() ([]byte, error) {
+	return marshalPlayer(OpWelcome, m.Name, m.Color)
+}
+
+func (m *Welcome) UnmarshalBinary(b []byte) error {
+	return unmarshalPlayer(b, OpWelcome, &m.Name, &m.Color)
+}
+
+func (m Enter) MarshalBinary() ([]byte, error) {
+	return marshalPlayer(OpEnter, m.Name, m.Color)
+}
+
+func (m *Enter) UnmarshalBinary(b []byte) error {
+	return unmarshalPlayer(b, OpEnter, &m.Name, &m.Color)
+}
+
+func (m WorldState) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 22)
+	b[0] = OpWorldState
+	b[1] = keys(m.SelfKeys) | keys(m.OtherKeys)<<3
+	binary.BigEndian.PutUint16(b[2:], position(m.Self.O.X))
+	binary.BigEndian.PutUint16(b[4:], position(m.Self.O.Y))
+	binary.BigEndian.PutUint16(b[6:], velocity(m.Self.V.Y))
+	binary.BigEndian.PutUint16(b[8:], otherPosition(m.Other.O.X))
+	binary.BigEndian.PutUint16(b[10:], position(m.Other.O.Y))
+	binary.BigEndian.PutUint16(b[12:], velocity(m.Other.V.Y))
+	binary.BigEndian.PutUint16(b[14:], position(m.Ball.O.X*0.5))
+	binary.BigEndian.PutUint16(b[16:], position(m.Ball.O.Y))
+	binary.BigEndian.PutUint16(b[18:], velocity(m.Ball.V.X))
+	binary.BigEndian.PutUint16(b[20:], velocity(m.Ball.V.Y))
+	return b, nil
+}
+
+func (m *WorldState) UnmarshalBinary(b []byte) error {
+	if _, err := header(b, 21, OpWorldState); err != nil {
+		return err
+	}
+	p := func(i int) float64 { return float64(binary.BigEndian.Uint16(b[i:])) / dmf }
+	v := func(i int) float64 { return float64(int16(binary.BigEndian.Uint16(b[i:]))) / dvf }
+	*m = WorldState{
+		Self:      MoveState{O: geom.Vec2{X: p(2), Y: p(4)}, V: geom.Vec2{Y: v(6)}},
+		Other:     MoveState{O: geom.Vec2{X: unOtherPosition(binary.BigEndian.Uint16(b[8:])), Y: p(10)}, V: geom.Vec2{Y: v(12)}},
+		Ball:      MoveState{O: geom.Vec2{X: p(14) * 2, Y: p(16)}, V: geom.Vec2{X: v(18), Y: v(20)}},
+		SelfKeys:  inputState(b[1]),
+		OtherKeys: inputState(b[1] >> 3),
+	}
+	return nil
+}
+
+func (m Leave) MarshalBinary() ([]byte, error) { return []byte{OpLeave}, nil }
+
+func (m *Leave) UnmarshalBinary(b []byte) error {
+	_, err := header(b, 0, OpLeave)
+	return err
+}
+
+func (m EndRound) MarshalBinary() ([]byte, error) { return []byte{m.Opcode()}, nil }
+
+func (m *EndRound) UnmarshalBinary(b []byte) error {
+	_, err := header(b, 0, OpEndRoundWon, OpEndRoundLost)
+	m.Won = err == nil && b[0] == OpEndRoundWon
+	return err
+}
+
+func (m NextRound) MarshalBinary() ([]byte, error) { return []byte{m.Opcode()}, nil }
+
+func (m *NextRound) UnmarshalBinary(b []byte) error {
+	_, err := header(b, 0, OpNextRoundServe, OpNextRoundReceive)
+	m.Serve = err == nil && b[0] == OpNextRoundServe
+	return err
+}
+
+func (m OpponentAway) MarshalBinary() ([]byte, error) { return []byte{m.Opcode()}, nil }
+
+func (m *OpponentAway) UnmarshalBinary(b []byte) error {
+	_, err := header(b, 0, OpOpponentAway, OpOpponentBack)
+	m.Away = err == nil && b[0] == OpOpponentAway
+	return err
+}
+
+func (m PingTimes) MarshalBinary() ([]byte, error) {
+	ms := func(d time.Duration) int {
+		if d /= time.Millisecond; d > 0xFFF {
+			return 0xFFF
+		} else if d < 0 {
+			return 0
+		}
+		return int(d)
+	}
+	self, other := ms(m.Self), ms(m.Other)
+	return []byte{
+		OpPingTimes,
+		byte(self),
+		byte(((self >> 4) & 0xF0) | ((other >> 8) & 0x0F)),
+		byte(other),
+	}, nil
+}
+
+func (m *PingTimes) UnmarshalBinary(b []byte) error {
+	b, err := header(b, 3, OpPingTimes)
+	if err != nil {
+		return err
+	}
+	self := int(b[0]) | int(b[1]&0xF0)<<4
+	other := int(b[2]) | int(b[1]&0x0F)<<8
+	m.Self = time.Duration(self) * time.Millisecond
+	m.Other = time.Duration(other) * time.Millisecond
+	return nil
+}
+
+func (m Ping) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 9)
+	b[0] = OpPing
+	binary.BigEndian.PutUint64(b[1:], uint64(m.Time.UnixNano()))
+	return b, nil
+}
+
+func (m *Ping) UnmarshalBinary(b []byte) error {
+	b, err := header(b, 8, OpPing)
+	if err != nil {
+		return err
+	}
+	m.Time = time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+	return nil
+}
+
+func (m Restart) MarshalBinary() ([]byte, error) {
+	secs := (m.In + time.Second - 1) / time.Second
+	if secs < 0 {
+		secs = 0
+	} else if secs > 0xFFFF {
+		secs = 0xFFFF
+	}
+	b := make([]byte, 3)
+	b[0] = OpRestart
+	binary.BigEndian.PutUint16(b[1:], uint16(secs))
+	return b, nil
+}
+
+func (m *Restart) UnmarshalBinary(b []byte) error {
+	b, err := header(b, 2, OpRestart)
+	if err != nil {
+		return err
+	}
+	m.In = time.Duration(binary.BigEndian.Uint16(b)) * time.Second
+	return nil
+}
+
+func (m ResumeToken) MarshalBinary() ([]byte, error) {
+	return append([]byte{OpResumeToken}, m.Token[:]...), nil
+}
+
+func (m *ResumeToken) UnmarshalBinary(b []byte) error {
+	b, err := header(b, len(m.Token), OpResumeToken)
+	if err == nil {
+		copy(m.Token[:], b)
+	}
+	return err
+}
+
+func (m Accept) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4)
+	b[0] = OpAccept
+	b[1] = m.Version
+	binary.BigEndian.PutUint16(b[2:], uint16(m.Caps))
+	return b, nil
+}
+
+func (m *Accept) UnmarshalBinary(b []byte) error {
+	b, err := header(b, 3, OpAccept)
+	if err != nil {
+		return err
+	}
+	m.Version = b[0]
+	m.Caps = gameserver.Caps(binary.BigEndian.Uint16(b[1:]))
+	return nil
+}
+
+func (m Message) MarshalBinary() ([]byte, error) {
+	return append([]byte{OpMessage}, m.Text...), nil
+}
+
+func (m *Message) UnmarshalBinary(b []byte) error {
+	b, err := header(b, 0, OpMessage)
+	if err != nil {
+		return err
+	}
+	m.Text = string(b)
+	return nil
+}
+
+func (m Hello) MarshalBinary() ([]byte, error) {
+	b := []byte{byte(m.Color >> 16), byte(m.Color >> 8), byte(m.Color)}
+	return append(m.Handshake.AppendHello(b), m.Name...), nil
+}
+
+func (m *Hello) UnmarshalBinary(b []byte) error {
+	if len(b) < 3 {
+		return ErrMessage
+	}
+	h, name, err := gameserver.CutHello(b[3:])
+	if err != nil {
+		return ErrMessage
+	}
+	*m = Hello{Color: int(b[0])<<16 | int(b[1])<<8 | int(b[2]), Name: name, Handshake: h}
+	return nil
+}
+
+func (m Input) MarshalBinary() ([]byte, error) { return []byte{keys(m.InputState)}, nil }
+
+func (m *Input) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 || len(b) == 8 {
+		return ErrMessage
+	}
+	m.InputState = inputState(b[len(b)-1])
+	return nil
+}
+
+func (m Pong) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(m.Time.UnixNano()))
+	return b, nil
+}
+
+func (m *Pong) UnmarshalBinary(b []byte) error {
+	if len(b) != 8 {
+		return ErrMessage
+	}
+	m.Time = time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+	return nil
+}
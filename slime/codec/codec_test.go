@@ -0,0 +1,185 @@
+package codec
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/common/geom"
+)
+
+// serverMessages are messages whose values survive encoding exactly.
+var serverMessages = []ServerMessage{
+	Welcome{Name: "alice", Color: 0x123456},
+	Enter{Name: "", Color: 0xFFFFFF},
+	WorldState{
+		Self:      MoveState{O: geom.Vec2{X: 0, Y: 1}},
+		Other:     MoveState{O: geom.Vec2{X: unOtherPosition(58328), Y: 0}},
+		Ball:      MoveState{O: geom.Vec2{X: 2, Y: 1}},
+		SelfKeys:  InputState{L: true, U: true},
+		OtherKeys: InputState{R: true},
+	},
+	Leave{},
+	EndRound{Won: true},
+	EndRound{Won: false},
+	NextRound{Serve: true},
+	NextRound{Serve: false},
+	PingTimes{Self: 0xFFF * time.Millisecond, Other: 17 * time.Millisecond},
+	Ping{Time: time.Unix(0, 1700000000123456789)},
+	Restart{In: 90 * time.Second},
+	ResumeToken{Token: [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+	OpponentAway{Away: true},
+	OpponentAway{Away: false},
+	Accept{gameserver.Handshake{Version: 1, Caps: CapResume}},
+	Message{Text: "server restarts at 12:00 ✓"},
+	Message{},
+}
+
+func TestServerRoundTrip(t *testing.T) {
+	for _, m := range serverMessages {
+		b, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%T: %v", m, err)
+		}
+		if b[0] != m.Opcode() {
+			t.Errorf("%T: opcode %d, want %d", m, b[0], m.Opcode())
+		}
+		got, err := Decode(b)
+		if err != nil {
+			t.Fatalf("%T: %v", m, err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("round trip of %#v gave %#v", m, got)
+		}
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	tests := []struct {
+		m   encoding.BinaryMarshaler
+		new func() encoding.BinaryUnmarshaler
+	}{
+		{Hello{Color: 0xABCDEF, Name: []byte("bob")}, func() encoding.BinaryUnmarshaler { return new(Hello) }},
+		{Hello{Color: 0xABCDEF, Name: []byte("bob"), Handshake: gameserver.Handshake{Version: 1, Caps: CapResume}}, func() encoding.BinaryUnmarshaler { return new(Hello) }},
+		{Input{InputState{L: true, R: true, U: true}}, func() encoding.BinaryUnmarshaler { return new(Input) }},
+		{Input{}, func() encoding.BinaryUnmarshaler { return new(Input) }},
+		{Pong{Time: time.Unix(0, 42)}, func() encoding.BinaryUnmarshaler { return new(Pong) }},
+	}
+	for _, tt := range tests {
+		b, err := tt.m.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%T: %v", tt.m, err)
+		}
+		got := tt.new()
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%T: %v", tt.m, err)
+		}
+		if got := reflect.ValueOf(got).Elem().Interface(); !reflect.DeepEqual(got, tt.m) {
+			t.Errorf("round trip of %#v gave %#v", tt.m, got)
+		}
+	}
+}
+
+// The opponent is sent in the coordinates of the player, as 2 - x of the
+// second player, whose x is in [1.11, 1.9] on the other side of the net.
+func TestWorldStateScale(t *testing.T) {
+	tests := []struct {
+		p2X   float64
+		other uint16 // sent by legacy servers
+	}{
+		{1.11, 58328},
+		{1.5, 32769},
+		{1.9, 6555},
+	}
+	for _, tt := range tests {
+		m := WorldState{
+			Self:  MoveState{O: geom.Vec2{X: 0.25, Y: 0.5}, V: geom.Vec2{Y: -0.75}},
+			Other: MoveState{O: geom.Vec2{X: 2 - tt.p2X, Y: 0.1}, V: geom.Vec2{Y: 1.25}},
+			Ball:  MoveState{O: geom.Vec2{X: 1.2, Y: 0.3}, V: geom.Vec2{X: -1, Y: 0.5}},
+		}
+		b, _ := m.MarshalBinary()
+		if other := binary.BigEndian.Uint16(b[8:]); other != tt.other {
+			t.Errorf("p2 x %v: other x sent as %d, want %d", tt.p2X, other, tt.other)
+		}
+		if x, want := binary.BigEndian.Uint16(b[2:]), uint16(m.Self.O.X*dmf); x != want {
+			t.Errorf("p2 x %v: self x sent as %d, want %d", tt.p2X, x, want)
+		}
+		if vx, want := binary.BigEndian.Uint16(b[18:]), uint16(int16(m.Ball.V.X*dvf)); vx != want {
+			t.Errorf("p2 x %v: ball vx sent as %d, want %d", tt.p2X, vx, want)
+		}
+		var got WorldState
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		near := func(name string, a, b, eps float64) {
+			if math.Abs(a-b) > eps {
+				t.Errorf("p2 x %v: %s = %v, want %v", tt.p2X, name, a, b)
+			}
+		}
+		near("self x", got.Self.O.X, m.Self.O.X, 1.0/dmf)
+		near("self y", got.Self.O.Y, m.Self.O.Y, 1.0/dmf)
+		near("self vy", got.Self.V.Y, m.Self.V.Y, 1.0/dvf)
+		near("other x", got.Other.O.X, m.Other.O.X, 1.0/dmf)
+		near("other y", got.Other.O.Y, m.Other.O.Y, 1.0/dmf)
+		near("other vy", got.Other.V.Y, m.Other.V.Y, 1.0/dvf)
+		near("ball x", got.Ball.O.X, m.Ball.O.X, 2.0/dmf)
+		near("ball y", got.Ball.O.Y, m.Ball.O.Y, 1.0/dmf)
+		near("ball vx", got.Ball.V.X, m.Ball.V.X, 1.0/dvf)
+		near("ball vy", got.Ball.V.Y, m.Ball.V.Y, 1.0/dvf)
+
+		if b2, _ := got.MarshalBinary(); !bytes.Equal(b2, b) {
+			t.Errorf("p2 x %v: encoding the decoded state gave %v, want %v", tt.p2X, b2, b)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		b   []byte
+		err error
+	}{
+		{nil, ErrMessage},
+		{[]byte{OpWelcome, 1, 2}, ErrMessage},
+		{[]byte{OpWorldState, 1, 2, 3}, ErrMessage},
+		{[]byte{OpPingTimes, 1}, ErrMessage},
+		{[]byte{OpResumeToken, 1, 2}, ErrMessage},
+		{[]byte{200}, ErrOpcode},
+	}
+	for _, tt := range tests {
+		if _, err := Decode(tt.b); !errors.Is(err, tt.err) {
+			t.Errorf("Decode(%v) = %v, want %v", tt.b, err, tt.err)
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, m := range serverMessages {
+		b, _ := m.MarshalBinary()
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		m, err := Decode(b)
+		if err != nil {
+			return
+		}
+		// decoded messages encode to a message that decodes the same
+		b2, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2, err := Decode(b2)
+		if err != nil {
+			t.Fatalf("%v: %v", b2, err)
+		}
+		b3, _ := m2.MarshalBinary()
+		if !bytes.Equal(b2, b3) {
+			t.Errorf("%v encodes to %v then %v", b, b2, b3)
+		}
+	})
+}
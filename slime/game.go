@@ -1,10 +1,14 @@
 package slime
 
 import (
+	"context"
+	"log/slog"
 	"math/rand"
+	"sync"
 	"time"
 
 	"victorz.ca/gameserv/common/geom"
+	"victorz.ca/gameserv/common/tick"
 )
 
 // Timing constants
@@ -19,6 +23,10 @@ const (
 	NETW_TIME = time.Second / NETW_FPS
 	// Interval of pings
 	PING_TIME = 250 * time.Millisecond
+	// Maximum physics frames run at once to catch up
+	MAX_CATCHUP = 5
+	// Time between the end of a round and the next round
+	INTERMISSION_TIME = 750 * time.Millisecond
 )
 
 // Net constants
@@ -64,14 +72,55 @@ type Ball struct {
 type Game struct {
 	P1, P2 *Player
 	B      Ball
+
+	// Drain, when closed, ends the game after the current round.
+	Drain <-chan struct{}
+
+	winner          int // 0 during a round, otherwise the winner of the last round
+	p1First         bool
+	intermissionEnd time.Time
+	sched           *tick.Scheduler
+
+	// Logger receives round and match results.
+	Logger *slog.Logger
+
+	away      [2]bool // whether P1 and P2 are reconnecting
+	wins      [2]int  // rounds won by P1 and P2
+	winsLock  sync.Mutex
+	start     time.Time
+	endReason string
+
+	seed   int64 // of the random choices of the match
+	replay *replayWriter
+
+	// Rand chooses the seed of each match. It defaults to a random source.
+	Rand *rand.Rand
+	// Clock returns the current time of the game. It defaults to time.Now.
+	Clock func() time.Time
 }
 
 // NewGame creates a game for two players.
-func NewGame(p1, p2 *Player) Game {
-	return Game{
-		P1: p1,
-		P2: p2,
+func NewGame(p1, p2 *Player) *Game {
+	g := &Game{
+		P1:     p1,
+		P2:     p2,
+		Logger: slog.Default(),
+		Rand:   rand.New(rand.NewSource(rand.Int63())),
+		Clock:  time.Now,
 	}
+	g.sched = tick.New(
+		tick.Config{
+			PhysicsInterval: PHYS_TIME,
+			NetworkInterval: NETW_TIME,
+			PingInterval:    PING_TIME,
+			MaxCatchUp:      MAX_CATCHUP,
+			Clock:           func() time.Time { return g.Clock() },
+		},
+		g.physicsFrame,
+		g.sendStates,
+		g.sendPings,
+	)
+	return g
 }
 
 // StartRound resets the game state depending on which player serves.
@@ -269,81 +318,171 @@ func (g *Game) PhysicsFrame(winner *int) {
 	}
 }
 
-// Run is a loop that does not stop until a player quits.
-func (g *Game) Run() {
-	g.P1.SendEnter(g.P2.Name, g.P2.Color)
-	g.P2.SendEnter(g.P1.Name, g.P1.Color)
-
-	// extra game state
-	winner := 3
-	p1First := (rand.Intn(2) == 0)
-
-	// timers
-	gameStart := time.Now()
-	lastPhysics := gameStart
-	lastWorldState := gameStart
-	nextPing := gameStart
-	intermissionEnd := time.Time{}
-
-GAME_LOOP:
-	for {
-		select {
-		case <-g.P1.Stop:
-			g.P2.SendLeave()
-			break GAME_LOOP
-		case <-g.P2.Stop:
-			g.P1.SendLeave()
-			break GAME_LOOP
-		default:
-		}
+// physicsFrame runs PhysicsFrame for the scheduler with the latest inputs
+// of the players, and records it in the replay with the same inputs.
+func (g *Game) physicsFrame() {
+	keys := [2]InputState{g.P1.takeInput(), g.P2.takeInput()}
+	g.PhysicsFrame(&g.winner)
+	if g.replay != nil {
+		g.replay.frame(keys, g.Checksum())
+	}
+}
 
-		now := time.Now()
+// sendStates sends the world state to both players.
+func (g *Game) sendStates() {
+	g.P1.SendState(transformState(g.P1, g.P2, g.B.MoveState, true))
+	g.P2.SendState(transformState(g.P1, g.P2, g.B.MoveState, false))
+}
 
-		// Apply physics
-		oldWinner := winner
-		for now.After(lastPhysics) {
-			g.PhysicsFrame(&winner)
-			lastPhysics = lastPhysics.Add(PHYS_TIME)
+// sendPings sends pings and ping results to both players.
+func (g *Game) sendPings() {
+	g.P1.SendPing()
+	g.P2.SendPing()
+	// Send ping times when we have measurements for both
+	p1Ping := g.P1.Ping
+	if p1Ping != -1 {
+		p2Ping := g.P2.Ping
+		if p2Ping != -1 {
+			g.P1.SendPingTimes(p1Ping, p2Ping)
+			g.P2.SendPingTimes(p2Ping, p1Ping)
 		}
+	}
+}
 
-		// Update world state
-		for now.After(lastWorldState) {
-			g.P1.SendState(transformState(g.P1, g.P2, g.B.MoveState, true))
-			g.P2.SendState(transformState(g.P1, g.P2, g.B.MoveState, false))
-			lastWorldState = lastWorldState.Add(NETW_TIME)
-		}
+// Start introduces the players to each other and starts the timers at now.
+func (g *Game) Start(now time.Time) {
+	g.P1.SendEnter(g.P2.Name, g.P2.Color)
+	g.P2.SendEnter(g.P1.Name, g.P1.Color)
 
-		// Update winner
-		if winner != 0 {
-			if oldWinner == 0 {
-				g.P1.SendEndRound(winner == 1)
-				g.P2.SendEndRound(winner == 2)
-				intermissionEnd = now.Add(750 * time.Millisecond)
-			} else if now.After(intermissionEnd) {
-				winner = 0
-				p1First = !p1First
-				g.P1.SendNextRound(p1First)
-				g.P2.SendNextRound(!p1First)
-				g.StartRound(p1First)
+	g.winner = 3
+	g.away = [2]bool{}
+	g.seed = g.Rand.Int63()
+	g.p1First = firstServe(g.seed)
+	g.intermissionEnd = time.Time{}
+	g.winsLock.Lock()
+	g.wins = [2]int{}
+	g.winsLock.Unlock()
+	g.start = now
+	g.endReason = ""
+	g.sched.Reset(now)
+	if g.replay != nil {
+		g.replay.header(g)
+	}
+}
+
+// Step runs the processing that is due at now.
+// It returns false when the game is over.
+func (g *Game) Step(now time.Time) bool {
+	select {
+	case <-g.P1.Stop:
+		g.P2.SendLeave()
+		g.endReason = "p1 left"
+		return false
+	case <-g.P2.Stop:
+		g.P1.SendLeave()
+		g.endReason = "p2 left"
+		return false
+	default:
+	}
+	g.checkAway(0, g.P1, g.P2)
+	g.checkAway(1, g.P2, g.P1)
+
+	// Apply physics, update world state, and send pings
+	oldWinner := g.winner
+	g.sched.Advance(now)
+
+	// Update winner
+	if g.winner != 0 {
+		if oldWinner == 0 {
+			g.P1.SendEndRound(g.winner == 1)
+			g.P2.SendEndRound(g.winner == 2)
+			g.intermissionEnd = now.Add(INTERMISSION_TIME)
+			g.winsLock.Lock()
+			g.wins[g.winner-1]++
+			g.winsLock.Unlock()
+			g.logRound()
+			if g.replay != nil {
+				g.replay.endRound(g.winner)
 			}
-		}
 
-		// Send pings and ping results
-		if now.After(nextPing) {
-			g.P1.SendPing()
-			g.P2.SendPing()
-			// Send ping times when we have measurements for both
-			p1Ping := g.P1.Ping
-			if p1Ping != -1 {
-				p2Ping := g.P2.Ping
-				if p2Ping != -1 {
-					g.P1.SendPingTimes(p1Ping, p2Ping)
-					g.P2.SendPingTimes(p2Ping, p1Ping)
-				}
+			select {
+			case <-g.Drain:
+				g.endReason = "server restarting"
+				return false
+			default:
+			}
+		} else if now.After(g.intermissionEnd) {
+			g.winner = 0
+			g.p1First = !g.p1First
+			g.P1.SendNextRound(g.p1First)
+			g.P2.SendNextRound(!g.p1First)
+			g.StartRound(g.p1First)
+			if g.replay != nil {
+				g.replay.nextRound(g.p1First)
 			}
-			nextPing = now.Add(PING_TIME)
 		}
+	}
+
+	return true
+}
+
+// checkAway tells other when p loses or regains its connection.
+// When p resumes, it is introduced to other again.
+func (g *Game) checkAway(i int, p, other *Player) {
+	away := p.Away()
+	if away == g.away[i] {
+		return
+	}
+	g.away[i] = away
+	if !away {
+		p.SendEnter(other.Name, other.Color)
+	}
+	other.SendOpponentAway(away)
+}
+
+var _ tick.Clocked = (*Game)(nil)
+
+// Now returns the time of the Clock of the game,
+// at which a tick.Pool steps the game.
+func (g *Game) Now() time.Time { return g.Clock() }
+
+// Run is a loop that does not stop until a player quits or ctx is cancelled.
+func (g *Game) Run(ctx context.Context) {
+	g.Start(g.Now())
+	g.sched.Run(ctx, g.Step)
+	g.LogResult()
+}
+
+// logRound logs the result of a round.
+func (g *Game) logRound() {
+	winner := g.P1
+	if g.winner == 2 {
+		winner = g.P2
+	}
+	g.Logger.Debug("round",
+		slog.String("event", "round"),
+		slog.String("p1", g.P1.Name),
+		slog.String("p2", g.P2.Name),
+		slog.String("winner", winner.Name),
+		slog.Int("p1_wins", g.wins[0]),
+		slog.Int("p2_wins", g.wins[1]),
+	)
+}
 
-		time.Sleep(10 * time.Millisecond)
+// LogResult logs the result of the match after it ends.
+func (g *Game) LogResult() {
+	reason := g.endReason
+	if reason == "" {
+		reason = "server stopped"
 	}
+	g.Logger.Info("match",
+		slog.String("event", "match"),
+		slog.String("p1", g.P1.Name),
+		slog.String("p2", g.P2.Name),
+		slog.Int("p1_wins", g.wins[0]),
+		slog.Int("p2_wins", g.wins[1]),
+		slog.Duration("duration", g.Clock().Sub(g.start)),
+		slog.String("reason", reason),
+		slog.Int64("seed", g.seed),
+	)
 }
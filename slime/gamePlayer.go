@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"victorz.ca/gameserv/common/geom"
 )
@@ -23,13 +24,18 @@ type Player struct {
 	// Inputs
 	Name  string
 	Color int
+	// InputState is the input simulated in the current frame,
+	// taken from the latest input of the client at the start of the frame.
 	InputState
+	input     InputState // latest input of the client
+	inputLock sync.Mutex
 
 	// Game State
 	MoveState
 
 	Stop     chan struct{}
 	stopOnce sync.Once
+	away     atomic.Bool
 
 	Ping int
 	RemotePlayer
@@ -54,6 +60,28 @@ func (p *Player) Close() {
 	})
 }
 
+// SetInput sets the latest input of the client,
+// which the game simulates from its next frame.
+func (p *Player) SetInput(in InputState) {
+	p.inputLock.Lock()
+	p.input = in
+	p.inputLock.Unlock()
+}
+
+// Input returns the latest input of the client.
+func (p *Player) Input() InputState {
+	p.inputLock.Lock()
+	defer p.inputLock.Unlock()
+	return p.input
+}
+
+// takeInput sets InputState to the latest input of the client, and returns it.
+// It is called by the game at the start of each frame.
+func (p *Player) takeInput() InputState {
+	p.InputState = p.Input()
+	return p.InputState
+}
+
 // LogNameEnter returns a name for logging when connecting.
 func (p *Player) LogNameEnter() string {
 	return fmt.Sprintf("%v #%06x", p.Name, p.Color)
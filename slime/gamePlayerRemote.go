@@ -1,31 +1,90 @@
 package slime
 
 import (
-	"encoding/binary"
+	"encoding"
+	"sync"
 	"time"
+
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/slime/codec"
 )
 
 // RemotePlayer handles the network message protocol for a Player.
 type RemotePlayer struct {
 	*Player
-	Send func(b []byte)
+
+	// The connection of the player, which is nil while reconnecting
+	conn      *gameserver.BinaryPlayer[*Player]
+	joined    bool
+	token     gameserver.ResumeToken
+	handshake gameserver.Handshake
+	connLock  sync.Mutex
 }
 
 // newRemotePlayer makes a new RemotePlayer for a Player
 func newRemotePlayer(p *Player) RemotePlayer {
-	return RemotePlayer{
-		p,
-		nil,
+	return RemotePlayer{Player: p}
+}
+
+// Send sends a message, or drops it while the player is reconnecting.
+func (r *RemotePlayer) Send(b []byte) {
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+	if r.conn != nil {
+		r.conn.Send(b)
+	}
+}
+
+// Disconnect closes the connection of the player for a reason.
+func (r *RemotePlayer) Disconnect(reason gameserver.CloseReason) {
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+	if r.conn != nil {
+		r.conn.Disconnect(reason)
 	}
 }
 
+// Attach sends messages to conn and welcomes the player.
+// It returns false when the player joins for the first time,
+// and true when it resumes its session.
+func (r *RemotePlayer) Attach(conn *gameserver.BinaryPlayer[*Player]) (resumed bool) {
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+	r.conn = conn
+	r.token = gameserver.NewResumeToken()
+	r.sendWelcome()
+	r.away.Store(false)
+
+	resumed = r.joined
+	r.joined = true
+	return
+}
+
+// Detach stops sending messages to the player until it resumes,
+// and returns the token to resume with.
+func (r *RemotePlayer) Detach() gameserver.ResumeToken {
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+	r.conn = nil
+	r.SetInput(InputState{})
+	r.away.Store(true)
+	return r.token
+}
+
+// Away returns whether the player is reconnecting.
+func (r *RemotePlayer) Away() bool {
+	return r.away.Load()
+}
+
 // Recv processes incoming messages.
 func (r *RemotePlayer) Recv(b []byte) {
 	// For speed, process immediately, instead of using chan
-	if len(b) == 8 {
+	var pong codec.Pong
+	var input codec.Input
+	if pong.UnmarshalBinary(b) == nil {
 		// handle pongs
-		t := binary.BigEndian.Uint64(b)
-		n := uint64(time.Now().UnixNano())
+		t := pong.Time.UnixNano()
+		n := time.Now().UnixNano()
 		if n >= t {
 			newPing := int((n - t) / 1000000)
 			if r.Ping != -1 {
@@ -33,23 +92,36 @@ func (r *RemotePlayer) Recv(b []byte) {
 			}
 			r.Ping = newPing
 		}
-	} else if len(b) != 0 {
-		// use last move byte
-		b := b[len(b)-1]
-		r.L = (b & 1) != 0
-		r.R = (b & 2) != 0
-		r.U = (b & 4) != 0
+	} else if input.UnmarshalBinary(b) == nil {
+		r.SetInput(InputState(input.InputState))
 	}
 }
 
-func (r *RemotePlayer) SendWelcome() {
-	b := make([]byte, len(r.Name)+4)
+// send sends a message of the codec.
+func (r *RemotePlayer) send(m encoding.BinaryMarshaler) {
+	b, _ := m.MarshalBinary()
+	r.Send(b)
+}
 
-	binary.BigEndian.PutUint32(b, uint32(r.Color))
-	b[0] = 0
-	copy(b[4:], r.Name)
+// sendWelcome sends the accept of a versioned client, the welcome message,
+// and the token to resume the session. The connection lock must be held.
+func (r *RemotePlayer) sendWelcome() {
+	send := func(m encoding.BinaryMarshaler) {
+		b, _ := m.MarshalBinary()
+		r.conn.Send(b)
+	}
+	if !r.handshake.IsLegacy() {
+		send(codec.Accept{Handshake: r.handshake})
+	}
+	send(codec.Welcome{Name: r.Name, Color: r.Color})
+	if r.CanResume() {
+		send(codec.ResumeToken{Token: r.token})
+	}
+}
 
-	r.Send(b)
+// CanResume returns whether the client resumes its session after losing its connection.
+func (r *RemotePlayer) CanResume() bool {
+	return r.handshake.Caps.Has(codec.CapResume)
 }
 
 func transformState(p1, p2 *Player, b MoveState, forP1 bool) (self, other, ball MoveState, selfKeys, otherKeys InputState) {
@@ -77,98 +149,38 @@ func transformState(p1, p2 *Player, b MoveState, forP1 bool) (self, other, ball
 }
 
 func (r *RemotePlayer) SendState(self, other, ball MoveState, selfKeys, otherKeys InputState) {
-	b := make([]byte, 22)
-
 	if ball.O.Y > 0.8 {
 		ball.O.Y = 0.8
 	}
-
-	const (
-		DMF = 0xFFFF
-		DVF = 0x3FFF
-	)
-
-	b[0] = 1
-	b[1] = 0
-	if selfKeys.L {
-		b[1] |= 1
-	}
-	if selfKeys.R {
-		b[1] |= 2
-	}
-	if selfKeys.U {
-		b[1] |= 4
-	}
-	if otherKeys.L {
-		b[1] |= 8
-	}
-	if otherKeys.R {
-		b[1] |= 16
-	}
-	if otherKeys.U {
-		b[1] |= 32
-	}
-	binary.BigEndian.PutUint16(b[2:], uint16(self.O.X*DMF))
-	binary.BigEndian.PutUint16(b[4:], uint16(self.O.Y*DMF))
-	binary.BigEndian.PutUint16(b[6:], uint16(int16(self.V.Y*DVF)))
-	binary.BigEndian.PutUint16(b[8:], uint16((other.O.X-1)*DMF))
-	binary.BigEndian.PutUint16(b[10:], uint16(other.O.Y*DMF))
-	binary.BigEndian.PutUint16(b[12:], uint16(int16(other.V.Y*DVF)))
-	binary.BigEndian.PutUint16(b[14:], uint16(ball.O.X*0.5*DMF))
-	binary.BigEndian.PutUint16(b[16:], uint16(ball.O.Y*DMF))
-	binary.BigEndian.PutUint16(b[18:], uint16(int16(ball.V.X*DVF)))
-	binary.BigEndian.PutUint16(b[20:], uint16(int16(ball.V.Y*DVF)))
-
-	r.Send(b)
+	r.send(codec.WorldState{
+		Self:      codec.MoveState(self),
+		Other:     codec.MoveState(other),
+		Ball:      codec.MoveState(ball),
+		SelfKeys:  codec.InputState(selfKeys),
+		OtherKeys: codec.InputState(otherKeys),
+	})
 }
 
 func (r *RemotePlayer) SendEnter(name string, col int) {
-	b := make([]byte, len(name)+4)
-
-	binary.BigEndian.PutUint32(b, uint32(col))
-	b[0] = 2
-	copy(b[4:], name)
-
-	r.Send(b)
+	r.send(codec.Enter{Name: name, Color: col})
 }
 
-func (r *RemotePlayer) SendLeave() { r.Send([]byte{3}) }
+func (r *RemotePlayer) SendLeave() { r.send(codec.Leave{}) }
 
-func (r *RemotePlayer) SendEndRound(win bool) {
-	if win {
-		r.Send([]byte{4})
-	} else {
-		r.Send([]byte{5})
-	}
-}
+func (r *RemotePlayer) SendEndRound(win bool) { r.send(codec.EndRound{Won: win}) }
 
-func (r *RemotePlayer) SendNextRound(isFirst bool) {
-	if isFirst {
-		r.Send([]byte{6})
-	} else {
-		r.Send([]byte{7})
-	}
-}
+func (r *RemotePlayer) SendNextRound(isFirst bool) { r.send(codec.NextRound{Serve: isFirst}) }
 
-func (r *RemotePlayer) SendPing() {
-	b := make([]byte, 9)
-	b[0] = 9
-	t := uint64(time.Now().UnixNano())
-	binary.BigEndian.PutUint64(b[1:], t)
-	r.Send(b)
-}
+func (r *RemotePlayer) SendPing() { r.send(codec.Ping{Time: time.Now()}) }
 
 func (r *RemotePlayer) SendPingTimes(lPing, rPing int) {
-	if lPing > 0xFFF {
-		lPing = 0xFFF
-	}
-	if rPing > 0xFFF {
-		rPing = 0xFFF
-	}
-	r.Send([]byte{
-		8,
-		byte(lPing),
-		byte(((lPing >> 4) & 0xF0) | ((rPing >> 8) & 0x0F)),
-		byte(rPing),
+	r.send(codec.PingTimes{
+		Self:  time.Duration(lPing) * time.Millisecond,
+		Other: time.Duration(rPing) * time.Millisecond,
 	})
 }
+
+// SendOpponentAway tells the player whether the opponent is reconnecting.
+func (r *RemotePlayer) SendOpponentAway(away bool) { r.send(codec.OpponentAway{Away: away}) }
+
+func (r *RemotePlayer) SendRestart(remaining time.Duration) { r.send(codec.Restart{In: remaining}) }
@@ -0,0 +1,33 @@
+package slime
+
+import (
+	"testing"
+)
+
+func FuzzRemotePlayerRecv(f *testing.F) {
+	f.Add([]byte{1})
+	f.Add([]byte{0, 7})
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0, 1})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		p := NewPlayer([]byte("fuzz"), 0)
+		p.Recv(b)
+
+		switch {
+		case len(b) == 8:
+			if p.Input() != (InputState{}) {
+				t.Errorf("pong %v changed keys to %+v", b, p.Input())
+			}
+		case len(b) == 0:
+			if p.Input() != (InputState{}) || p.Ping != -1 {
+				t.Errorf("empty message changed the player")
+			}
+		default:
+			k := b[len(b)-1]
+			want := InputState{L: k&1 != 0, R: k&2 != 0, U: k&4 != 0}
+			if p.Input() != want {
+				t.Errorf("keys %v gave %+v, want %+v", b, p.Input(), want)
+			}
+		}
+	})
+}
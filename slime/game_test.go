@@ -0,0 +1,76 @@
+package slime
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// newBenchGame makes a started game between two players whose messages are discarded,
+// because they have no connection.
+func newBenchGame(start time.Time) *Game {
+	p1 := NewPlayer([]byte("p1"), 0xFF0000)
+	p2 := NewPlayer([]byte("p2"), 0x0000FF)
+	p1.SetInput(InputState{U: true})
+	p2.SetInput(InputState{L: true})
+	g := NewGame(p1, p2)
+	g.Start(start)
+	return g
+}
+
+// BenchmarkMatchStep measures one scheduler tick of a match on one core,
+// and reports how many matches one core can tick in real time.
+func BenchmarkMatchStep(b *testing.B) {
+	const matches = 1000
+
+	now := time.Now()
+	games := make([]*Game, matches)
+	for i := range games {
+		games[i] = newBenchGame(now)
+	}
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		g := games[i%matches]
+		if i%matches == 0 {
+			now = now.Add(PHYS_TIME)
+		}
+		g.Step(now)
+	}
+	b.StopTimer()
+
+	perStep := time.Since(start) / time.Duration(b.N)
+	if perStep > 0 {
+		b.ReportMetric(float64(PHYS_TIME/perStep), "matches/core")
+	}
+}
+
+// TestGameRand checks that matches with the same Rand and inputs play the same.
+func TestGameRand(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	var games [2]*Game
+	for i := range games {
+		games[i] = NewGame(NewPlayer([]byte("p1"), 0xFF0000), NewPlayer([]byte("p2"), 0x0000FF))
+		games[i].Rand = rand.New(rand.NewSource(1))
+		games[i].Clock = func() time.Time { return start }
+		games[i].Start(games[i].Clock())
+	}
+	a, b := games[0], games[1]
+	if a.seed != b.seed || a.p1First != b.p1First {
+		t.Fatalf("seeds %d and %d", a.seed, b.seed)
+	}
+
+	now := start
+	for i := 0; i < 3000; i++ {
+		now = now.Add(PHYS_TIME)
+		for _, g := range games {
+			g.P1.SetInput(keyState(byte(i / 7)))
+			g.P2.SetInput(keyState(byte(i / 11)))
+			g.Step(now)
+		}
+		if a.Checksum() != b.Checksum() || a.wins != b.wins {
+			t.Fatalf("step %d: games differ", i)
+		}
+	}
+}
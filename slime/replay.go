@@ -0,0 +1,318 @@
+package slime
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// A replay file records a match so that its physics can be simulated again:
+//
+//	header: "SLRP" [version] [seed: 8] [start unix nanoseconds: 8]
+//	        ([color: 4] [name length] [name...]) for P1 and P2
+//	        [MoveState: 32] for P1, P2 and the ball
+//	events: [0] [keys] [checksum: 4]   a physics frame
+//	        [1] [winner]               the end of a round
+//	        [2] [p1 serves]            the start of a round
+//
+// The keys of a frame are the InputState of P1 in bits LRU from the lowest bit,
+// then of P2, sampled before the frame. The checksum is Game.Checksum after the frame.
+// Round events happen between the frames they are recorded between.
+// Integers are big-endian, and a MoveState is O.X, O.Y, V.X and V.Y as float64 bits.
+
+const (
+	replayMagic   = "SLRP"
+	replayVersion = 1
+)
+
+// Kinds of replay events
+const (
+	ReplayFrame ReplayEventKind = iota
+	ReplayEndRound
+	ReplayNextRound
+)
+
+// ErrReplay is returned when reading a malformed replay.
+var ErrReplay = errors.New("slime: malformed replay")
+
+// ReplayEventKind is the kind of a ReplayEvent.
+type ReplayEventKind uint8
+
+// ReplayEvent is a physics frame or a round event of a Replay.
+type ReplayEvent struct {
+	Kind ReplayEventKind
+	// Keys are the inputs of P1 and P2 during a frame.
+	Keys [2]InputState
+	// Checksum is the checksum of the game after a frame.
+	Checksum uint32
+	// Winner is the winner of a round that ended, 1 or 2.
+	Winner int
+	// P1First is whether P1 serves in a round that started.
+	P1First bool
+}
+
+// Replay is a recorded match.
+type Replay struct {
+	Seed   int64
+	Start  time.Time
+	Names  [2]string
+	Colors [2]int
+	// Initial are the states of P1, P2 and the ball when the match started.
+	Initial [3]MoveState
+	Events  []ReplayEvent
+}
+
+// ReplayMismatch is a difference between a replay and its simulation.
+type ReplayMismatch struct {
+	Frame     int    // number of frames simulated before the difference
+	Field     string // "checksum", "winner" or "serve"
+	Want, Got uint32
+}
+
+func (m *ReplayMismatch) Error() string {
+	return fmt.Sprintf("slime: replay %s differs after frame %d: recorded %#x, simulated %#x",
+		m.Field, m.Frame, m.Want, m.Got)
+}
+
+// Checksum returns a checksum of the MoveStates of the players and the ball.
+func (g *Game) Checksum() uint32 {
+	var b [3 * 32]byte
+	putMoveState(b[0:], g.P1.MoveState)
+	putMoveState(b[32:], g.P2.MoveState)
+	putMoveState(b[64:], g.B.MoveState)
+	return crc32.ChecksumIEEE(b[:])
+}
+
+func putMoveState(b []byte, m MoveState) {
+	for i, v := range [4]float64{m.O.X, m.O.Y, m.V.X, m.V.Y} {
+		binary.BigEndian.PutUint64(b[8*i:], math.Float64bits(v))
+	}
+}
+
+func getMoveState(b []byte) (m MoveState) {
+	v := func(i int) float64 { return math.Float64frombits(binary.BigEndian.Uint64(b[8*i:])) }
+	m.O.X, m.O.Y, m.V.X, m.V.Y = v(0), v(1), v(2), v(3)
+	return
+}
+
+func keyBits(k InputState) byte {
+	var b byte
+	if k.L {
+		b |= 1
+	}
+	if k.R {
+		b |= 2
+	}
+	if k.U {
+		b |= 4
+	}
+	return b
+}
+
+func keyState(b byte) InputState {
+	return InputState{L: b&1 != 0, R: b&2 != 0, U: b&4 != 0}
+}
+
+// firstServe returns whether P1 serves first in a match with seed.
+func firstServe(seed int64) bool {
+	return rand.New(rand.NewSource(seed)).Intn(2) == 0
+}
+
+// replayWriter writes the replay of a game.
+type replayWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (r *replayWriter) write(b ...byte) {
+	if r.err == nil {
+		_, r.err = r.w.Write(b)
+	}
+}
+
+func (r *replayWriter) header(g *Game) {
+	b := append([]byte(replayMagic), replayVersion)
+	b = binary.BigEndian.AppendUint64(b, uint64(g.seed))
+	b = binary.BigEndian.AppendUint64(b, uint64(g.start.UnixNano()))
+	for _, p := range [2]*Player{g.P1, g.P2} {
+		name := p.Name
+		if len(name) > 0xFF {
+			name = name[:0xFF]
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(p.Color))
+		b = append(append(b, byte(len(name))), name...)
+	}
+	for _, m := range [3]MoveState{g.P1.MoveState, g.P2.MoveState, g.B.MoveState} {
+		b = append(b, make([]byte, 32)...)
+		putMoveState(b[len(b)-32:], m)
+	}
+	r.write(b...)
+}
+
+func (r *replayWriter) frame(keys [2]InputState, checksum uint32) {
+	r.write(byte(ReplayFrame), keyBits(keys[0])|keyBits(keys[1])<<3,
+		byte(checksum>>24), byte(checksum>>16), byte(checksum>>8), byte(checksum))
+}
+
+func (r *replayWriter) endRound(winner int) {
+	r.write(byte(ReplayEndRound), byte(winner))
+}
+
+func (r *replayWriter) nextRound(p1First bool) {
+	var b byte
+	if p1First {
+		b = 1
+	}
+	r.write(byte(ReplayNextRound), b)
+}
+
+// Record makes the game write a replay of the match to w, from the next Start
+// until StopRecording. It must not be called while the game runs.
+func (g *Game) Record(w io.Writer) {
+	g.replay = &replayWriter{w: bufio.NewWriter(w)}
+}
+
+// StopRecording stops recording the replay, and returns the first error writing it.
+func (g *Game) StopRecording() error {
+	r := g.replay
+	if r == nil {
+		return nil
+	}
+	g.replay = nil
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	return r.err
+}
+
+// ReadReplay reads a replay.
+func ReadReplay(r io.Reader) (*Replay, error) {
+	br := bufio.NewReader(r)
+	read := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return b, nil
+	}
+
+	b, err := read(len(replayMagic) + 1 + 16)
+	if err != nil {
+		return nil, err
+	}
+	if string(b[:4]) != replayMagic || b[4] != replayVersion {
+		return nil, ErrReplay
+	}
+	rp := &Replay{
+		Seed:  int64(binary.BigEndian.Uint64(b[5:])),
+		Start: time.Unix(0, int64(binary.BigEndian.Uint64(b[13:]))),
+	}
+	for i := range rp.Names {
+		if b, err = read(5); err != nil {
+			return nil, err
+		}
+		rp.Colors[i] = int(binary.BigEndian.Uint32(b))
+		if b, err = read(int(b[4])); err != nil {
+			return nil, err
+		}
+		rp.Names[i] = string(b)
+	}
+	if b, err = read(3 * 32); err != nil {
+		return nil, err
+	}
+	for i := range rp.Initial {
+		rp.Initial[i] = getMoveState(b[32*i:])
+	}
+
+	for {
+		kind, err := br.ReadByte()
+		if err == io.EOF {
+			return rp, nil
+		} else if err != nil {
+			return nil, err
+		}
+		e := ReplayEvent{Kind: ReplayEventKind(kind)}
+		switch e.Kind {
+		case ReplayFrame:
+			if b, err = read(5); err != nil {
+				return nil, err
+			}
+			e.Keys = [2]InputState{keyState(b[0]), keyState(b[0] >> 3)}
+			e.Checksum = binary.BigEndian.Uint32(b[1:])
+		case ReplayEndRound:
+			if b, err = read(1); err != nil {
+				return nil, err
+			}
+			e.Winner = int(b[0])
+		case ReplayNextRound:
+			if b, err = read(1); err != nil {
+				return nil, err
+			}
+			e.P1First = b[0] != 0
+		default:
+			return nil, ErrReplay
+		}
+		rp.Events = append(rp.Events, e)
+	}
+}
+
+// Play simulates the match again with PhysicsFrame, calling visit after each frame.
+// It returns a *ReplayMismatch if the simulation differs from the replay.
+func (r *Replay) Play(visit func(frame int, g *Game)) error {
+	p1 := NewPlayer([]byte(r.Names[0]), r.Colors[0])
+	p2 := NewPlayer([]byte(r.Names[1]), r.Colors[1])
+	g := NewGame(p1, p2)
+	p1.MoveState, p2.MoveState, g.B.MoveState = r.Initial[0], r.Initial[1], r.Initial[2]
+
+	winner := 3 // see Start
+	frame := 0
+	serve := firstServe(r.Seed)
+	for _, e := range r.Events {
+		switch e.Kind {
+		case ReplayFrame:
+			p1.InputState, p2.InputState = e.Keys[0], e.Keys[1]
+			g.PhysicsFrame(&winner)
+			frame++
+			if got := g.Checksum(); got != e.Checksum {
+				return &ReplayMismatch{frame, "checksum", e.Checksum, got}
+			}
+			if visit != nil {
+				visit(frame, g)
+			}
+		case ReplayEndRound:
+			if winner != e.Winner {
+				return &ReplayMismatch{frame, "winner", uint32(e.Winner), uint32(winner)}
+			}
+		case ReplayNextRound:
+			// serves alternate, see Step
+			serve = !serve
+			if e.P1First != serve {
+				return &ReplayMismatch{frame, "serve", b2u(e.P1First), b2u(serve)}
+			}
+			winner = 0
+			g.StartRound(e.P1First)
+		}
+	}
+	return nil
+}
+
+// Verify simulates the match again and checks it against the replay.
+func (r *Replay) Verify() error {
+	return r.Play(nil)
+}
+
+func b2u(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
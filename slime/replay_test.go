@@ -0,0 +1,79 @@
+package slime
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordMatch records a match where the players press changing keys.
+func recordMatch(t *testing.T, frames int) []byte {
+	var buf bytes.Buffer
+	p1 := NewPlayer([]byte("p1"), 0xFF0000)
+	p2 := NewPlayer([]byte("p2"), 0x0000FF)
+	p1.MoveState.O.X = 0.3 // left over from an earlier match
+	g := NewGame(p1, p2)
+	g.Record(&buf)
+
+	now := time.Unix(1700000000, 0)
+	g.Start(now)
+	for i := 0; i < frames; i++ {
+		p1.SetInput(keyState(byte(i / 7)))
+		p2.SetInput(keyState(byte(i / 11)))
+		now = now.Add(PHYS_TIME)
+		g.Step(now)
+	}
+	if err := g.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReplay(t *testing.T) {
+	b := recordMatch(t, 3000)
+	r, err := ReadReplay(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Names != [2]string{"p1", "p2"} || r.Colors != [2]int{0xFF0000, 0x0000FF} {
+		t.Errorf("players %q %x", r.Names, r.Colors)
+	}
+	if r.Initial[0].O.X != 0.3 {
+		t.Errorf("initial state %v", r.Initial[0])
+	}
+
+	frames, rounds := 0, 0
+	for _, e := range r.Events {
+		switch e.Kind {
+		case ReplayFrame:
+			frames++
+		case ReplayEndRound:
+			rounds++
+		}
+	}
+	if frames < 3000 || rounds == 0 {
+		t.Fatalf("recorded %d frames and %d rounds", frames, rounds)
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// different inputs change the simulation
+	for i := range r.Events[100:] {
+		r.Events[100+i].Keys[0] = InputState{L: true}
+	}
+	var m *ReplayMismatch
+	if err := r.Verify(); !errors.As(err, &m) {
+		t.Fatalf("Verify of changed replay = %v", err)
+	}
+}
+
+func TestReadReplayTruncated(t *testing.T) {
+	b := recordMatch(t, 10)
+	for _, n := range []int{0, 3, 20, len(b) - 1} {
+		if _, err := ReadReplay(bytes.NewReader(b[:n])); err == nil {
+			t.Errorf("ReadReplay of %d bytes succeeded", n)
+		}
+	}
+}
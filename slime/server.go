@@ -2,9 +2,23 @@
 package slime
 
 import (
-	"victorz.ca/gameserv/common/gameserver"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
-	"github.com/gorilla/websocket"
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/common/metrics"
+	"victorz.ca/gameserv/common/tick"
+	"victorz.ca/gameserv/slime/codec"
 )
 
 type matchReq struct {
@@ -14,81 +28,250 @@ type matchReq struct {
 
 // Server is a Slime Volleyball Multiplayer game server.
 type Server struct {
+	// Responder ignores the events that the Server does not handle.
 	gameserver.Responder[*Player]
 	*gameserver.GameServerCount[Player]
-	matcher chan matchReq
+	gameserver.Lifecycle
+	// Sessions keeps the players that lost their connection.
+	Sessions gameserver.Sessions[*Player]
+	// ReplayDir, if not empty, is the directory where replays of matches are recorded.
+	ReplayDir string
+
+	matcher     chan matchReq
+	pool        *tick.Pool
+	logger      *slog.Logger
+	matches     map[*Game]struct{} // in progress
+	matchesLock sync.Mutex
+
+	metrics       *gameserver.MetricsResponder[*Player]
+	tickDurations *metrics.Histogram
 }
 
-// NewServer makes a new game server.
-func NewServer() Server {
+// NewServer makes a new game server that logs to logger.
+func NewServer(logger *slog.Logger) *Server {
 	const sendBufSize = 70 // enough for at least 2 seconds
 
-	var s Server
+	s := new(Server)
 	s.matcher = make(chan matchReq)
-	r := gameserver.DefaultResponder[Player]()
-	r = gameserver.NewLogCountResponder(r, &s)
-	s.Responder = r
-	s.GameServerCount = gameserver.NewGameServerCount[Player](&s, sendBufSize)
+	s.matches = make(map[*Game]struct{})
+	s.logger = logger.With("game", "slime")
+	s.pool = tick.NewPool(PHYS_TIME, runtime.GOMAXPROCS(0))
+	s.tickDurations = metrics.NewHistogram(metrics.DurationBuckets)
+	s.pool.OnTick = s.tickDurations.ObserveDuration
+	s.Responder = gameserver.DefaultResponder[Player]()
+	s.metrics = gameserver.NewMetricsResponder[*Player](nil, "slime")
+	s.GameServerCount = gameserver.NewGameServerCount[Player](sendBufSize, s,
+		s.metrics.Wrap,
+		gameserver.Slog[*Player](logger, "slime", s),
+	)
 	return s
 }
 
-// Run does nothing and immediately returns, as slime volleyball multiplayer
-// has no tasks to run in the background.
-func (s *Server) Run() {
-	// does nothing
+// Start runs the match scheduler in a new goroutine. Matches
+// end when ctx is cancelled or Stop is called.
+func (s *Server) Start(ctx context.Context) {
+	s.Lifecycle.Start(ctx)
+	s.Go(s.pool.Run)
 }
 
-func (s *Server) PlayerInit(c *websocket.Conn) *Player {
-	return processHello(c)
+// MatchStats returns the timing statistics of the match scheduler.
+func (s *Server) MatchStats() tick.PoolStats {
+	return s.pool.Stats()
 }
 
-func (s *Server) PlayerJoined(c *websocket.Conn, player *gameserver.BinaryPlayer[*Player]) {
-	s.Responder.PlayerJoined(c, player)
+// Name returns "slime", the name of the game.
+func (s *Server) Name() string { return "slime" }
 
-	player.Data.Send = player.Send
-	go playMatches(player.Data, s.matcher)
+// Stats are the statistics of a slime server.
+type Stats struct {
+	Matches  int     `json:"matches"`
+	Overruns uint64  `json:"tick_overruns"`
+	Lag      float64 `json:"tick_lag_seconds"`
+	MaxLag   float64 `json:"tick_lag_max_seconds"`
 }
 
-func (s *Server) PlayerLeft(c *websocket.Conn, player *gameserver.BinaryPlayer[*Player]) {
-	player.Data.Close()
-
-	s.Responder.PlayerLeft(c, player)
+// Stats returns the statistics of the server.
+func (s *Server) Stats() any {
+	stats := s.MatchStats()
+	return Stats{stats.Active, stats.Overruns, stats.LastLag.Seconds(), stats.MaxLag.Seconds()}
 }
 
-func (s *Server) MessageReceived(player *gameserver.BinaryPlayer[*Player], msg []byte) {
-	s.Responder.MessageReceived(player, msg)
+// Collect writes the metrics of the server.
+func (s *Server) Collect(w *metrics.Writer) {
+	s.metrics.Collect(w)
 
-	player.Data.Recv(msg)
+	stats := s.MatchStats()
+	w.Gauge("gameserv_slime_matches", "Number of slime matches in progress.", float64(stats.Active))
+	w.Histogram("gameserv_tick_duration_seconds", "Time taken to process one game tick.", s.tickDurations, "game", "slime")
+	w.Counter("gameserv_tick_overruns_total", "Times the simulation fell too far behind to catch up.", stats.Overruns, "game", "slime")
+	w.Gauge("gameserv_slime_tick_lag_seconds", "Delay between when the last match tick was due and when it finished.", stats.LastLag.Seconds())
+	w.Gauge("gameserv_slime_tick_lag_max_seconds", "Largest delay of any match tick.", stats.MaxLag.Seconds())
+}
+
+// Shutdown drains the server, telling players when it restarts.
+// Matches in progress end after their current round.
+// See gameserver.BaseGameServer.Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.GameServerCount.Shutdown(ctx, func(player *gameserver.BinaryPlayer[*Player], remaining time.Duration) {
+		player.Data.SendRestart(remaining)
+	})
 }
 
-func processHello(c *websocket.Conn) *Player {
+func (s *Server) PlayerInit(meta *gameserver.ConnMeta, c gameserver.Conn) (*Player, error) {
 	mt, h, err := c.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := gameserver.ResumeMessage(mt, h); ok {
+		p, ok := s.Sessions.Resume(token)
+		if !ok {
+			return nil, gameserver.ReasonSessionExpired
+		}
+		return p, nil
+	}
+	p, err := processHello(mt, h)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.CheckName(p.Name); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
-	if mt != websocket.BinaryMessage || err != nil || len(h) < 3 {
-		return nil
+func (s *Server) PlayerJoined(c gameserver.Conn, player *gameserver.BinaryPlayer[*Player]) {
+	if player.Data.Attach(player) {
+		// the match of a resumed player is still running
+		return
 	}
+	if !s.Go(func(ctx context.Context) {
+		s.playMatches(ctx, player.Data)
+	}) {
+		// the server has stopped
+		player.Disconnect(gameserver.ReasonShuttingDown)
+	}
+}
 
-	name := h[3:]
-	col := int(h[0])<<16 | int(h[1])<<8 | int(h[2])
+func (s *Server) PlayerLeft(c gameserver.Conn, player *gameserver.BinaryPlayer[*Player]) {
+	if s.Sessions.Grace > 0 && player.Reason().Resumable() && !s.IsDraining() && player.Data.CanResume() {
+		// keep the match for the grace period
+		s.Sessions.Park(player.Data.Detach(), player.Data, (*Player).Close)
+	} else {
+		player.Data.Close()
+	}
+}
+
+func (s *Server) MessageReceived(player *gameserver.BinaryPlayer[*Player], msg []byte) {
+	player.Data.Recv(msg)
+}
 
-	return NewPlayer(name, col)
+// processHello processes the first incoming message, when it is not a resume message,
+// and negotiates the handshake of the connection.
+func processHello(mt int, h []byte) (*Player, error) {
+	var hello codec.Hello
+	if mt != gameserver.BinaryMessage || hello.UnmarshalBinary(h) != nil {
+		return nil, gameserver.ReasonProtocolError
+	}
+	hs, err := codec.Protocol.Negotiate(hello.Handshake)
+	if err != nil {
+		return nil, err
+	}
+	p := NewPlayer(hello.Name, hello.Color)
+	p.handshake = hs
+	return p, nil
 }
 
-func playMatches(p *Player, matcher chan matchReq) {
-	p.SendWelcome()
+// playMatches matches the player with opponents until the player leaves.
+// When the server drains, the player is disconnected after the current match.
+func (s *Server) playMatches(ctx context.Context, p *Player) {
+	drain := s.Draining()
 	for {
+		select {
+		case <-drain:
+			p.Disconnect(gameserver.ReasonShuttingDown)
+			return
+		case <-p.Stop:
+			// do not offer a player that left to the matcher
+			return
+		default:
+		}
+
 		m := matchReq{p, make(chan struct{})}
 		select {
+		case <-ctx.Done():
+			return
 		case <-p.Stop:
 			return
-		case matcher <- m:
+		case <-drain:
+			// checked again at the start of the loop
+		case s.matcher <- m:
 			// wait for game to end
 			<-m.result
-		case other := <-matcher:
+		case other := <-s.matcher:
 			m.result = nil // free unused chan
 			g := NewGame(p, other.p)
-			g.Run()
+			g.Drain = drain
+			g.Logger = s.logger
+			stopRecording := s.record(g)
+			g.Start(g.Now())
+			s.matchesLock.Lock()
+			s.matches[g] = struct{}{}
+			s.matchesLock.Unlock()
+			<-s.pool.Add(g)
+			s.matchesLock.Lock()
+			delete(s.matches, g)
+			s.matchesLock.Unlock()
+			g.LogResult()
+			stopRecording()
 			other.result <- struct{}{}
 		}
 	}
 }
+
+// record makes g record a replay in ReplayDir, and returns a function
+// that stops recording once the match ends.
+func (s *Server) record(g *Game) (stop func()) {
+	if s.ReplayDir == "" {
+		return func() {}
+	}
+	name := fmt.Sprintf("%s-%s-%s", time.Now().UTC().Format("20060102T150405.000"),
+		fileName(g.P1.Name), fileName(g.P2.Name))
+	f, err := createReplay(filepath.Join(s.ReplayDir, name))
+	if err != nil {
+		s.logger.Warn("replay", "error", err)
+		return func() {}
+	}
+	g.Record(f)
+	return func() {
+		err := g.StopRecording()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			s.logger.Warn("replay", "file", f.Name(), "error", err)
+		}
+	}
+}
+
+// createReplay creates a new replay file named path.slrp, or if it exists,
+// path-1.slrp, path-2.slrp and so on, so that no replay is overwritten.
+func createReplay(path string) (*os.File, error) {
+	name := path + ".slrp"
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if !errors.Is(err, fs.ErrExist) || i > 100 {
+			return f, err
+		}
+		name = fmt.Sprintf("%s-%d.slrp", path, i)
+	}
+}
+
+// fileName replaces the characters of a player name that are unsafe in a file name.
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,76 @@
+package slime
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/slime/codec"
+)
+
+func TestProcessHelloVersion(t *testing.T) {
+	tests := []struct {
+		h   []byte
+		hs  gameserver.Handshake
+		err error
+	}{
+		{[]byte("\xFF\x00\x00alice"), gameserver.Handshake{}, nil},
+		{[]byte("\xFF\x00\x00\xFF\x01\x00\x01alice"), gameserver.Handshake{Version: 1, Caps: codec.CapResume}, nil},
+		{[]byte("\xFF\x00\x00\xFF\x01\x00\x00alice"), gameserver.Handshake{Version: 1}, nil},
+		{[]byte("\xFF\x00\x00\xFF\x09\x00\x01alice"), gameserver.Handshake{}, gameserver.ReasonUnsupportedVersion},
+		{[]byte("\xFF\x00\x00\xFF\x00\x00\x01alice"), gameserver.Handshake{}, gameserver.ReasonProtocolError},
+	}
+	for _, tt := range tests {
+		p, err := processHello(gameserver.BinaryMessage, tt.h)
+		if err != tt.err {
+			t.Errorf("processHello(%q) error = %v, want %v", tt.h, err, tt.err)
+			continue
+		}
+		if err == nil && (p.handshake != tt.hs || p.Name != "alice") {
+			t.Errorf("processHello(%q) = %q, %v, want %v", tt.h, p.Name, p.handshake, tt.hs)
+		}
+	}
+}
+
+func FuzzProcessHello(f *testing.F) {
+	f.Add(gameserver.BinaryMessage, []byte("\xFF\x00\x00alice"))
+	f.Add(gameserver.BinaryMessage, []byte("\xFF\x00\x00\xFF\x01\x00\x01alice"))
+	f.Add(gameserver.BinaryMessage, []byte{1, 2})
+	f.Add(gameserver.TextMessage, []byte("\xFF\x00\x00alice"))
+	f.Fuzz(func(t *testing.T, mt int, h []byte) {
+		p, err := processHello(mt, h)
+		if err != nil {
+			if mt == gameserver.BinaryMessage && len(h) >= 3 && (len(h) == 3 || h[3] != gameserver.HelloMagic) {
+				t.Errorf("rejected legacy hello %v: %v", h, err)
+			}
+			return
+		}
+		if mt != gameserver.BinaryMessage || len(h) < 3 {
+			t.Fatalf("accepted type %d message %v", mt, h)
+		}
+		if p.Color < 0 || p.Color > 0xFFFFFF {
+			t.Errorf("color %#x out of range", p.Color)
+		}
+		if len(p.Name) > 16 {
+			t.Errorf("name %q too long", p.Name)
+		}
+	})
+}
+
+func TestCreateReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "match")
+	var names []string
+	for i := 0; i < 3; i++ {
+		f, err := createReplay(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		names = append(names, filepath.Base(f.Name()))
+	}
+	want := []string{"match.slrp", "match-1.slrp", "match-2.slrp"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("created %q, want %q", names, want)
+	}
+}
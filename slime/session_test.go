@@ -0,0 +1,173 @@
+package slime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/slime/codec"
+)
+
+// newTestServer starts a server whose sessions are kept for grace.
+func newTestServer(t *testing.T, grace time.Duration) *Server {
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s.Sessions.Grace = grace
+	s.Start(context.Background())
+	t.Cleanup(func() {
+		s.Stop()
+		s.Wait()
+	})
+	return s
+}
+
+// connect connects to s over a Pipe, and sends the first message.
+func connect(t *testing.T, s *Server, mt int, first []byte) gameserver.Conn {
+	t.Helper()
+	client, server := gameserver.Pipe(256)
+	t.Cleanup(func() { client.Close() })
+	go s.ServeConn(server)
+	if err := client.WriteMessage(mt, first); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// join connects a player with a hello with the handshake hs,
+// which is a legacy hello if hs is zero.
+func join(t *testing.T, s *Server, name string, hs gameserver.Handshake) gameserver.Conn {
+	t.Helper()
+	hello := codec.Hello{Color: 0xFF0000, Name: []byte(name)}
+	hello.Handshake = hs
+	b, _ := hello.MarshalBinary()
+	return connect(t, s, gameserver.BinaryMessage, b)
+}
+
+// resume connects with a resume message.
+func resume(t *testing.T, s *Server, token gameserver.ResumeToken) gameserver.Conn {
+	t.Helper()
+	return connect(t, s, gameserver.TextMessage, []byte(token.String()))
+}
+
+// expect reads messages from c until one of type T, and returns it.
+func expect[T codec.ServerMessage](t *testing.T, c gameserver.Conn) T {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, b, err := c.ReadMessage()
+		if err != nil {
+			var zero T
+			t.Fatalf("read %v, want %T", err, zero)
+		}
+		m, err := codec.Decode(b)
+		if err != nil {
+			t.Fatalf("decode %v: %v", b, err)
+		}
+		if m, ok := m.(T); ok {
+			return m
+		}
+	}
+}
+
+// expectClose reads messages from c until it is closed with code.
+func expectClose(t *testing.T, c gameserver.Conn, code int) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := c.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) || ce.Code != code {
+			t.Fatalf("read %v, want close code %d", err, code)
+		}
+		return
+	}
+}
+
+// match starts a match between two players that can resume,
+// and returns their connections and tokens.
+func match(t *testing.T, s *Server) (a, b gameserver.Conn, tokenA gameserver.ResumeToken) {
+	t.Helper()
+	a = join(t, s, "alice", codec.Protocol.Latest())
+	tokenA = expect[codec.ResumeToken](t, a).Token
+	b = join(t, s, "bob", codec.Protocol.Latest())
+	expect[codec.Enter](t, a)
+	expect[codec.Enter](t, b)
+	return a, b, tokenA
+}
+
+func TestResumeMatch(t *testing.T) {
+	s := newTestServer(t, time.Second)
+	a, b, token := match(t, s)
+
+	a.Close()
+	if m := expect[codec.OpponentAway](t, b); !m.Away {
+		t.Error("opponent not away after losing its connection")
+	}
+
+	a = resume(t, s, token)
+	expect[codec.Welcome](t, a)
+	if next := expect[codec.ResumeToken](t, a).Token; next == token {
+		t.Error("token reused after resuming")
+	}
+	if m := expect[codec.Enter](t, a); m.Name != "bob" {
+		t.Errorf("resumed player entered a match with %q, want bob", m.Name)
+	}
+	if m := expect[codec.OpponentAway](t, b); m.Away {
+		t.Error("opponent still away after resuming")
+	}
+
+	// a token can only be used once
+	expectClose(t, resume(t, s, token), gameserver.CloseSessionExpired)
+}
+
+func TestResumeWrongToken(t *testing.T) {
+	s := newTestServer(t, time.Second)
+	expectClose(t, resume(t, s, gameserver.NewResumeToken()), gameserver.CloseSessionExpired)
+}
+
+func TestResumeExpired(t *testing.T) {
+	s := newTestServer(t, 200*time.Millisecond)
+	a, b, token := match(t, s)
+
+	a.Close()
+	if m := expect[codec.OpponentAway](t, b); !m.Away {
+		t.Error("opponent not away after losing its connection")
+	}
+	expect[codec.Leave](t, b)
+
+	expectClose(t, resume(t, s, token), gameserver.CloseSessionExpired)
+	if n := s.Sessions.Len(); n != 0 {
+		t.Errorf("%d sessions parked after the grace period", n)
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	s := newTestServer(t, time.Second)
+	a := join(t, s, "alice", gameserver.Handshake{})
+	b := join(t, s, "bob", codec.Protocol.Latest())
+	expect[codec.Enter](t, a)
+	expect[codec.Enter](t, b)
+
+	// the session of a legacy client is not kept
+	a.Close()
+	for {
+		m := expect[codec.ServerMessage](t, b)
+		if _, ok := m.(codec.OpponentAway); ok {
+			t.Error("opponent away after a legacy client lost its connection")
+		}
+		if _, ok := m.(codec.Leave); ok {
+			break
+		}
+	}
+	if n := s.Sessions.Len(); n != 0 {
+		t.Errorf("%d sessions parked for a legacy client", n)
+	}
+}
@@ -1,33 +1,327 @@
 package main
 
 import (
+	"victorz.ca/gameserv/common/admin"
+	"victorz.ca/gameserv/common/gameserver"
+	"victorz.ca/gameserv/common/metrics"
 	"victorz.ca/gameserv/duel"
 	"victorz.ca/gameserv/slime"
 
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
-var slimeServer = slime.NewServer()
-var duelGame = duel.NewServer()
+var logger = newLogger()
+var games gameserver.Registry
+var enabledGames = parseGames()
+var metricsRegistry metrics.Registry
+var adminHandler = admin.Handler{Token: os.Getenv("ADMIN_TOKEN"), Logger: logger}
+var bans = loadBans()
+var trustedProxies = parseTrustedProxies()
+var allowedOrigins = parseAllowedOrigins()
 
 func init() {
-	http.HandleFunc("/s/n", slimeServer.HandleNum)
-	http.HandleFunc("/s", slimeServer.HandlePlayer)
-	http.HandleFunc("/d/n", duelGame.HandleNum)
-	http.HandleFunc("/d", duelGame.HandlePlayer)
+	adminHandler.TrustedProxies = trustedProxies
+	adminHandler.Bans = bans
+
+	register(newSlime(), "s")
+	register(newDuel(), "d")
+	for name := range enabledGames {
+		if games.Lookup(name) == nil {
+			logger.Warn("unknown game in GAMES", "game", name)
+		}
+	}
+
+	games.Mount(http.DefaultServeMux)
+	http.Handle("/metrics", &metricsRegistry)
+	if adminHandler.Token != "" {
+		http.Handle("/admin/", http.StripPrefix("/admin", &adminHandler))
+	}
 	http.HandleFunc("/", hello)
 }
 
+// newSlime makes a slime server configured by environment variables.
+func newSlime() *slime.Server {
+	s := slime.NewServer(logger)
+	configure(&s.BaseGameServer, "SLIME")
+	s.Sessions.Grace = gameEnvDuration("SLIME", "RESUME_GRACE", 15*time.Second)
+	s.ReplayDir = os.Getenv("SLIME_REPLAY_DIR")
+	return s
+}
+
+// newDuel makes a duel server configured by environment variables.
+func newDuel() *duel.Server {
+	s := duel.NewServer(logger)
+	configure(&s.BaseGameServer, "DUEL")
+	s.Sessions.Grace = gameEnvDuration("DUEL", "RESUME_GRACE", 30*time.Second)
+	return s
+}
+
+// configure applies the settings shared by every game to a game server.
+func configure[P any](g *gameserver.BaseGameServer[P], game string) {
+	g.UpgradeConfig = gameserver.UpgradeConfig{
+		AllowedOrigins:     allowedOrigins,
+		Subprotocols:       splitList(gameEnv(game, "WS_SUBPROTOCOLS")),
+		RequireSubprotocol: gameEnv(game, "WS_REQUIRE_SUBPROTOCOL") != "",
+		ReadBufferSize:     int(gameEnvFloat(game, "WS_READ_BUFFER_SIZE", 0)),
+		WriteBufferSize:    int(gameEnvFloat(game, "WS_WRITE_BUFFER_SIZE", 0)),
+		EnableCompression:  gameEnv(game, "WS_COMPRESSION") != "",
+	}
+	g.ConnLimits = connLimits(game)
+	g.Inbound = inboundPolicy(game)
+	g.Timeouts = timeouts(game)
+	g.TrustedProxies = trustedProxies
+	g.Bans = bans
+}
+
+// register serves a game at /{name} and at each of aliases, and exports
+// its metrics and admin API, unless it is disabled by GAMES.
+func register(g gameserver.Game, aliases ...string) {
+	if enabledGames != nil && !enabledGames[g.Name()] {
+		logger.Info("game disabled", "game", g.Name())
+		return
+	}
+	games.Register(g, aliases...)
+	if c, ok := g.(metrics.Collector); ok {
+		metricsRegistry.Register(c)
+	}
+	if a, ok := g.(admin.Game); ok && adminHandler.Token != "" {
+		adminHandler.Register(g.Name(), a)
+	}
+}
+
+// parseGames parses the GAMES environment variable, the names of the games
+// to serve separated by commas, such as "duel,slime". If it is unset,
+// every game is served, and nil is returned.
+func parseGames() map[string]bool {
+	names := splitList(os.Getenv("GAMES"))
+	if names == nil {
+		return nil
+	}
+	enabled := make(map[string]bool)
+	for _, name := range names {
+		enabled[name] = true
+	}
+	return enabled
+}
+
+// splitList splits a comma-separated list, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func hello(res http.ResponseWriter, req *http.Request) {
 	fmt.Fprintf(res, "hello")
 }
 
+// loadBans loads the ban list saved in the BAN_FILE environment variable,
+// or makes a list that is not saved if it is unset.
+func loadBans() *gameserver.BanList {
+	l, err := gameserver.LoadBanList(os.Getenv("BAN_FILE"))
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// parseTrustedProxies parses the TRUSTED_PROXIES environment variable,
+// the addresses and CIDR ranges of reverse proxies, and TRUSTED_PROXY_HEADER,
+// the one forwarding header they set: X-Forwarded-For (the default),
+// Forwarded or X-Real-IP.
+func parseTrustedProxies() gameserver.TrustedProxies {
+	t, err := gameserver.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"), os.Getenv("TRUSTED_PROXY_HEADER"))
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// parseAllowedOrigins parses the ALLOWED_ORIGINS environment variable,
+// the origins of browser clients that may connect (see
+// gameserver.UpgradeConfig), and logs the policy. If it is unset,
+// any origin may connect, as before origins were checked;
+// ALLOWED_ORIGINS=same-origin only allows the origin of the server.
+func parseAllowedOrigins() []string {
+	env := os.Getenv("ALLOWED_ORIGINS")
+	switch strings.TrimSpace(env) {
+	case "":
+		logger.Info("allowed origins: any (set ALLOWED_ORIGINS to restrict)")
+		return []string{"*"}
+	case "same-origin":
+		logger.Info("allowed origins: same-origin only")
+		return nil
+	}
+	origins := gameserver.ParseOrigins(env)
+	logger.Info("allowed origins", "origins", origins)
+	return origins
+}
+
+// gameEnv returns the environment variable named key prefixed by the game
+// (such as DUEL_MAX_CONNS_PER_IP), or the unprefixed variable if unset.
+func gameEnv(game, key string) string {
+	if env := os.Getenv(game + "_" + key); env != "" {
+		return env
+	}
+	return os.Getenv(key)
+}
+
+// gameEnvFloat parses a number from gameEnv, or returns def.
+func gameEnvFloat(game, key string, def float64) float64 {
+	if env := gameEnv(game, key); env != "" {
+		if f, err := strconv.ParseFloat(env, 64); err == nil {
+			return f
+		}
+		logger.Warn("invalid number", "key", key, "value", env)
+	}
+	return def
+}
+
+// connLimits returns the connection limits for a game, which are off
+// unless set. Limits apply to the address of the client: behind a reverse
+// proxy, that is the address of the proxy for every player unless the proxy
+// is in TRUSTED_PROXIES, so set TRUSTED_PROXIES before enabling limits there.
+func connLimits(game string) gameserver.ConnLimitConfig {
+	return gameserver.ConnLimitConfig{
+		MaxPerIP:     int(gameEnvFloat(game, "MAX_CONNS_PER_IP", 0)),
+		MaxPerSubnet: int(gameEnvFloat(game, "MAX_CONNS_PER_SUBNET", 0)),
+		Rate:         gameEnvFloat(game, "CONN_RATE", 0),
+		Burst:        int(gameEnvFloat(game, "CONN_BURST", 10)),
+	}
+}
+
+// inboundPolicy returns the limits on messages received by a game.
+func inboundPolicy(game string) gameserver.InboundPolicy {
+	return gameserver.InboundPolicy{
+		MaxMessageSize:  int64(gameEnvFloat(game, "MAX_MESSAGE_SIZE", 1024)),
+		Rate:            gameEnvFloat(game, "MESSAGE_RATE", 60),
+		Burst:           int(gameEnvFloat(game, "MESSAGE_BURST", 120)),
+		StrikeWindow:    10 * time.Second,
+		DropAfter:       int(gameEnvFloat(game, "MESSAGE_DROP_AFTER", 20)),
+		DisconnectAfter: int(gameEnvFloat(game, "MESSAGE_DISCONNECT_AFTER", 200)),
+	}
+}
+
+// gameEnvDuration parses a duration from gameEnv, or returns def.
+func gameEnvDuration(game, key string, def time.Duration) time.Duration {
+	if env := gameEnv(game, key); env != "" {
+		if d, err := time.ParseDuration(env); err == nil {
+			return d
+		}
+		logger.Warn("invalid duration", "key", key, "value", env)
+	}
+	return def
+}
+
+// timeouts returns the connection timeouts of a game.
+func timeouts(game string) gameserver.TimeoutConfig {
+	return gameserver.TimeoutConfig{
+		Handshake:    gameEnvDuration(game, "HANDSHAKE_TIMEOUT", 10*time.Second),
+		Idle:         gameEnvDuration(game, "IDLE_TIMEOUT", 60*time.Second),
+		PingInterval: gameEnvDuration(game, "PING_INTERVAL", 20*time.Second),
+		Write:        gameEnvDuration(game, "WRITE_TIMEOUT", 10*time.Second),
+	}
+}
+
+// newLogger makes a logger configured by the LOG_FORMAT (json or logfmt)
+// and LOG_LEVEL (debug, info, warn or error) environment variables.
+func newLogger() *slog.Logger {
+	var level slog.Level
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		if err := level.UnmarshalText([]byte(env)); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid LOG_LEVEL %q\n", env)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if os.Getenv("LOG_FORMAT") == "json" {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		h = slog.NewTextHandler(os.Stderr, opts)
+	}
+
+	l := slog.New(h)
+	slog.SetDefault(l)
+	return l
+}
+
+// drainTimeout returns how long players are given to finish when shutting down.
+func drainTimeout() time.Duration {
+	if env := os.Getenv("DRAIN_TIMEOUT"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil {
+			return d
+		}
+		logger.Warn("invalid DRAIN_TIMEOUT", "value", env)
+	}
+	return 30 * time.Second
+}
+
+// shutdown drains the games, then stops the HTTP server
+// and waits for the games to stop.
+func shutdown(srv *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := games.Shutdown(ctx); err != nil {
+		logger.Warn("players disconnected", "error", err)
+	}
+
+	httpCtx, httpCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer httpCancel()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		logger.Error("HTTP shutdown", "error", err)
+	}
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	games.Stop()
+}
+
+// listeners accept players over TCP.
+var listeners []net.Listener
+
+// listenTCP serves players of a game over TCP, if the TCP_ADDR environment
+// variable of the game (such as DUEL_TCP_ADDR) is set.
+func listenTCP(game string, serve func(net.Listener) error) {
+	addr := os.Getenv(game + "_TCP_ADDR")
+	if addr == "" {
+		return
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	listeners = append(listeners, l)
+	fmt.Printf("Listening for %s players on %s\n", game, l.Addr())
+	go serve(l)
+}
+
 // Entry point of server program
 func main() {
-	// go slimeServer.Run()
-	go duelGame.Run()
+	ctx := context.Background()
+	games.Start(ctx)
+	for _, g := range games.Games() {
+		if t, ok := g.(interface{ ServeTCP(net.Listener) error }); ok {
+			listenTCP(strings.ToUpper(g.Name()), t.ServeTCP)
+		}
+	}
 
 	bind := ":8080"
 	if env := os.Getenv("OPENSHIFT_GO_PORT"); env != "" {
@@ -36,9 +330,23 @@ func main() {
 		bind = ":" + env
 	}
 
+	srv := &http.Server{Addr: bind}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sigCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCtx.Done()
+		stop() // a second signal terminates immediately
+
+		timeout := drainTimeout()
+		logger.Info("Shutting down", "timeout", timeout)
+		shutdown(srv, timeout)
+	}()
+
 	fmt.Printf("Listening on %s\n", bind)
-	err := http.ListenAndServe(bind, nil)
-	if err != nil {
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
 		panic(err)
 	}
+	<-done
 }